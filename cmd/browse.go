@@ -0,0 +1,608 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+	"golang.org/x/term"
+)
+
+// browseCmd represents the browse command
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Browse the knowledge base",
+	Long: `Browse the knowledge base in a full-screen terminal view. The left pane
+shows the category tree, i.e. the 'is' hierarchy, the right pane the sections
+of the selected Thing.
+
+Keys:
+  j, k, arrows     move in the tree (PgUp, PgDn, g, G jump)
+  tab, ], [        select the next or previous relation or backlink
+  enter, l, right  jump to the selected relation or backlink
+  b, h, left       jump back
+  /                search incrementally (enter keeps, esc cancels)
+  n, N             next or previous search match
+  e                edit the selected Thing
+  r                reload the knowledge base
+  q                quit`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("editor", cmd.PersistentFlags().Lookup("editor"))
+		editor := viper.GetString("editor")
+
+		viper.BindPFlag("schema", cmd.PersistentFlags().Lookup("schema"))
+		schema := viper.GetString("schema")
+
+		viper.BindPFlag("thing", cmd.PersistentFlags().Lookup("thing"))
+		thing := viper.GetString("thing")
+
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		b := NewBrowser(kb)
+		if thing != "" {
+			ct, e := kb.Resolve(thing)
+			if e != nil {
+				log.Fatalf("Could not find the Thing: %s\n", e)
+			}
+			b.Select(ct)
+		}
+		e = b.Run(os.Stdin, os.Stdout, func(ct *util.ContextThing) {
+			EditThing(editor, ct.Location(), context, false, schema, false, "", "")
+		}, func() (*util.KnowledgeBase, error) {
+			return util.LoadKnowledgeBase(context)
+		})
+		if e != nil {
+			log.Fatalf("Could not browse the knowledge base: %s.\n", e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(browseCmd)
+
+	browseCmd.PersistentFlags().StringP("thing", "t", "", "the thing to start with: a path, UUID, name or name prefix")
+	browseCmd.PersistentFlags().String("editor", "", "specify the editor of choice (default: Environment Variable $EDITOR)")
+	browseCmd.PersistentFlags().StringP("schema", "s", "", "the schema to validate against if the thing does not name one")
+}
+
+// The actions the terminal loop has to take care of.
+const (
+	browseNone = iota
+	browseQuit
+	browseEdit
+	browseReload
+)
+
+type browseItem struct {
+	thing *util.ContextThing
+	depth int
+}
+
+type browseLink struct {
+	label  string
+	target *util.ContextThing
+}
+
+// A Browser holds the state of the view, it knows nothing about the
+// terminal, so it can be driven by HandleKey and looked at with Render.
+type Browser struct {
+	kb        *util.KnowledgeBase
+	items     []browseItem
+	selected  int
+	treeTop   int
+	link      int
+	detailTop int
+	history   []*util.ContextThing
+	searching bool
+	search    string
+	before    int
+	message   string
+}
+
+func NewBrowser(kb *util.KnowledgeBase) *Browser {
+	b := &Browser{}
+	b.load(kb)
+	return b
+}
+
+// Build the tree: every Thing below each Thing it 'is', and the Things that
+// do not belong anywhere (or only to a cycle) at the top.
+func (b *Browser) load(kb *util.KnowledgeBase) {
+
+	b.kb = kb
+	b.items = nil
+	shown := make(map[*util.ContextThing]bool)
+	var add func(ct *util.ContextThing, depth int, path map[*util.ContextThing]bool)
+	add = func(ct *util.ContextThing, depth int, path map[*util.ContextThing]bool) {
+		b.items = append(b.items, browseItem{ct, depth})
+		shown[ct] = true
+		path[ct] = true
+		for _, c := range (&util.KnowledgeBase{Things: kb.Children(ct)}).SortedThings() {
+			if !path[c] {
+				add(c, depth+1, path)
+			}
+		}
+		delete(path, ct)
+	}
+	things := kb.SortedThings()
+	for _, ct := range things {
+		if len(kb.Parents(ct)) == 0 {
+			add(ct, 0, make(map[*util.ContextThing]bool))
+		}
+	}
+	for _, ct := range things {
+		if !shown[ct] {
+			add(ct, 0, make(map[*util.ContextThing]bool))
+		}
+	}
+	if b.selected >= len(b.items) {
+		b.selected = len(b.items) - 1
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+}
+
+// Current returns the selected Thing, or nil if the knowledge base is empty.
+func (b *Browser) Current() *util.ContextThing {
+	if len(b.items) == 0 {
+		return nil
+	}
+	return b.items[b.selected].thing
+}
+
+// Select moves the selection to the first place the Thing shows up in the
+// tree.
+func (b *Browser) Select(ct *util.ContextThing) bool {
+	for i, it := range b.items {
+		if it.thing == ct {
+			b.move(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Browser) move(i int) {
+	if i >= len(b.items) {
+		i = len(b.items) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	if i != b.selected {
+		b.link = 0
+		b.detailTop = 0
+	}
+	b.selected = i
+}
+
+// The relations and backlinks of the selected Thing, in the order shown.
+func (b *Browser) links() []browseLink {
+
+	ct := b.Current()
+	if ct == nil {
+		return nil
+	}
+	var r []browseLink
+	for _, l := range ct.Relation {
+		kind := l.Kind
+		if kind == "" {
+			kind = "is"
+		}
+		t, err := b.kb.ResolveRelation(l.ThingUrl)
+		if err != nil {
+			r = append(r, browseLink{kind + ": " + l.ThingUrl + " (not found)", nil})
+		} else {
+			r = append(r, browseLink{kind + ": " + browseTitle(t), t})
+		}
+	}
+	for _, t := range (&util.KnowledgeBase{Things: b.kb.Backlinks(ct)}).SortedThings() {
+		r = append(r, browseLink{"<- " + browseTitle(t), t})
+	}
+	return r
+}
+
+func browseTitle(ct *util.ContextThing) string {
+	if ct.Id.Name != "" {
+		return ct.Id.Name + " (" + ct.Location() + ")"
+	}
+	return ct.Location()
+}
+
+// The matches of the search, in tree order.
+func (b *Browser) matches() []int {
+
+	var r []int
+	found := make(map[*util.ContextThing]bool)
+	for _, ct := range b.kb.Search(b.search) {
+		found[ct] = true
+	}
+	for i, it := range b.items {
+		if found[it.thing] {
+			found[it.thing] = false
+			r = append(r, i)
+		}
+	}
+	return r
+}
+
+func (b *Browser) nextMatch(step int) {
+
+	if b.search == "" {
+		b.message = "Nothing to search for, use '/'."
+		return
+	}
+	m := b.matches()
+	if len(m) == 0 {
+		b.message = "No match for '" + b.search + "'."
+		return
+	}
+	if step > 0 {
+		for _, i := range m {
+			if i > b.selected {
+				b.move(i)
+				return
+			}
+		}
+		b.move(m[0])
+		return
+	}
+	for j := len(m) - 1; j >= 0; j-- {
+		if m[j] < b.selected {
+			b.move(m[j])
+			return
+		}
+	}
+	b.move(m[len(m)-1])
+}
+
+// HandleKey changes the state according to the key, which is the input
+// read at once, e.g. "j" or "\x1b[A". It returns what the caller has to do.
+func (b *Browser) HandleKey(key string) int {
+
+	b.message = ""
+	if b.searching {
+		switch key {
+		case "\r", "\n":
+			b.searching = false
+		case "\x1b", "\x03":
+			b.searching = false
+			b.search = ""
+			b.move(b.before)
+		case "\x7f", "\b":
+			if r := []rune(b.search); len(r) > 0 {
+				b.search = string(r[:len(r)-1])
+			}
+			b.incremental()
+		default:
+			if key[0] >= ' ' && key[0] != 0x7f {
+				b.search += key
+				b.incremental()
+			}
+		}
+		return browseNone
+	}
+	switch key {
+	case "q", "\x03":
+		return browseQuit
+	case "j", "\x1b[B", "\x1bOB":
+		b.move(b.selected + 1)
+	case "k", "\x1b[A", "\x1bOA":
+		b.move(b.selected - 1)
+	case "\x1b[6~", " ":
+		b.move(b.selected + 10)
+	case "\x1b[5~":
+		b.move(b.selected - 10)
+	case "g", "\x1b[H":
+		b.move(0)
+	case "G", "\x1b[F":
+		b.move(len(b.items) - 1)
+	case "\t", "]":
+		if n := len(b.links()); n > 0 {
+			b.link = (b.link + 1) % n
+		}
+	case "\x1b[Z", "[":
+		if n := len(b.links()); n > 0 {
+			b.link = (b.link + n - 1) % n
+		}
+	case "\r", "\n", "\x1b[C", "l":
+		ls := b.links()
+		if b.link >= len(ls) {
+			b.message = "No relation to follow."
+		} else if ls[b.link].target == nil {
+			b.message = "The Thing is not in the knowledge base."
+		} else {
+			from := b.Current()
+			if b.Select(ls[b.link].target) {
+				b.history = append(b.history, from)
+			}
+		}
+	case "b", "\x7f", "\b", "\x1b[D", "h":
+		if len(b.history) == 0 {
+			b.message = "Nowhere to go back to."
+			break
+		}
+		ct := b.history[len(b.history)-1]
+		b.history = b.history[:len(b.history)-1]
+		b.Select(ct)
+	case "/":
+		b.searching = true
+		b.search = ""
+		b.before = b.selected
+	case "n":
+		b.nextMatch(1)
+	case "N":
+		b.nextMatch(-1)
+	case "e":
+		if b.Current() != nil {
+			return browseEdit
+		}
+	case "r":
+		return browseReload
+	}
+	return browseNone
+}
+
+func (b *Browser) incremental() {
+
+	if b.search == "" {
+		b.move(b.before)
+		return
+	}
+	m := b.matches()
+	if len(m) == 0 {
+		b.message = "No match."
+		return
+	}
+	for _, i := range m {
+		if i >= b.before {
+			b.move(i)
+			return
+		}
+	}
+	b.move(m[0])
+}
+
+// Reload replaces the knowledge base and keeps the selection if the Thing
+// is still around.
+func (b *Browser) Reload(kb *util.KnowledgeBase) {
+
+	var location string
+	if ct := b.Current(); ct != nil {
+		location = ct.Location()
+	}
+	b.history = nil
+	b.load(kb)
+	for i, it := range b.items {
+		if it.thing.Location() == location {
+			b.selected = i
+			break
+		}
+	}
+}
+
+// The lines of the right pane, and which one shows the selected link.
+func (b *Browser) details() ([]string, int) {
+
+	ct := b.Current()
+	if ct == nil {
+		return []string{"The knowledge base is empty."}, -1
+	}
+	lines := []string{browseTitle(ct)}
+	if ct.Id.Uuid != "" {
+		lines = append(lines, "uuid: "+ct.Id.Uuid)
+	}
+	if ct.Id.Version != "" {
+		lines = append(lines, "version: "+ct.Id.Version)
+	}
+	for _, s := range []struct {
+		name string
+		data interface{}
+		show bool
+	}{
+		{"parameter", ct.Parameter, len(ct.Parameter) > 0},
+		{"behavior", ct.Behavior, len(ct.Behavior) > 0},
+		{"legal", ct.Legal, len(ct.Legal.Author)+len(ct.Legal.Reference)+len(ct.Legal.License) > 0},
+	} {
+		if !s.show {
+			continue
+		}
+		y, err := util.Marshal(s.data)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, "", s.name+":")
+		for _, l := range strings.Split(strings.TrimRight(string(y), "\n"), "\n") {
+			lines = append(lines, "  "+l)
+		}
+	}
+	ls := b.links()
+	selected := -1
+	if len(ls) > 0 {
+		lines = append(lines, "", "relations and backlinks:")
+		for i, l := range ls {
+			if i == b.link {
+				selected = len(lines)
+			}
+			lines = append(lines, "  "+l.label)
+		}
+	}
+	return lines, selected
+}
+
+/*
+	Render
+	  args
+		width, height	the size of the screen
+	  returns
+		[]string		one line per row, the last one being the status
+						line, the selected entries are highlighted with
+						ANSI reverse video
+*/
+func (b *Browser) Render(width int, height int) []string {
+
+	if height < 2 {
+		height = 2
+	}
+	rows := height - 1
+	left := width / 3
+	if left < 20 {
+		left = 20
+	}
+	if left > width-10 {
+		left = width / 2
+	}
+	right := width - left - 1
+
+	if b.selected < b.treeTop {
+		b.treeTop = b.selected
+	}
+	if b.selected >= b.treeTop+rows {
+		b.treeTop = b.selected - rows + 1
+	}
+	details, selected := b.details()
+	if selected >= 0 {
+		if selected < b.detailTop {
+			b.detailTop = selected
+		}
+		if selected >= b.detailTop+rows {
+			b.detailTop = selected - rows + 1
+		}
+	}
+
+	var screen []string
+	for r := 0; r < rows; r++ {
+		var l, d string
+		i := b.treeTop + r
+		if i < len(b.items) {
+			it := b.items[i]
+			l = fitText(strings.Repeat("  ", it.depth)+browseLabel(it.thing), left)
+			if i == b.selected {
+				l = "\x1b[7m" + l + "\x1b[0m"
+			}
+		} else {
+			l = fitText("", left)
+		}
+		j := b.detailTop + r
+		if j < len(details) {
+			d = fitText(details[j], right)
+			if j == selected {
+				d = "\x1b[7m" + d + "\x1b[0m"
+			}
+		}
+		screen = append(screen, l+"│"+d)
+	}
+	status := b.message
+	if b.searching {
+		status = "/" + b.search
+	} else if status == "" {
+		status = "q quit  / search  tab relation  enter follow  b back  e edit  r reload"
+	}
+	return append(screen, fitText(status, width))
+}
+
+func browseLabel(ct *util.ContextThing) string {
+	if ct.Id.Name != "" {
+		return ct.Id.Name
+	}
+	return ct.Location()
+}
+
+// Cut or pad the text to exactly the width, tabs count as one.
+func fitText(s string, width int) string {
+
+	if width < 1 {
+		return ""
+	}
+	r := []rune(strings.ReplaceAll(s, "\t", " "))
+	if len(r) > width {
+		return string(r[:width-1]) + "…"
+	}
+	return string(r) + strings.Repeat(" ", width-len(r))
+}
+
+/*
+	Run
+	  args
+		in			the terminal to read the keys from
+		out			where to draw the screen
+		edit		edits the Thing, the terminal is reset meanwhile
+		reload		loads the knowledge base again after editing or
+					on request
+*/
+func (b *Browser) Run(in *os.File, out io.Writer, edit func(*util.ContextThing), reload func() (*util.KnowledgeBase, error)) error {
+
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("The input is not a terminal.\n")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, state)
+	}()
+
+	buf := make([]byte, 64)
+	for {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		fmt.Fprint(out, "\x1b[H"+strings.Join(b.Render(width, height), "\x1b[K\r\n")+"\x1b[K")
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		switch b.HandleKey(string(buf[:n])) {
+		case browseQuit:
+			return nil
+		case browseEdit:
+			fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+			term.Restore(fd, state)
+			edit(b.Current())
+			state, err = term.MakeRaw(fd)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(out, "\x1b[?1049h\x1b[?25l\x1b[2J")
+			fallthrough
+		case browseReload:
+			kb, err := reload()
+			if err != nil {
+				b.message = fmt.Sprintf("Could not reload: %s", strings.TrimSpace(err.Error()))
+			} else {
+				b.Reload(kb)
+				b.message = "Reloaded."
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// Test the basics...
+func TestExecuteBrowseHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "browse"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"browse", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestBrowser(t *testing.T) {
+
+	kb, err := util.LoadKnowledgeBase("file://" + serveTestContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBrowser(kb)
+	if b.Current().Id.Name != "server" {
+		t.Fatalf("Expected the category on top, got %s.\n", b.Current().Location())
+	}
+	b.HandleKey("j")
+	if b.Current().Id.Name != "web" {
+		t.Fatalf("Expected the member below the category, got %s.\n", b.Current().Location())
+	}
+	screen := strings.Join(b.Render(80, 20), "\n")
+	for _, e := range []string{"  web", "port: 80", "is: server (categories/server.yml)"} {
+		if !strings.Contains(screen, e) {
+			t.Fatalf("Expected '%s' on the screen:\n%s", e, screen)
+		}
+	}
+
+	// follow the relation and come back
+	b.HandleKey("\r")
+	if b.Current().Id.Name != "server" {
+		t.Fatalf("Expected to follow the relation, got %s.\n", b.Current().Location())
+	}
+	screen = strings.Join(b.Render(80, 20), "\n")
+	if !strings.Contains(screen, "<- web (web.yml)") {
+		t.Fatalf("Expected the backlink on the screen:\n%s", screen)
+	}
+	b.HandleKey("b")
+	if b.Current().Id.Name != "web" {
+		t.Fatalf("Expected to go back, got %s.\n", b.Current().Location())
+	}
+
+	// search incrementally, then cancel
+	b.HandleKey("/")
+	for _, k := range []string{"e", "i", "g", "h"} {
+		b.HandleKey(k)
+	}
+	if b.Current().Id.Name != "webcache" {
+		t.Fatalf("Expected to find webcache, got %s.\n", b.Current().Location())
+	}
+	if !strings.Contains(strings.Join(b.Render(80, 20), "\n"), "/eigh") {
+		t.Fatal("Expected the search on the status line.")
+	}
+	b.HandleKey("\x1b")
+	if b.Current().Id.Name != "web" {
+		t.Fatalf("Expected to return on cancel, got %s.\n", b.Current().Location())
+	}
+
+	if b.HandleKey("e") != browseEdit || b.HandleKey("q") != browseQuit {
+		t.Fatal("Expected the edit and quit keys to be passed on.")
+	}
+	b.Reload(kb)
+	if b.Current().Id.Name != "web" {
+		t.Fatalf("Expected to keep the selection on reload, got %s.\n", b.Current().Location())
+	}
+	t.Log("Now failing successfully (not a terminal):")
+	if b.Run(nil, io.Discard, nil, nil) == nil {
+		t.Fatal("Expected to need a terminal.")
+	}
+}
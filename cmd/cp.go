@@ -0,0 +1,76 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// cpCmd represents the cp command
+var cpCmd = &cobra.Command{
+	Use:   "cp SRC DST",
+	Short: "Derive a new Thing from an existing one",
+	Long: `Copy a Thing to a new file as a Thing of its own: it gets a new UUID, the
+version and the URLs of the original are dropped, everything else is kept,
+including the comments. The authors are kept too and the new author is added
+with the date, by default the name git uses in the context.
+
+SRC is given by path, UUID, name or name prefix. DST is a path relative to the
+context, or a directory to copy the file into, if it exists or ends with '/'.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("derived", cmd.PersistentFlags().Lookup("derived"))
+		derived := viper.GetBool("derived")
+
+		viper.BindPFlag("author", cmd.PersistentFlags().Lookup("author"))
+		author := viper.GetString("author")
+
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the context: %s.\n", e)
+		}
+		ct, e := kb.Resolve(args[0])
+		if e != nil {
+			log.Fatalf("Could not find the Thing: %s\n", e)
+		}
+		to, e := thingTarget(kb, ct, args[1])
+		if e != nil {
+			log.Fatalf("Could not copy the Thing to '%s': %s\n", args[1], e)
+		}
+		if author == "" {
+			author = util.GitUserName(kb.ContextPath)
+		}
+		t, e := kb.CopyThing(ct, to, derived, author, time.Now().Format("2006-01-02"))
+		if e != nil {
+			log.Fatalf("Could not copy the Thing: %s\n", e)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Copied %s -> %s (%s)\n", ct.Location(), to, t.Id.Uuid)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+
+	cpCmd.PersistentFlags().BoolP("derived", "d", false, "add a 'derived_from' relation to the original")
+	cpCmd.PersistentFlags().StringP("author", "a", "", "the new author, by default the git user name")
+}
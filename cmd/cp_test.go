@@ -0,0 +1,86 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// Test the basics...
+func TestExecuteCpHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "cp"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"cp", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestExecuteCp(t *testing.T) {
+	d := serveTestContext(t)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"cp", "--help=false", "-c", "file://" + d, "-d", "-a", "Bob", "web", "web3.yml"})
+	rootCmd.Execute()
+	if !strings.HasPrefix(a.String(), "Copied web.yml -> web3.yml (urn:uuid:") {
+		t.Fatalf("Unexpected output ...\n%s", a.String())
+	}
+	b, e := os.ReadFile(filepath.Join(d, "web3.yml"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, c := range []string{"  name: web\n", "  - thing_url: web.yml\n    kind: derived_from\n", "legal:\n  author:\n    - name: Bob\n"} {
+		if !strings.Contains(string(b), c) {
+			t.Fatalf("Expected '%s' in ...\n%s", c, b)
+		}
+	}
+	if strings.Contains(string(b), "urn:uuid:2222") {
+		t.Fatalf("Expected a new UUID ...\n%s", b)
+	}
+}
+
+func TestThingTarget(t *testing.T) {
+	d := serveTestContext(t)
+	kb, _ := util.LoadKnowledgeBase("file://" + d)
+	ct, _ := kb.Resolve("web")
+	a, e := thingTarget(kb, ct, "categories/")
+	if e != nil || a != filepath.Join("categories", "web.yml") {
+		t.Fatalf("Expected the file name to be kept in the directory: %s %v", a, e)
+	}
+	t.Log("Now failing successfully (outside the context):")
+	for _, b := range []string{"../../etc/x.yml", filepath.Dir(d) + "/x.yml"} {
+		if _, e = thingTarget(kb, ct, b); e == nil {
+			t.Fatalf("Expected '%s' to be refused.", b)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff A B",
+	Short: "Compare two Things",
+	Long: `Compare two Things field by field: the id, the targets, the relations
+(matched by their thing_url and kind), the parameters, the behaviors and the
+legal information. A Thing is given by path, UUID, name or name prefix, and
+'THING@REV' takes it as of a git revision, e.g. 'web@HEAD~1'.
+
+The output lists the changes from A to B, or with '--output json-patch' a
+JSON patch (RFC 6902) turning the JSON form of A into B.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("output", cmd.PersistentFlags().Lookup("output"))
+		output := viper.GetString("output")
+
+		a, e := loadDiffThing(args[0], context)
+		if e != nil {
+			log.Fatalf("Could not read '%s': %s\n", args[0], e)
+		}
+		b, e := loadDiffThing(args[1], context)
+		if e != nil {
+			log.Fatalf("Could not read '%s': %s\n", args[1], e)
+		}
+		e = WriteDiff(cmd.OutOrStdout(), a, b, output)
+		if e != nil {
+			log.Fatalf("Could not compare the Things: %s.\n", e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.PersistentFlags().StringP("output", "o", "text", "the output format: text, json or json-patch")
+}
+
+// The Thing as written in its file, a generated UUID would always differ.
+func readStoredThing(location string) (util.Thing, error) {
+
+	var t util.Thing
+	documents, err := util.ReadThingDocumentsFromLocation(location)
+	if err != nil {
+		return t, err
+	}
+	if len(documents) != 1 {
+		return t, fmt.Errorf("The file has %d documents, please select one with '#'.\n", len(documents))
+	}
+	err = util.Unmarshal(documents[0], &t)
+	return t, err
+}
+
+// A reference, optionally followed by '@' and a git revision.
+func loadDiffThing(ref string, context string) (util.Thing, error) {
+
+	location, err := util.ResolveThingLocation(ref, context, false)
+	if err == nil {
+		return readStoredThing(location)
+	}
+	i := strings.LastIndex(ref, "@")
+	if i < 0 {
+		return util.Thing{}, err
+	}
+	location, err = util.ResolveThingLocation(ref[:i], context, false)
+	if err != nil {
+		return util.Thing{}, err
+	}
+	t, err := util.ThingAt(location, storedUuid(location), ref[i+1:])
+	if err != nil {
+		return util.Thing{}, err
+	}
+	return *t, nil
+}
+
+func WriteDiff(w io.Writer, a util.Thing, b util.Thing, output string) error {
+
+	var data interface{}
+	var err error
+	switch output {
+	case "text":
+		changes, err := util.DiffThings(a, b)
+		if err != nil {
+			return err
+		}
+		WriteChanges(w, changes, "")
+		return nil
+	case "json":
+		data, err = util.DiffThings(a, b)
+	case "json-patch":
+		data, err = util.ThingJSONPatch(a, b)
+	default:
+		return fmt.Errorf("Unknown output format '%s', use one of: text, json, json-patch", output)
+	}
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
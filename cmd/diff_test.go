@@ -0,0 +1,67 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteDiffHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "diff"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"diff", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestExecuteDiff(t *testing.T) {
+	d := serveTestContext(t)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"diff", "--help=false", "-c", "file://" + d, "web", "webcache"})
+	rootCmd.Execute()
+	b := `~ id.name: "web" -> "webcache"
+- id.uuid: "urn:uuid:2222"
+~ parameter.port: 80 -> "eighty"
+- parameter.software: "nginx"
+- relation['is:categories/server.yml']: {"thing_url":"categories/server.yml"}
+`
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+	a.Reset()
+	rootCmd.SetArgs([]string{"diff", "--help=false", "-c", "file://" + d, "-o", "json-patch", "web", "web"})
+	rootCmd.Execute()
+	if strings.TrimSpace(a.String()) != "[]" {
+		t.Fatalf("Expected an empty patch, got %s", a.String())
+	}
+}
@@ -13,17 +13,31 @@ Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gitlab.com/zwischenloesung/natem/util"
 )
 
-func EditThing(editor string, thing string, context string, isContextless bool) {
+func EditThing(editor string, thing string, context string, isContextless bool, schema string, create bool, template string, section string) {
 
+	resolved, err := util.ResolveThingLocation(thing, context, !isContextless)
+	if err == nil {
+		thing = resolved
+	} else if err != util.UrlThingOutsideContextError && (!create || !errors.Is(err, util.ThingNotFoundError)) {
+		fmt.Println("Could not find the Thing.\n", err)
+		return
+	}
+	thing, fragment := util.SplitThingFragment(thing)
 	filePath, err := util.GetThingURLPath(thing, context, !isContextless)
 
 	if err == util.UrlThingOutsideContextError {
@@ -38,15 +52,249 @@ func EditThing(editor string, thing string, context string, isContextless bool)
 		editor, _ = os.LookupEnv("EDITOR")
 	}
 
+	_, err = os.Stat(filePath)
+	if section != "" {
+		if fragment != "" {
+			filePath += "#" + fragment
+		}
+		err = EditThingSection(editor, filePath, section, context, schema, os.Stdin, os.Stdout)
+	} else if os.IsNotExist(err) {
+		if !create {
+			fmt.Println("Use the --create switch to create a Thing that does not exist yet:", filePath)
+			return
+		}
+		var seed []byte
+		seed, err = NewThingSeed(template, context)
+		if err != nil {
+			fmt.Println("Could not prepare the new Thing.\n", err)
+			return
+		}
+		err = EditNewThingFile(editor, seed, thing, context, !isContextless, schema, os.Stdin, os.Stdout)
+	} else {
+		err = EditThingFile(editor, filePath, context, schema, os.Stdin, os.Stdout)
+	}
+	if err != nil {
+		fmt.Println("An error occurred.\n", err)
+	}
+}
+
+// NewThingSeed returns the initial content for a new Thing, either a fresh
+// Thing or a template with a fresh UUID.
+func NewThingSeed(template string, context string) ([]byte, error) {
+
+	if template == "" {
+		b, err := util.SerializeThing(util.NewThing())
+		if err != nil {
+			return nil, err
+		}
+		return util.JoinYAMLDocuments([][]byte{b}), nil
+	}
+	templatePath, err := util.GetThingURLPath(template, context, false)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := util.ReadThingDocumentFromFile(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	t := doc.Thing
+	t.GenId()
+	err = doc.Update(&t)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Bytes()
+}
+
+// EditThingFile lets the user edit a temporary copy of the file and only
+// replaces the original once the copy validates, or the user insists.
+func EditThingFile(editor string, filePath string, context string, schema string, in io.Reader, out io.Writer) error {
+
+	original, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return editCopy(editor, filepath.Ext(filePath), original, false, in, out,
+		func(tmpPath string) error {
+			return checkEditedThing(tmpPath, context, schema)
+		},
+		func(tmpPath string) error {
+			edited, err := os.ReadFile(tmpPath)
+			if err != nil {
+				return err
+			}
+			return util.ReplaceFile(filePath, edited)
+		})
+}
+
+// EditNewThingFile lets the user edit the seed of a new Thing and creates
+// it the same way CreateNewThingFile does. Nothing is written if the user
+// empties the buffer.
+func EditNewThingFile(editor string, seed []byte, url string, context string, hasContext bool, schema string, in io.Reader, out io.Writer) error {
+
+	return editCopy(editor, filepath.Ext(url), seed, true, in, out,
+		func(tmpPath string) error {
+			return checkEditedThing(tmpPath, context, schema)
+		},
+		func(tmpPath string) error {
+			documents, err := util.ReadYAMLDocumentsFromFile(tmpPath)
+			if err != nil {
+				return err
+			}
+			_, err = util.CreateThingFileFromDocuments(documents, url, context, hasContext)
+			return err
+		})
+}
+
+// EditThingSection lets the user edit only one top-level section of a
+// Thing and merges it back, the rest of the file stays as it is.
+func EditThingSection(editor string, location string, section string, context string, schema string, in io.Reader, out io.Writer) error {
+
+	if !util.IsThingSection(section) {
+		return fmt.Errorf("Unknown section '%s', use one of: %s.", section, strings.Join(util.ThingSections, ", "))
+	}
+	filePath, fragment := util.SplitThingFragment(location)
+	original, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	content, err := util.GetThingSection(original, fragment, section)
+	if err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		content = []byte(section + ":\n")
+	}
+	merge := func(tmpPath string) ([]byte, error) {
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return nil, err
+		}
+		return util.ReplaceThingSection(original, fragment, section, edited)
+	}
+	return editCopy(editor, ".yml", content, false, in, out,
+		func(tmpPath string) error {
+			merged, err := merge(tmpPath)
+			if err != nil {
+				return err
+			}
+			return checkThingDocuments(util.SplitYAMLDocuments(merged), context, schema)
+		},
+		func(tmpPath string) error {
+			merged, err := merge(tmpPath)
+			if err != nil {
+				return err
+			}
+			return util.ReplaceFile(filePath, merged)
+		})
+}
+
+// Run the editor on a temporary copy of the content until the copy
+// validates or the user decides what to do with it, then save it.
+func editCopy(editor string, ext string, content []byte, isNew bool, in io.Reader, out io.Writer, check func(string) error, save func(string) error) error {
+
+	tmp, err := os.CreateTemp("", "natem-*"+ext)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	answers := bufio.NewReader(in)
+	for {
+		err = runEditor(editor, tmp.Name())
+		if err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return err
+		}
+		if isNew && len(bytes.TrimSpace(edited)) == 0 {
+			fmt.Fprintln(out, "The buffer was empty, nothing was created.")
+			return nil
+		} else if !isNew && bytes.Equal(content, edited) {
+			return nil
+		}
+		err = check(tmp.Name())
+		if err == nil {
+			return save(tmp.Name())
+		}
+		fmt.Fprintln(out, "The edited Thing is not valid:", err)
+		for {
+			fmt.Fprint(out, "(r)e-edit, (d)iscard or (f)orce-save? ")
+			answer, err := answers.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if answer == "r" {
+				break
+			} else if answer == "d" || (err != nil && answer == "") {
+				fmt.Fprintln(out, "Discarded the changes.")
+				return nil
+			} else if answer == "f" {
+				return save(tmp.Name())
+			}
+		}
+	}
+}
+
+func runEditor(editor string, filePath string) error {
+
 	cmd := exec.Command(editor, filePath)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	err = cmd.Run()
+	return cmd.Run()
+}
+
+// The Thing must parse and validate against its own schema, or the one
+// provided as fall-back.
+func checkEditedThing(filePath string, context string, schema string) error {
+
+	documents, err := util.ReadYAMLDocumentsFromFile(filePath)
 	if err != nil {
-		fmt.Println("An error occurred.\n", err)
+		return err
+	}
+	return checkThingDocuments(documents, context, schema)
+}
+
+func checkThingDocuments(documents [][]byte, context string, schema string) error {
+
+	for _, d := range documents {
+		t, err := util.ParseThing(d)
+		if err != nil {
+			return err
+		}
+		schemaPath, err := util.GetThingSchemaPath(&t, context)
+		if err != nil {
+			return err
+		}
+		if schemaPath == "" && schema != "" {
+			schemaPath, err = util.GetThingURLPath(schema, context, false)
+			if err != nil {
+				return err
+			}
+		}
+		if schemaPath == "" {
+			continue
+		}
+		schemaBytes, err := util.ReadYAMLDocumentFromFile(schemaPath)
+		if err != nil {
+			return err
+		}
+		r, err := util.ValidateThing(schemaBytes, d)
+		if err != nil {
+			return err
+		}
+		if !r {
+			return fmt.Errorf("The document failed to validate against the schema %s.", schemaPath)
+		}
 	}
+	return nil
 }
 
 // editCmd represents the edit command
@@ -55,7 +303,9 @@ var editCmd = &cobra.Command{
 	Short: "Open a Thing in an editor",
 	Long: `Open an editor and edit the information stored in a Thing of the
 knowledge base. The focus here lies on the content and behaviour of the
-Things.`,
+Things. The editor works on a copy, which is validated against the schema
+of the Thing once the editor exits. The original is only replaced after
+the copy validated or the user forced it.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
@@ -70,7 +320,19 @@ Things.`,
 		viper.BindPFlag("context-less", cmd.PersistentFlags().Lookup("context-less"))
 		isContextless := viper.GetBool("context-less")
 
-		EditThing(editor, thing, context, isContextless)
+		viper.BindPFlag("schema", cmd.PersistentFlags().Lookup("schema"))
+		schema := viper.GetString("schema")
+
+		viper.BindPFlag("create", cmd.PersistentFlags().Lookup("create"))
+		create := viper.GetBool("create")
+
+		viper.BindPFlag("template", cmd.PersistentFlags().Lookup("template"))
+		template := viper.GetString("template")
+
+		viper.BindPFlag("section", cmd.PersistentFlags().Lookup("section"))
+		section := viper.GetString("section")
+
+		EditThing(editor, thing, context, isContextless, schema, create, template, section)
 	},
 }
 
@@ -83,10 +345,14 @@ func init() {
 	// and all subcommands, e.g.:
 	// editCmd.PersistentFlags().String("foo", "", "A help for foo")
 
-	editCmd.PersistentFlags().StringP("thing", "t", "", "summarize the info for this thing")
+	editCmd.PersistentFlags().StringP("thing", "t", "", "the thing to edit: a path, UUID, name or name prefix")
 	editCmd.MarkPersistentFlagRequired("thing")
 	editCmd.PersistentFlags().String("editor", "", "specify the editor of choice (default: Environment Variable $EDITOR)")
 	editCmd.PersistentFlags().BoolP("context-less", "C", false, "edit a thing outside of any context")
+	editCmd.PersistentFlags().StringP("schema", "s", "", "the schema to validate against if the thing does not name one")
+	editCmd.PersistentFlags().Bool("create", false, "create the thing if it does not exist yet")
+	editCmd.PersistentFlags().String("template", "", "the thing to start from when creating a new thing (default: an empty thing)")
+	editCmd.PersistentFlags().String("section", "", "only edit this section of the thing: "+strings.Join(util.ThingSections, "|"))
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
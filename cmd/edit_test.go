@@ -16,9 +16,13 @@ package cmd
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"gitlab.com/zwischenloesung/natem/util"
 )
 
 func init() {
@@ -75,3 +79,159 @@ func TestExecuteEditOptions(t *testing.T) {
 		t.Fatal("The edit command should have failed as the required -t was missing in one call.")
 	}
 }
+
+// Create an 'editor' that replaces the file with the content given.
+func fakeEditor(t *testing.T, dir string, content string) string {
+	e := filepath.Join(dir, "editor.sh")
+	script := "#!/bin/sh\ncat > \"$1\" <<'EOF'\n" + content + "EOF\n"
+	err := os.WriteFile(e, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestEditThingFile(t *testing.T) {
+	d := t.TempDir()
+	s := filepath.Join(d, "schema.yml")
+	os.WriteFile(s, []byte("---\ntype: object\nproperties:\n  id:\n    type: object\n    properties:\n      version:\n        type: string\n"), 0644)
+	a := filepath.Join(d, "thing.yml")
+	original := "---\nid:\n  version: \"0.1\"\n"
+	os.WriteFile(a, []byte(original), 0644)
+	out := bytes.NewBufferString("")
+
+	e := fakeEditor(t, d, "---\nid:\n  version: \"0.2\"\n")
+	err := EditThingFile(e, a, "file://"+d, s, strings.NewReader(""), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(a)
+	if !strings.Contains(string(b), "0.2") {
+		t.Fatalf("The valid change should have been saved, got: %s", string(b))
+	}
+
+	t.Log("Now failing successfully (invalid content is discarded):")
+	os.WriteFile(a, []byte(original), 0644)
+	e = fakeEditor(t, d, "---\nid:\n  version: 2\n")
+	err = EditThingFile(e, a, "file://"+d, s, strings.NewReader("x\nd\n"), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(a)
+	if string(b) != original {
+		t.Fatalf("The invalid change should have been discarded, got: %s", string(b))
+	}
+	if !strings.Contains(out.String(), "(r)e-edit") {
+		t.Fatalf("The user should have been asked what to do, got: %s", out.String())
+	}
+
+	err = EditThingFile(e, a, "file://"+d, s, strings.NewReader("f\n"), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = os.ReadFile(a)
+	if !strings.Contains(string(b), "version: 2") {
+		t.Fatalf("The invalid change should have been forced, got: %s", string(b))
+	}
+
+	os.Chmod(a, 0600)
+	e = fakeEditor(t, d, "---\nid:\n  version: \"0.3\"\n")
+	err = EditThingFile(e, a, "file://"+d, s, strings.NewReader(""), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(a); fi.Mode().Perm() != 0600 {
+		t.Fatalf("The permissions should have been kept, got: %s", fi.Mode())
+	}
+}
+
+func TestEditNewThingFile(t *testing.T) {
+	d := t.TempDir()
+	out := bytes.NewBufferString("")
+	seed, err := NewThingSeed("", "file://"+d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(seed), "uuid: urn:uuid:") {
+		t.Fatalf("The seed should contain a fresh UUID, got: %s", string(seed))
+	}
+
+	e := fakeEditor(t, d, "---\n# a new one\nid:\n  name: new\n")
+	err = EditNewThingFile(e, seed, "sub/new.yml", "file://"+d, true, "", strings.NewReader(""), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(d, "sub", "new.yml"))
+	if err != nil {
+		t.Fatalf("The new Thing should have been created: %s", err)
+	}
+	if !strings.Contains(string(b), "# a new one") || !strings.Contains(string(b), "uuid: urn:uuid:") {
+		t.Fatalf("The new Thing should have kept the comment and got an UUID, got: %s", string(b))
+	}
+
+	t.Log("Now failing successfully (empty buffer):")
+	e = fakeEditor(t, d, "\n")
+	err = EditNewThingFile(e, seed, "empty.yml", "file://"+d, true, "", strings.NewReader(""), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(d, "empty.yml"))
+	if !os.IsNotExist(err) {
+		t.Fatal("Nothing should have been written for an empty buffer.")
+	}
+
+	seed, err = NewThingSeed("sub/new.yml", "file://"+d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := util.ParseThing(b)
+	f, _ := util.ParseThing(seed)
+	if f.Id.Name != "new" || f.Id.Uuid == c.Id.Uuid {
+		t.Fatalf("The template should have been used with a fresh UUID, got: %s", string(seed))
+	}
+}
+
+func TestEditThingCreate(t *testing.T) {
+	d := t.TempDir()
+	e := fakeEditor(t, d, "---\nid:\n  name: new\n")
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	EditThing(e, "new.yml", "file://"+d, false, "", true, "", "")
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if strings.Contains(string(out), "error") {
+		t.Fatalf("No error should have been reported, got: %s", string(out))
+	}
+	if _, err = os.Stat(filepath.Join(d, "new.yml")); err != nil {
+		t.Fatalf("The new Thing should have been created: %s", err)
+	}
+}
+
+func TestEditThingSection(t *testing.T) {
+	d := t.TempDir()
+	a := filepath.Join(d, "thing.yml")
+	original := "---\n# keep me\nid:\n  name: \"sectioned\"\nparameter:\n  port: 80\nlegal: {}\n"
+	os.WriteFile(a, []byte(original), 0644)
+	out := bytes.NewBufferString("")
+
+	e := fakeEditor(t, d, "parameter:\n  port: 8080\n")
+	err := EditThingSection(e, a, "parameter", "file://"+d, "", strings.NewReader(""), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(a)
+	if string(b) != strings.Replace(original, "80", "8080", 1) {
+		t.Fatalf("Only the parameters should have changed, got: %s", string(b))
+	}
+
+	t.Log("Now failing successfully (unknown section):")
+	err = EditThingSection(e, a, "id", "file://"+d, "", strings.NewReader(""), out)
+	if err == nil {
+		t.Fatal("Only the known sections can be edited.")
+	}
+}
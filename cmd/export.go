@@ -0,0 +1,244 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the Things to other formats",
+}
+
+// exportMarkdownCmd represents the export markdown command
+var exportMarkdownCmd = &cobra.Command{
+	Use:   "markdown",
+	Short: "Export the Things as Markdown notes with front matter",
+	Long: `Write a Markdown file per Thing, to be read by note apps like Obsidian or
+by static site generators like Hugo. The front matter holds the id, the simple
+parameters and the relations as wiki-links named by their kind, e.g.
+'is: "[[categories/server]]"'. The parameter 'body' becomes the body, followed
+by sections for the other parameters, the behaviors and the legal information.
+The Thing 'a/b.yml' is written to 'a/b.md', its second document to 'a/b-2.md';
+nothing is written if two Things would get the same note. See also 'import
+markdown'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		out := viper.GetString("out")
+
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		for _, e := range kb.Errors {
+			log.Printf("Skipping: %s\n", e)
+		}
+		written, e := kb.ExportMarkdown(out)
+		if e != nil {
+			log.Fatalf("Could not export the Things: %s.\n", e)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Exported %d Things.\n", len(written))
+	},
+}
+
+// exportCsvCmd represents the export csv command
+var exportCsvCmd = &cobra.Command{
+	Use:   "csv",
+	Short: "Export the parameters of the Things as table",
+	Long: `Write a table with a row per Thing: the location, the UUID and the name,
+followed by a column per parameter, nested ones flattened to their path, e.g.
+'network.interfaces[0].ip'. With '--category' only the Things that are the
+category, directly or through others, are written. See also 'import csv'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("category", cmd.PersistentFlags().Lookup("category"))
+		category := viper.GetString("category")
+
+		viper.BindPFlag("format", cmd.PersistentFlags().Lookup("format"))
+		format := viper.GetString("format")
+
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		out := viper.GetString("out")
+
+		comma, e := csvComma(format, out)
+		if e != nil {
+			log.Fatalf("Could not export the Things: %s.\n", e)
+		}
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		for _, e := range kb.Errors {
+			log.Printf("Skipping: %s\n", e)
+		}
+		things := kb.SortedThings()
+		if category != "" {
+			ct, e := kb.Resolve(category)
+			if e != nil {
+				log.Fatalf("Could not find the category: %s\n", e)
+			}
+			things = kb.Descendants(ct)
+			sort.SliceStable(things, func(i, j int) bool {
+				return things[i].Location() < things[j].Location()
+			})
+		}
+		w := cmd.OutOrStdout()
+		if out != "" {
+			f, e := os.Create(out)
+			if e != nil {
+				log.Fatalf("Could not create the file: %s.\n", e)
+			}
+			defer f.Close()
+			w = f
+		}
+		e = util.ExportCSV(w, things, comma)
+		if e != nil {
+			log.Fatalf("Could not export the Things: %s.\n", e)
+		}
+	},
+}
+
+// exportRdfCmd represents the export rdf command
+var exportRdfCmd = &cobra.Command{
+	Use:   "rdf",
+	Short: "Export the knowledge graph as RDF",
+	Long: `Write the Things as RDF in Turtle, N-Triples or JSON-LD. Every Thing is a
+resource named by the URN of its UUID. The relations become predicates named
+by their kind, the parameters literals named by their path, e.g.
+'param:network.ip', and the name, version, URLs and legal information are
+mapped to Dublin Core terms.
+
+The mapping can be changed with '--mapping', a YAML file with any of:
+
+  prefixes:         # prefix: namespace, also used to shorten the output
+    schema: https://schema.org/
+  terms:            # title, version, url, location, author, reference, license
+    author: schema:author
+  relation_base: rel:
+  relations:        # kind: predicate
+    is: http://www.w3.org/1999/02/22-rdf-syntax-ns#type
+  parameter_base: param:
+  parameters:       # path: predicate
+    network.ip: schema:ipAddress`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("category", cmd.PersistentFlags().Lookup("category"))
+		category := viper.GetString("category")
+
+		viper.BindPFlag("format", cmd.PersistentFlags().Lookup("format"))
+		format := viper.GetString("format")
+
+		viper.BindPFlag("mapping", cmd.PersistentFlags().Lookup("mapping"))
+		mappingFile := viper.GetString("mapping")
+
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		out := viper.GetString("out")
+
+		mapping := util.DefaultRDFMapping()
+		if mappingFile != "" {
+			m, e := util.ReadRDFMapping(mappingFile)
+			if e != nil {
+				log.Fatalf("Could not read the mapping: %s.\n", e)
+			}
+			mapping = m
+		}
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		for _, e := range kb.Errors {
+			log.Printf("Skipping: %s\n", e)
+		}
+		things := kb.SortedThings()
+		if category != "" {
+			ct, e := kb.Resolve(category)
+			if e != nil {
+				log.Fatalf("Could not find the category: %s\n", e)
+			}
+			things = kb.Descendants(ct)
+			sort.SliceStable(things, func(i, j int) bool {
+				return things[i].Location() < things[j].Location()
+			})
+		}
+		w := cmd.OutOrStdout()
+		if out != "" {
+			f, e := os.Create(out)
+			if e != nil {
+				log.Fatalf("Could not create the file: %s.\n", e)
+			}
+			defer f.Close()
+			w = f
+		}
+		e = mapping.WriteRDF(w, kb, things, format)
+		if e != nil {
+			log.Fatalf("Could not export the Things: %s.\n", e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.AddCommand(exportMarkdownCmd)
+	exportCmd.AddCommand(exportCsvCmd)
+	exportCmd.AddCommand(exportRdfCmd)
+
+	exportMarkdownCmd.PersistentFlags().String("out", "notes", "the directory to write the notes to")
+
+	exportCsvCmd.PersistentFlags().StringP("category", "g", "", "only the Things that are this Thing, directly or through others")
+	exportCsvCmd.PersistentFlags().StringP("format", "f", "", "csv or tsv, by default by the extension of the file or csv")
+	exportCsvCmd.PersistentFlags().StringP("out", "o", "", "the file to write to, instead of the standard output")
+
+	exportRdfCmd.PersistentFlags().StringP("category", "g", "", "only the Things that are this Thing, directly or through others")
+	exportRdfCmd.PersistentFlags().StringP("format", "f", "turtle", "turtle, ntriples or jsonld")
+	exportRdfCmd.PersistentFlags().StringP("mapping", "m", "", "a YAML file to change the mapping to RDF with")
+	exportRdfCmd.PersistentFlags().StringP("out", "o", "", "the file to write to, instead of the standard output")
+}
+
+// The separator of the format, or of the extension of the file if none
+// is given.
+func csvComma(format string, file string) (rune, error) {
+
+	if format == "" {
+		format = "csv"
+		if strings.HasSuffix(file, ".tsv") {
+			format = "tsv"
+		}
+	}
+	switch format {
+	case "csv":
+		return ',', nil
+	case "tsv":
+		return '\t', nil
+	}
+	return 0, fmt.Errorf("Unknown format '%s', use one of: csv, tsv", format)
+}
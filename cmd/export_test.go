@@ -0,0 +1,121 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteExportMarkdownHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "export", "markdown"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"export", "markdown", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestExecuteExportMarkdown(t *testing.T) {
+	d := serveTestContext(t)
+	c := t.TempDir()
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"export", "markdown", "--help=false", "-c", "file://" + d, "--out", c})
+	rootCmd.Execute()
+	if a.String() != "Exported 4 Things.\n" {
+		t.Fatalf("Unexpected output ...\n%s", a.String())
+	}
+	b, e := os.ReadFile(filepath.Join(c, "web.md"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(string(b), "is: '[[categories/server]]'\n") {
+		t.Fatalf("Expected the relation as wiki-link in ...\n%s", b)
+	}
+}
+
+func TestExecuteExportCsvHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "export", "csv"})
+	rootCmd.Execute()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"export", "csv", "--help"})
+	rootCmd.Execute()
+	if a.String() != b.String() {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", a.String(), b.String())
+	}
+}
+
+func TestExecuteExportCsv(t *testing.T) {
+	d := serveTestContext(t)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"export", "csv", "--help=false", "-c", "file://" + d, "-g", "server", "-f", "tsv", "-o", ""})
+	rootCmd.Execute()
+	b := "location\tuuid\tname\tport\tsoftware\nweb.yml\turn:uuid:2222\tweb\t80\tnginx\n"
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+}
+
+func TestExecuteExportRdfHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "export", "rdf"})
+	rootCmd.Execute()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"export", "rdf", "--help"})
+	rootCmd.Execute()
+	if a.String() != b.String() {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", a.String(), b.String())
+	}
+}
+
+func TestExecuteExportRdf(t *testing.T) {
+	d := serveTestContext(t)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"export", "rdf", "--help=false", "-c", "file://" + d, "-g", "server", "-f", "ntriples", "-m", "", "-o", ""})
+	rootCmd.Execute()
+	for _, b := range []string{
+		"<urn:uuid:2222> <urn:natem:relation:is> <urn:uuid:1111> .\n",
+		"<urn:uuid:2222> <urn:natem:parameter:port> \"80\"^^<http://www.w3.org/2001/XMLSchema#integer> .\n",
+		"<urn:uuid:2222> <urn:natem:parameter:software> \"nginx\" .\n",
+	} {
+		if !strings.Contains(a.String(), b) {
+			t.Fatalf("Expected ...\n%s... in ...\n%s", b, a.String())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the git history of a Thing",
+	Long: `List the git commits that touched a Thing, each with the changes to the
+fields of the Thing, e.g. the parameters added or the relations changed.
+With '--at' the Thing is shown as of a revision, with '--blame' every value
+is shown with the commit that last changed it. Git has to be installed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("thing", cmd.PersistentFlags().Lookup("thing"))
+		thing := viper.GetString("thing")
+
+		viper.BindPFlag("at", cmd.PersistentFlags().Lookup("at"))
+		at := viper.GetString("at")
+
+		viper.BindPFlag("blame", cmd.PersistentFlags().Lookup("blame"))
+		blame := viper.GetBool("blame")
+
+		viper.BindPFlag("output", cmd.PersistentFlags().Lookup("output"))
+		output := viper.GetString("output")
+
+		location, e := util.ResolveThingLocation(thing, context, false)
+		if e != nil {
+			log.Fatalf("Could not find the Thing: %s\n", e)
+		}
+		uuid := storedUuid(location)
+
+		if at != "" {
+			t, e := util.ThingAt(location, uuid, at)
+			if e != nil {
+				log.Fatalf("Could not find the Thing at %s: %s\n", at, e)
+			}
+			if output == "text" {
+				output = "yaml"
+			}
+			e = WriteShowOutput(cmd.OutOrStdout(), map[string]interface{}{"thing": t}, output, "")
+			if e != nil {
+				log.Fatalf("Could not output the Thing: %s.\n", e)
+			}
+			return
+		}
+
+		revisions, e := util.ThingHistory(location, uuid)
+		if e != nil {
+			log.Fatalf("Could not read the history: %s\n", e)
+		}
+		if blame {
+			e = WriteBlame(cmd.OutOrStdout(), revisions, output)
+		} else {
+			e = WriteHistory(cmd.OutOrStdout(), revisions, output)
+		}
+		if e != nil {
+			log.Fatalf("Could not output the history: %s.\n", e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.PersistentFlags().StringP("thing", "t", "", "the thing: a path ('file#n' or 'file#name' selects a document), UUID, name or name prefix")
+	historyCmd.MarkPersistentFlagRequired("thing")
+	historyCmd.PersistentFlags().String("at", "", "show the thing as of this revision, e.g. 'HEAD~2' or a commit hash")
+	historyCmd.PersistentFlags().Bool("blame", false, "show the commit that last changed each value")
+	historyCmd.PersistentFlags().StringP("output", "o", "text", "the output format: text or json, and yaml with '--at'")
+}
+
+// The UUID as written in the file, a generated one is of no use to find
+// the Thing in earlier versions.
+func storedUuid(location string) string {
+
+	t, _ := readStoredThing(location)
+	return t.Id.Uuid
+}
+
+func changeValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// WriteChanges writes the changes one per line, prefixed with '+' for
+// added, '-' for removed and '~' for changed values.
+func WriteChanges(w io.Writer, changes []util.Change, indent string) {
+
+	for _, c := range changes {
+		switch c.Op {
+		case "add":
+			fmt.Fprintf(w, "%s+ %s: %s\n", indent, c.Path, changeValue(c.New))
+		case "remove":
+			fmt.Fprintf(w, "%s- %s: %s\n", indent, c.Path, changeValue(c.Old))
+		default:
+			fmt.Fprintf(w, "%s~ %s: %s -> %s\n", indent, c.Path, changeValue(c.Old), changeValue(c.New))
+		}
+	}
+}
+
+func WriteHistory(w io.Writer, revisions []util.ThingRevision, output string) error {
+
+	switch output {
+	case "json":
+		if revisions == nil {
+			revisions = []util.ThingRevision{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(revisions)
+	case "text":
+		for _, r := range revisions {
+			fmt.Fprintf(w, "commit %s\nAuthor: %s\nDate:   %s\n\n    %s\n\n", r.Commit.Hash, r.Commit.Author, r.Commit.Date, r.Commit.Subject)
+			WriteChanges(w, r.Changes, "  ")
+			fmt.Fprintln(w)
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown output format '%s', use one of: text, json", output)
+}
+
+func WriteBlame(w io.Writer, revisions []util.ThingRevision, output string) error {
+
+	leaves, blame, err := util.BlameThing(revisions)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for p := range leaves {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	switch output {
+	case "json":
+		var r []interface{}
+		for _, p := range paths {
+			r = append(r, map[string]interface{}{"path": p, "value": leaves[p], "commit": blame[p]})
+		}
+		if r == nil {
+			r = []interface{}{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "text":
+		for _, p := range paths {
+			c := blame[p]
+			hash := c.Hash
+			if len(hash) > 8 {
+				hash = hash[:8]
+			}
+			date := strings.SplitN(c.Date, "T", 2)[0]
+			fmt.Fprintf(w, "%-8s %-10s %-16s %s: %s\n", hash, date, c.Author, p, changeValue(leaves[p]))
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown output format '%s', use one of: text, json", output)
+}
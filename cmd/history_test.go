@@ -0,0 +1,95 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// Test the basics...
+func TestExecuteHistoryHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "history"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"history", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestWriteChanges(t *testing.T) {
+	a := bytes.NewBufferString("")
+	WriteChanges(a, []util.Change{
+		{Op: "add", Path: "parameter.port", New: 80.0},
+		{Op: "remove", Path: "relation['is:server.yml']", Old: map[string]interface{}{"thing_url": "server.yml"}},
+		{Op: "change", Path: "id.name", Old: "web", New: "www"},
+	}, "  ")
+	b := "  + parameter.port: 80\n  - relation['is:server.yml']: {\"thing_url\":\"server.yml\"}\n  ~ id.name: \"web\" -> \"www\"\n"
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+}
+
+func TestExecuteHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	d := t.TempDir()
+	git := func(args ...string) {
+		out, err := exec.Command("git", append([]string{"-C", d, "-c", "user.name=Tester", "-c", "user.email=tester@example.org", "-c", "commit.gpgsign=false"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nparameter:\n  port: 80\n"), 0644)
+	git("add", "-A")
+	git("commit", "-q", "-m", "Add web")
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nparameter:\n  port: 8080\n"), 0644)
+	git("commit", "-q", "-a", "-m", "Change the port")
+
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"history", "--help=false", "-c", "file://" + d, "-t", "web"})
+	rootCmd.Execute()
+	if !strings.Contains(a.String(), "Change the port\n\n  ~ parameter.port: 80 -> 8080\n") {
+		t.Fatalf("Unexpected history:\n%s", a.String())
+	}
+	a.Reset()
+	rootCmd.SetArgs([]string{"history", "--help=false", "-c", "file://" + d, "-t", "web", "--at", "HEAD~1"})
+	rootCmd.Execute()
+	if !strings.Contains(a.String(), "port: 80\n") {
+		t.Fatalf("Expected the first version, got:\n%s", a.String())
+	}
+}
@@ -0,0 +1,153 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import Things from other formats",
+}
+
+// importMarkdownCmd represents the import markdown command
+var importMarkdownCmd = &cobra.Command{
+	Use:   "markdown DIR",
+	Short: "Import Markdown notes with front matter as Things",
+	Long: `Import every Markdown file below DIR as a Thing, e.g. the notes of an
+Obsidian vault or the content of a Hugo site. The YAML front matter maps to the
+Thing: 'uuid', 'title' or 'name', 'version' and 'url' to the id, 'author' to
+the legal authors, 'relation' to the relations and the rest to parameters,
+except for the values with wiki-links, e.g. 'is: "[[server]]"', which become
+relations of that kind. The wiki-links in the body become relations too and
+the body is kept as parameter 'body', or as target pointing to the file.
+
+The note 'DIR/a/b.md' is written to 'a/b.yml' in the context, or below '--out'.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		viper.BindPFlag("body", cmd.PersistentFlags().Lookup("body"))
+		viper.BindPFlag("link-kind", cmd.PersistentFlags().Lookup("link-kind"))
+		viper.BindPFlag("overwrite", cmd.PersistentFlags().Lookup("overwrite"))
+		opts := util.MarkdownImportOptions{
+			Out:       viper.GetString("out"),
+			Body:      viper.GetString("body"),
+			LinkKind:  viper.GetString("link-kind"),
+			Overwrite: viper.GetBool("overwrite"),
+		}
+
+		written, errs := util.ImportMarkdown(args[0], context, opts)
+		for _, l := range written {
+			fmt.Fprintln(cmd.OutOrStdout(), l)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Imported %d Things.\n", len(written))
+		for _, e := range errs {
+			fmt.Fprintln(cmd.ErrOrStderr(), e)
+		}
+		if len(errs) > 0 {
+			log.Fatalf("Could not import %d notes.\n", len(errs))
+		}
+	},
+}
+
+// importCsvCmd represents the import csv command
+var importCsvCmd = &cobra.Command{
+	Use:   "csv FILE",
+	Short: "Create or update Things from a table",
+	Long: `Create or update a Thing per record of a table, with the column names in
+the first record, as written by 'export csv'. A record updates the Thing with
+the UUID in column 'uuid', which must exist, or without UUID the one with the
+name in column 'name', or else at 'location', or creates a new Thing at
+'location', or named after it below '--out'. The other columns are the
+parameters, nested ones by their path, e.g. 'network.interfaces[0].ip'.
+
+Empty cells are left alone. The others are converted to the type the schema of
+the Thing, or '--schema', gives the parameter, or else to the type the value
+already has, or taken as text. Records that can not be imported are reported,
+counted from 1 for the header; a quoted cell spanning lines is one record.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("format", cmd.PersistentFlags().Lookup("format"))
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		viper.BindPFlag("schema", cmd.PersistentFlags().Lookup("schema"))
+		comma, e := csvComma(viper.GetString("format"), args[0])
+		if e != nil {
+			log.Fatalf("Could not import the table: %s.\n", e)
+		}
+		opts := util.CSVImportOptions{
+			Comma:  comma,
+			Out:    viper.GetString("out"),
+			Schema: viper.GetString("schema"),
+		}
+
+		f, e := os.Open(args[0])
+		if e != nil {
+			log.Fatalf("Could not read the table: %s.\n", e)
+		}
+		defer f.Close()
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		results, errs := kb.ImportCSV(f, opts)
+		WriteCSVImport(cmd.OutOrStdout(), results)
+		for _, e := range errs {
+			fmt.Fprintln(cmd.ErrOrStderr(), e)
+		}
+		if len(errs) > 0 {
+			log.Fatalf("Could not import %d records.\n", len(errs))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.AddCommand(importMarkdownCmd)
+	importCmd.AddCommand(importCsvCmd)
+
+	importMarkdownCmd.PersistentFlags().StringP("out", "o", "", "the directory in the context to write the Things to")
+	importMarkdownCmd.PersistentFlags().String("body", "parameter", "keep the body as 'parameter' or as 'target'")
+	importMarkdownCmd.PersistentFlags().String("link-kind", "mentions", "the kind of the relations for the links in the body")
+	importMarkdownCmd.PersistentFlags().Bool("overwrite", false, "replace the Things imported before")
+
+	importCsvCmd.PersistentFlags().StringP("format", "f", "", "csv or tsv, by default by the extension of the file or csv")
+	importCsvCmd.PersistentFlags().StringP("out", "o", "", "the directory in the context for the new Things")
+	importCsvCmd.PersistentFlags().StringP("schema", "s", "", "the schema to convert the values by, instead of the Things' own")
+}
+
+func WriteCSVImport(w io.Writer, results []util.CSVImportResult) {
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		fmt.Fprintf(w, "record %d: %-9s %s\n", r.Record, r.Action, r.Location)
+		counts[r.Action]++
+	}
+	fmt.Fprintf(w, "%d created, %d updated, %d unchanged.\n", counts["created"], counts["updated"], counts["unchanged"])
+}
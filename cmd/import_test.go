@@ -0,0 +1,99 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteImportMarkdownHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "import", "markdown"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"import", "markdown", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestExecuteImportMarkdown(t *testing.T) {
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "web.md"), []byte("---\ntitle: web\nport: 80\n---\nRuns on [[server]].\n"), 0644)
+	c := t.TempDir()
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"import", "markdown", "--help=false", "-c", "file://" + c, "-o", "notes", d})
+	rootCmd.Execute()
+	if a.String() != "notes/web.yml\nImported 1 Things.\n" {
+		t.Fatalf("Unexpected output ...\n%s", a.String())
+	}
+	b, e := os.ReadFile(filepath.Join(c, "notes", "web.yml"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, s := range []string{"name: web", "port: 80", "thing_url: server", "kind: mentions"} {
+		if !strings.Contains(string(b), s) {
+			t.Fatalf("Expected '%s' in ...\n%s", s, b)
+		}
+	}
+}
+
+func TestExecuteImportCsvHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "import", "csv"})
+	rootCmd.Execute()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"import", "csv", "--help"})
+	rootCmd.Execute()
+	if a.String() != b.String() {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", a.String(), b.String())
+	}
+}
+
+func TestExecuteImportCsv(t *testing.T) {
+	d := serveTestContext(t)
+	c := filepath.Join(t.TempDir(), "things.tsv")
+	os.WriteFile(c, []byte("name\tport\tsoftware\nweb\t8080\t\ndns\t53\tbind\n"), 0644)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"import", "csv", "--help=false", "-c", "file://" + d, "-o", "hosts", "-f", "", "-s", "", c})
+	rootCmd.Execute()
+	b := "record 2: updated   web.yml\nrecord 3: created   hosts/dns.yml\n1 created, 1 updated, 0 unchanged.\n"
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+	e, _ := os.ReadFile(filepath.Join(d, "web.yml"))
+	if !strings.Contains(string(e), "port: 8080\n") {
+		t.Fatalf("Expected the port to be a number in ...\n%s", e)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// indexCmd represents the index command
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the index of the context",
+	Long: `Manage the index of the context, kept in '.natem/index'. Once the index
+exists, all the commands use it and only parse the files changed since. If it
+can not be read, the files are parsed as if there was none.`,
+}
+
+// indexRebuildCmd represents the index rebuild command
+var indexRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Create the index from scratch",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		s, e := util.RebuildIndex(context)
+		if e != nil {
+			log.Fatalf("Could not build the index: %s.\n", e)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Indexed %d Things in %d files.\n", s.Things, s.Files)
+	},
+}
+
+// indexStatusCmd represents the index status command
+var indexStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the files changed since the index was updated",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		s, e := util.GetIndexStatus(context)
+		if e != nil {
+			log.Fatalf("Could not read the index, see 'index rebuild': %s.\n", e)
+		}
+		WriteIndexStatus(cmd.OutOrStdout(), s)
+	},
+}
+
+// indexVerifyCmd represents the index verify command
+var indexVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the index against the files",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		problems, e := util.VerifyIndex(context)
+		if e != nil {
+			log.Fatalf("Could not read the index, see 'index rebuild': %s.\n", e)
+		}
+		for _, p := range problems {
+			fmt.Fprintln(cmd.OutOrStdout(), p)
+		}
+		if len(problems) > 0 {
+			log.Fatalf("The index does not match the context.\n")
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "The index matches the context.")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indexCmd)
+	indexCmd.AddCommand(indexRebuildCmd)
+	indexCmd.AddCommand(indexStatusCmd)
+	indexCmd.AddCommand(indexVerifyCmd)
+}
+
+func WriteIndexStatus(w io.Writer, s *util.IndexStatus) {
+
+	fmt.Fprintf(w, "%d Things in %d files.\n", s.Things, s.Files)
+	if !s.IsStale() {
+		fmt.Fprintln(w, "The index is up to date.")
+		return
+	}
+	for _, l := range []struct {
+		what  string
+		files []string
+	}{{"added", s.Added}, {"changed", s.Changed}, {"removed", s.Removed}} {
+		for _, f := range l.files {
+			fmt.Fprintf(w, "  %-8s %s\n", l.what, f)
+		}
+	}
+	fmt.Fprintln(w, "The index is stale, it is updated by the next command reading the context.")
+}
@@ -0,0 +1,61 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// Test the basics...
+func TestExecuteIndexHelp(t *testing.T) {
+	for _, c := range []string{"rebuild", "status", "verify"} {
+		a := bytes.NewBufferString("")
+		b := bytes.NewBufferString("")
+		rootCmd.SetOut(a)
+		rootCmd.SetArgs([]string{"help", "index", c})
+		rootCmd.Execute()
+		aOut, err := io.ReadAll(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rootCmd.SetOut(b)
+		rootCmd.SetArgs([]string{"index", c, "--help"})
+		rootCmd.Execute()
+		bOut, err := io.ReadAll(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(aOut) != string(bOut) {
+			t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+		}
+	}
+}
+
+func TestWriteIndexStatus(t *testing.T) {
+	a := bytes.NewBufferString("")
+	WriteIndexStatus(a, &util.IndexStatus{Files: 2, Things: 3})
+	if a.String() != "3 Things in 2 files.\nThe index is up to date.\n" {
+		t.Fatalf("Unexpected status: %s", a.String())
+	}
+	a.Reset()
+	WriteIndexStatus(a, &util.IndexStatus{Files: 2, Things: 3, Changed: []string{"web.yml"}})
+	b := "3 Things in 2 files.\n  changed  web.yml\nThe index is stale, it is updated by the next command reading the context.\n"
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+}
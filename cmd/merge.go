@@ -0,0 +1,110 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge BASE OURS THEIRS",
+	Short: "Merge two versions of a Thing file",
+	Long: `Merge two versions of a Thing file with their common ancestor, field
+by field: values changed on one side only are taken, the relations added on
+either side are all kept and so are the authors appended. The documents of a
+file are matched by their UUID.
+
+The result is written to OURS, or to '--out'. Where both sides changed a value
+differently our value is kept, the conflict is listed under 'conflict' in the
+document, which stays valid YAML, and the command exits with 1.
+
+To use it as git merge driver:
+
+  # .gitattributes
+  *.yml merge=natem
+
+  # .git/config
+  [merge "natem"]
+      name = natem Thing merge
+      driver = natem merge %O %A %B`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		out := viper.GetString("out")
+		if out == "" {
+			out = args[1]
+		}
+
+		conflicts, e := MergeFiles(args[0], args[1], args[2], out)
+		if e != nil {
+			log.Fatalf("Could not merge the files: %s.\n", e)
+		}
+		if len(conflicts) > 0 {
+			WriteMergeConflicts(cmd.ErrOrStderr(), conflicts)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.PersistentFlags().StringP("out", "o", "", "the file to write the result to, instead of OURS")
+}
+
+// MergeFiles merges the files and writes the result to out, a missing base
+// is taken as empty. An existing out is replaced as a whole and keeps its
+// permissions.
+func MergeFiles(base string, ours string, theirs string, out string) ([]util.MergeConflict, error) {
+
+	a, err := os.ReadFile(base)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	b, err := os.ReadFile(ours)
+	if err != nil {
+		return nil, err
+	}
+	c, err := os.ReadFile(theirs)
+	if err != nil {
+		return nil, err
+	}
+	d, conflicts, err := util.MergeThingFiles(a, b, c)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(out); os.IsNotExist(err) {
+		return conflicts, os.WriteFile(out, d, 0644)
+	}
+	return conflicts, util.ReplaceFile(out, d)
+}
+
+func WriteMergeConflicts(w io.Writer, conflicts []util.MergeConflict) {
+
+	for _, c := range conflicts {
+		if c.Path == "" {
+			fmt.Fprintln(w, "CONFLICT: the Thing was removed on one side and changed on the other")
+			continue
+		}
+		fmt.Fprintf(w, "CONFLICT: %s: %s -> %s (ours), %s (theirs)\n", c.Path, changeValue(c.Base), changeValue(c.Ours), changeValue(c.Theirs))
+	}
+}
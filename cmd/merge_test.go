@@ -0,0 +1,92 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteMergeHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "merge"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"merge", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestExecuteMerge(t *testing.T) {
+	d := t.TempDir()
+	for n, c := range map[string]string{
+		"base.yml":   "---\nid:\n  name: web\nrelation:\n  - thing_url: server.yml\nparameter:\n  port: 80\n",
+		"ours.yml":   "---\nid:\n  name: web\nrelation:\n  - thing_url: server.yml\n  - thing_url: db.yml\nparameter:\n  port: 8080\n",
+		"theirs.yml": "---\nid:\n  name: web\nrelation:\n  - thing_url: server.yml\n  - thing_url: cache.yml\nparameter:\n  port: 80\n",
+	} {
+		if e := os.WriteFile(filepath.Join(d, n), []byte(c), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	rootCmd.SetArgs([]string{"merge", "--help=false", filepath.Join(d, "base.yml"), filepath.Join(d, "ours.yml"), filepath.Join(d, "theirs.yml")})
+	rootCmd.Execute()
+	a, e := os.ReadFile(filepath.Join(d, "ours.yml"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	b := "---\nid:\n  name: web\nrelation:\n  - thing_url: server.yml\n  - thing_url: db.yml\n  - thing_url: cache.yml\nparameter:\n  port: 8080\n"
+	if string(a) != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a)
+	}
+}
+
+func TestMergeFiles(t *testing.T) {
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "ours.yml"), []byte("id:\n  name: web\nparameter:\n  port: 8080\n"), 0644)
+	os.WriteFile(filepath.Join(d, "theirs.yml"), []byte("id:\n  name: web\nparameter:\n  port: 443\n"), 0644)
+	t.Log("Now failing successfully (added on both sides, differently):")
+	a, e := MergeFiles(filepath.Join(d, "none.yml"), filepath.Join(d, "ours.yml"), filepath.Join(d, "theirs.yml"), filepath.Join(d, "out.yml"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(a) != 1 || a[0].Path != "parameter.port" {
+		t.Fatalf("Expected a conflict on the port, got %v.\n", a)
+	}
+	b := bytes.NewBufferString("")
+	WriteMergeConflicts(b, a)
+	c := "CONFLICT: parameter.port: null -> 8080 (ours), 443 (theirs)\n"
+	if b.String() != c {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", c, b.String())
+	}
+	os.Chmod(filepath.Join(d, "ours.yml"), 0600)
+	MergeFiles(filepath.Join(d, "none.yml"), filepath.Join(d, "ours.yml"), filepath.Join(d, "theirs.yml"), filepath.Join(d, "ours.yml"))
+	if fi, _ := os.Stat(filepath.Join(d, "ours.yml")); fi.Mode().Perm() != 0600 {
+		t.Fatalf("The permissions should have been kept, got: %s", fi.Mode())
+	}
+}
@@ -0,0 +1,108 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// mvCmd represents the mv command
+var mvCmd = &cobra.Command{
+	Use:   "mv OLD NEW",
+	Short: "Move or rename a Thing file",
+	Long: `Move the file of a Thing inside the context and rewrite every reference
+to it: the relations, the schema and dependency URLs of all the Things and
+the URLs of the Thing itself. Other Things in the same file move along.
+
+OLD is given by path, UUID, name or name prefix. NEW is a path relative to the
+context, or a directory to move the file into, if it exists or ends with '/'.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("dry-run", cmd.PersistentFlags().Lookup("dry-run"))
+		dryRun := viper.GetBool("dry-run")
+
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the context: %s.\n", e)
+		}
+		ct, e := kb.Resolve(args[0])
+		if e != nil {
+			log.Fatalf("Could not find the Thing: %s\n", e)
+		}
+		to, e := thingTarget(kb, ct, args[1])
+		if e != nil {
+			log.Fatalf("Could not move the Thing to '%s': %s\n", args[1], e)
+		}
+		plan, e := kb.PlanMove(ct, to)
+		if e != nil {
+			log.Fatalf("Could not move the Thing: %s\n", e)
+		}
+		if !dryRun {
+			e = kb.ApplyMove(plan)
+			if e != nil {
+				log.Fatalf("Could not move the Thing: %s.\n", e)
+			}
+		}
+		WriteMovePlan(cmd.OutOrStdout(), plan, dryRun)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mvCmd)
+
+	mvCmd.PersistentFlags().Bool("dry-run", false, "only show the files that would change")
+}
+
+// The new path relative to the context, moving or copying into a directory
+// keeps the name of the file.
+func thingTarget(kb *util.KnowledgeBase, ct *util.ContextThing, ref string) (string, error) {
+
+	p, err := util.GetThingURLPath(ref, "file://"+kb.ContextPath, true)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(p); strings.HasSuffix(ref, "/") || err == nil && fi.IsDir() {
+		p = filepath.Join(p, filepath.Base(ct.Path))
+	}
+	rel, err := filepath.Rel(kb.ContextPath, p)
+	if err != nil {
+		return "", err
+	}
+	return util.ContextRelativePath(rel)
+}
+
+func WriteMovePlan(w io.Writer, plan *util.MovePlan, dryRun bool) {
+
+	if dryRun {
+		fmt.Fprintf(w, "Would move %s -> %s\n", plan.From, plan.To)
+	} else {
+		fmt.Fprintf(w, "Moved %s -> %s\n", plan.From, plan.To)
+	}
+	for _, e := range plan.Edits {
+		fmt.Fprintf(w, "%s\n", e.Location)
+		WriteChanges(w, e.Changes, "  ")
+	}
+}
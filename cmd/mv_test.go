@@ -0,0 +1,72 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteMvHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "mv"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"mv", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestExecuteMv(t *testing.T) {
+	d := serveTestContext(t)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"mv", "--help=false", "-c", "file://" + d, "--dry-run", "server", "hosts/"})
+	rootCmd.Execute()
+	b := `Would move categories/server.yml -> hosts/server.yml
+web.yml
+  ~ relation[0].thing_url: "categories/server.yml" -> "hosts/server.yml"
+`
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+	if _, e := os.Stat(filepath.Join(d, "categories", "server.yml")); e != nil {
+		t.Fatalf("Expected a dry run not to move the file: %s", e)
+	}
+	os.MkdirAll(filepath.Join(d, "hosts"), 0755)
+	a.Reset()
+	rootCmd.SetArgs([]string{"mv", "--help=false", "-c", "file://" + d, "--dry-run=false", "server", "hosts"})
+	rootCmd.Execute()
+	if a.String() != "Moved"+b[len("Would move"):] {
+		t.Fatalf("Unexpected output ...\n%s", a.String())
+	}
+	if _, e := os.Stat(filepath.Join(d, "hosts", "server.yml")); e != nil {
+		t.Fatalf("Expected the file to be moved: %s", e)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// queryCmd represents the query command
+var queryCmd = &cobra.Command{
+	Use:   "query EXPR",
+	Short: "Find the Things matching a pattern of relations and parameters",
+	Long: `Find the Things matching all the clauses of the query, separated by ','
+or 'and'. A clause is either a relation pattern or a predicate on a Thing, and
+'not' in front of it means it must not match, its variables bound by the
+clauses before it. Variables start with '?', every other term refers to a
+Thing by path, UUID, name or name prefix.
+
+  ?x depends_on ?y          relations of the kind, '_' matches every kind
+  ?x is+ server             one or more steps, 'is*' zero or more
+  ?x.parameter.port >= 80   ==, !=, <, <=, >, >= or ~ (contains, any case)
+  ?y.legal.license          the value exists
+
+A line is printed per match, with the locations of the variables separated by
+tabs, in the order they appear or as selected by 'find ?x ?y where ...', e.g.
+
+  natem query 'find ?x where ?x is+ server, ?x depends_on+ ?y,
+               ?y.legal.license[*].name ~ GPL'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		q, e := util.ParseQuery(args[0])
+		if e != nil {
+			log.Fatalf("Could not parse the query: %s\n", e)
+		}
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		for _, e := range kb.Errors {
+			log.Printf("Skipping: %s\n", e)
+		}
+		rows, e := kb.RunQuery(q)
+		if e != nil {
+			log.Fatalf("Could not run the query: %s\n", e)
+		}
+		WriteQueryRows(cmd.OutOrStdout(), rows)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+}
+
+func WriteQueryRows(w io.Writer, rows [][]*util.ContextThing) {
+
+	for _, row := range rows {
+		var l []string
+		for _, ct := range row {
+			l = append(l, ct.Location())
+		}
+		fmt.Fprintln(w, strings.Join(l, "\t"))
+	}
+}
@@ -0,0 +1,50 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteQueryHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "query"})
+	rootCmd.Execute()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"query", "--help"})
+	rootCmd.Execute()
+	if a.String() != b.String() {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", a.String(), b.String())
+	}
+}
+
+func TestExecuteQuery(t *testing.T) {
+	d := serveTestContext(t)
+	a := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"query", "--help=false", "-c", "file://" + d, "?x is* server, ?x.parameter.port >= 80"})
+	rootCmd.Execute()
+	if a.String() != "web.yml\n" {
+		t.Fatalf("Unexpected output ...\n%s", a.String())
+	}
+	a.Reset()
+	rootCmd.SetArgs([]string{"query", "--help=false", "-c", "file://" + d, "?x _ ?y, ?x.parameter.software"})
+	rootCmd.Execute()
+	if a.String() != "web.yml\tcategories/server.yml\n" {
+		t.Fatalf("Unexpected output ...\n%s", a.String())
+	}
+}
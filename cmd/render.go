@@ -0,0 +1,67 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// renderCmd represents the render command
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render the knowledge base",
+	Long: `Render the whole knowledge base into another format for publishing.
+See the subcommands for the formats available.`,
+}
+
+// renderHtmlCmd represents the render html command
+var renderHtmlCmd = &cobra.Command{
+	Use:   "html",
+	Short: "Render the knowledge base as static HTML site",
+	Long: `Render the knowledge base as static HTML site: a page per Thing with its
+parameters, behaviors, legal information, relations and backlinks, a page per
+category following the 'is' hierarchy, and Mermaid diagrams of the relations.
+The same knowledge base always results in the same site, so the output can be
+versioned and published as is.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("out", cmd.PersistentFlags().Lookup("out"))
+		out := viper.GetString("out")
+
+		kb, e := util.LoadKnowledgeBase(context)
+		if e != nil {
+			log.Fatalf("Could not load the knowledge base: %s.\n", e)
+		}
+		for _, e := range kb.Errors {
+			log.Printf("Skipping: %s\n", e)
+		}
+		e = util.RenderSite(kb, out)
+		if e != nil {
+			log.Fatalf("Could not render the site: %s.\n", e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.AddCommand(renderHtmlCmd)
+
+	renderHtmlCmd.PersistentFlags().String("out", "site", "the directory to write the site to")
+}
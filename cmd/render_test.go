@@ -0,0 +1,58 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test the basics...
+func TestExecuteRenderHtmlHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "render", "html"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"render", "html", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+// The help flag of the test above sticks to the command.
+func TestExecuteRenderHtml(t *testing.T) {
+	a := serveTestContext(t)
+	b := filepath.Join(t.TempDir(), "site")
+	rootCmd.SetArgs([]string{"render", "html", "--help=false", "-c", "file://" + a, "--out", b})
+	rootCmd.Execute()
+	for _, c := range []string{"index.html", "thing-web.yml.html", "category-categories_server.yml.html"} {
+		if _, err := os.Stat(filepath.Join(b, c)); err != nil {
+			t.Fatalf("Expected the page %s: %s.\n", c, err)
+		}
+	}
+}
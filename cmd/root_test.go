@@ -16,6 +16,9 @@ package cmd
 import (
 	"bytes"
 	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/cobra"
@@ -25,6 +28,35 @@ func init() {
 	cobra.OnInitialize(initConfig)
 }
 
+// Copy a context of util/testing/contexts to a directory of its own, for
+// the test to change as it likes.
+func testContext(t *testing.T, name string) string {
+
+	d := t.TempDir()
+	src := filepath.Join("..", "util", "testing", "contexts", name)
+	err := filepath.WalkDir(src, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return os.MkdirAll(filepath.Join(d, rel), 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(d, rel), content, 0644)
+	})
+	if err != nil {
+		t.Fatalf("Could not copy the context '%s': %s.\n", name, err)
+	}
+	return d
+}
+
 // Test the basics...
 func TestExecuteHelp(t *testing.T) {
 	a := bytes.NewBufferString("")
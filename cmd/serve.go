@@ -0,0 +1,532 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// A Server offers the knowledge base of a context as HTTP/JSON API. The
+// knowledge base is read for every request, so the answers are always up
+// to date.
+type Server struct {
+	Context string
+	// the schema for Things that do not name their own
+	Schema string
+	// the bearer token required for writing, writing is disabled without
+	Token string
+	// the source of the change events, there are none without
+	Watcher *util.Watcher
+}
+
+/*
+	Handler returns the routes of the API:
+		GET /things					list all Things
+		GET /things/<ref>			get a Thing by path, UUID or name
+		GET /relations/<ref>		the relations of a Thing, '?kind=' filters
+		GET /backlinks/<ref>		the Things with relations to this Thing
+		GET /validate/<ref>			validate a Thing against its schema
+		GET /search?q=<words>		search the Things
+		GET /events					the changes as server-sent events
+		PUT /things/<ref>			replace a Thing or create it at the path
+		PATCH /things/<ref>			apply a JSON merge patch to a Thing
+		DELETE /things/<ref>		remove a Thing
+	Writing requires the bearer token and, for existing Things, the ETag
+	of the current version in 'If-Match'. It only takes the exact path,
+	UUID or name of a Thing, never a prefix.
+*/
+func (s *Server) Handler() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/things", s.readOnly(s.handleThings))
+	mux.HandleFunc("/things/", s.handleThingMethods)
+	mux.HandleFunc("/relations/", s.readOnly(s.handleRelations))
+	mux.HandleFunc("/backlinks/", s.readOnly(s.handleBacklinks))
+	mux.HandleFunc("/validate/", s.readOnly(s.handleValidate))
+	mux.HandleFunc("/search", s.readOnly(s.handleSearch))
+	mux.HandleFunc("/events", s.readOnly(s.handleEvents))
+	return mux
+}
+
+func (s *Server) readOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed."))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Write the data as JSON with an ETag, or nothing if the client already
+// has the current version.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+
+	body, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	body = append(body, '\n')
+	w.Header().Set("Content-Type", "application/json")
+	if r != nil && status == http.StatusOK {
+		etag := etagOf(body)
+		w.Header().Set("ETag", etag)
+		for _, m := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+			m = strings.TrimSpace(m)
+			if m == etag || m == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.WriteHeader(status)
+	if r == nil || r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+
+	data := map[string]interface{}{"error": err.Error()}
+	var ae *util.AmbiguousThingError
+	if errors.As(err, &ae) {
+		// a read offers the choice, a change refuses to make one
+		if status != http.StatusConflict {
+			status = http.StatusMultipleChoices
+		}
+		var c []interface{}
+		for _, ct := range ae.Candidates {
+			c = append(c, thingSummary(ct))
+		}
+		data["candidates"] = c
+	}
+	writeJSON(w, nil, status, data)
+}
+
+func thingSummary(ct *util.ContextThing) map[string]interface{} {
+	return map[string]interface{}{
+		"location": ct.Location(),
+		"uuid":     ct.Id.Uuid,
+		"name":     ct.Id.Name,
+		"version":  ct.Id.Version,
+	}
+}
+
+func thingSummaries(cts []*util.ContextThing) []interface{} {
+	r := []interface{}{}
+	for _, ct := range cts {
+		r = append(r, thingSummary(ct))
+	}
+	return r
+}
+
+func (s *Server) load(w http.ResponseWriter) (*util.KnowledgeBase, bool) {
+
+	kb, err := util.LoadKnowledgeBase(s.Context)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return kb, true
+}
+
+// Find the Thing the rest of the URL path refers to.
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request, prefix string) (*util.KnowledgeBase, *util.ContextThing, bool) {
+
+	kb, ok := s.load(w)
+	if !ok {
+		return nil, nil, false
+	}
+	ref := strings.TrimPrefix(r.URL.Path, prefix)
+	ct, err := kb.Resolve(ref)
+	if errors.Is(err, util.ThingNotFoundError) {
+		writeError(w, http.StatusNotFound, err)
+		return kb, nil, false
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return kb, nil, false
+	}
+	return kb, ct, true
+}
+
+func (s *Server) handleThings(w http.ResponseWriter, r *http.Request) {
+
+	kb, ok := s.load(w)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, thingSummaries(kb.Things))
+}
+
+func thingResponse(ct *util.ContextThing) map[string]interface{} {
+	return map[string]interface{}{
+		"location": ct.Location(),
+		"thing":    ct.Thing,
+	}
+}
+
+// The ETag of a Thing is the one its GET response carries.
+func thingETag(ct *util.ContextThing) string {
+	body, _ := json.MarshalIndent(thingResponse(ct), "", "  ")
+	return etagOf(append(body, '\n'))
+}
+
+func (s *Server) handleThing(w http.ResponseWriter, r *http.Request) {
+
+	_, ct, ok := s.lookup(w, r, "/things/")
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, thingResponse(ct))
+}
+
+func (s *Server) handleThingMethods(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.handleThing(w, r)
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if !s.authorized(w, r) {
+			return
+		}
+		s.handleWrite(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed."))
+	}
+}
+
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+
+	if s.Token == "" {
+		writeError(w, http.StatusForbidden, errors.New("Writing is disabled, the server has no token set."))
+		return false
+	}
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") || subtle.ConstantTimeCompare([]byte(h[len("Bearer "):]), []byte(s.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("Missing or wrong credentials."))
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
+
+	kb, ok := s.load(w)
+	if !ok {
+		return
+	}
+	ref := strings.TrimPrefix(r.URL.Path, "/things/")
+	// a change must not guess, only the exact location, UUID or name count
+	ct, err := kb.ResolveRelation(ref)
+	var ambiguous *util.AmbiguousThingError
+	if err != nil && !(errors.Is(err, util.ThingNotFoundError) && r.Method == http.MethodPut) {
+		status := http.StatusBadRequest
+		if errors.Is(err, util.ThingNotFoundError) {
+			status = http.StatusNotFound
+		} else if errors.As(err, &ambiguous) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	if ct != nil {
+		match := r.Header.Get("If-Match")
+		if match == "" {
+			writeError(w, http.StatusPreconditionRequired, errors.New("Please send the ETag of the Thing in 'If-Match'."))
+			return
+		} else if match != "*" && match != thingETag(ct) {
+			writeError(w, http.StatusPreconditionFailed, errors.New("The Thing was changed in the meantime."))
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" {
+			writeError(w, http.StatusPreconditionFailed, errors.New("The Thing exists already."))
+			return
+		}
+	} else if r.Header.Get("If-Match") != "" {
+		writeError(w, http.StatusPreconditionFailed, errors.New("The Thing does not exist."))
+		return
+	}
+	if ct == nil && !strings.HasSuffix(ref, ".yml") && !strings.HasSuffix(ref, ".yaml") {
+		writeError(w, http.StatusBadRequest, errors.New("A new Thing needs a path ending in '.yml' or '.yaml'."))
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = kb.DeleteThing(ct)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, r, http.StatusNoContent, nil)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if r.Method == http.MethodPatch {
+		body, err = patchThing(ct, body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	var thing util.Thing
+	err = util.Unmarshal(body, &thing)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	status := http.StatusCreated
+	location := ref
+	if ct != nil {
+		// the UUID identifies the document inside the file
+		if thing.Id.Uuid == "" {
+			thing.Id.Uuid = ct.Id.Uuid
+		} else if thing.Id.Uuid != ct.Id.Uuid {
+			writeError(w, http.StatusConflict, errors.New("The UUID of a Thing must not change."))
+			return
+		}
+		status = http.StatusOK
+		location = ct.Location()
+	}
+	problems, err := s.validate(kb, &thing, body)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	} else if len(problems) > 0 {
+		writeJSON(w, nil, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":    "The Thing failed to validate against the schema.",
+			"problems": problems,
+		})
+		return
+	}
+	_, _, err = util.WriteThingFile(&thing, location, s.Context, true, ct != nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	kb, ok = s.load(w)
+	if !ok {
+		return
+	}
+	ct, err = kb.ResolveRelation(location)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("ETag", thingETag(ct))
+	writeJSON(w, nil, status, thingResponse(ct))
+}
+
+// Apply the merge patch to the Thing and return the result as JSON.
+func patchThing(ct *util.ContextThing, patch []byte) ([]byte, error) {
+
+	var p interface{}
+	err := json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, err
+	}
+	g, err := util.ToGeneric(ct.Thing)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(util.ApplyMergePatch(g, p))
+}
+
+// Validate the content against the schema of the Thing or the default one.
+func (s *Server) validate(kb *util.KnowledgeBase, thing *util.Thing, content []byte) ([]string, error) {
+
+	schemaPath, err := util.GetThingSchemaPath(thing, s.Context)
+	if err != nil {
+		return nil, err
+	}
+	if schemaPath == "" && s.Schema != "" {
+		schemaPath, err = util.GetThingURLPath(s.Schema, s.Context, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if schemaPath == "" {
+		return nil, errors.New("There is no schema to validate the Thing against.")
+	}
+	schemaBytes, err := util.ReadYAMLDocumentFromFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	return util.ValidateThingProblems(schemaBytes, content)
+}
+
+func (s *Server) handleRelations(w http.ResponseWriter, r *http.Request) {
+
+	_, ct, ok := s.lookup(w, r, "/relations/")
+	if !ok {
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	rel := []util.ThingRelation{}
+	for _, l := range ct.Relation {
+		if kind == "" || l.Kind == kind || (kind == "is" && l.Kind == "") {
+			rel = append(rel, l)
+		}
+	}
+	writeJSON(w, r, http.StatusOK, rel)
+}
+
+func (s *Server) handleBacklinks(w http.ResponseWriter, r *http.Request) {
+
+	kb, ct, ok := s.lookup(w, r, "/backlinks/")
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, thingSummaries(kb.Backlinks(ct)))
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+
+	kb, ct, ok := s.lookup(w, r, "/validate/")
+	if !ok {
+		return
+	}
+	problems, err := kb.ValidateContextThing(ct, s.Schema)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{
+		"location": ct.Location(),
+		"valid":    len(problems) == 0,
+		"problems": problems,
+	})
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+
+	kb, ok := s.load(w)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, thingSummaries(kb.Search(r.URL.Query().Get("q"))))
+}
+
+// Stream the events of the watcher until the client goes away, so pages
+// can reload when the Things change.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if s.Watcher == nil || !ok {
+		writeError(w, http.StatusNotFound, errors.New("The server does not watch the context, see '--watch'."))
+		return
+	}
+	events, unsubscribe := s.Watcher.Subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: change\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Offer the knowledge base via HTTP",
+	Long: `Offer the Things of the context as HTTP/JSON API. The Things can be
+listed, fetched by path, UUID or name, searched and validated, and their
+relations and backlinks can be followed. If a token is set, clients
+presenting it can also create, change and remove Things. With '--watch' the
+changes to the files are announced as server-sent events on '/events'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("listen", cmd.PersistentFlags().Lookup("listen"))
+		listen := viper.GetString("listen")
+
+		viper.BindPFlag("schema", cmd.PersistentFlags().Lookup("schema"))
+		schema := viper.GetString("schema")
+
+		viper.BindPFlag("token", cmd.PersistentFlags().Lookup("token"))
+		token := viper.GetString("token")
+
+		viper.BindPFlag("watch", cmd.PersistentFlags().Lookup("watch"))
+		watch := viper.GetBool("watch")
+
+		s := &Server{Context: context, Schema: schema, Token: token}
+		if watch {
+			w, e := util.NewWatcher(context, schema)
+			if e != nil {
+				log.Fatalf("Could not watch the context: %s.\n", e)
+			}
+			defer w.Close()
+			s.Watcher = w
+			go w.Run(nil)
+		}
+		log.Printf("Serving %s on http://%s/things\n", context, listen)
+		log.Fatal(http.ListenAndServe(listen, s.Handler()))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.PersistentFlags().StringP("listen", "l", "localhost:8080", "the address to listen on")
+	serveCmd.PersistentFlags().StringP("schema", "s", "", "the schema to validate against if a thing does not name one")
+	serveCmd.PersistentFlags().String("token", "", "the bearer token that allows writing, better set in the config file (default: read-only)")
+	serveCmd.PersistentFlags().Bool("watch", false, "watch the context and announce the changes on '/events'")
+}
@@ -0,0 +1,297 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// Test the basics...
+func TestExecuteServeHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "serve"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"serve", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+// Create a small context to be served.
+func serveTestContext(t *testing.T) string {
+	return testContext(t, "serve")
+}
+
+func getJSON(t *testing.T, h http.Handler, method string, path string, header map[string]string, v interface{}) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for k, e := range header {
+		r.Header.Set(k, e)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if v != nil && w.Code != http.StatusNotModified {
+		err := json.Unmarshal(w.Body.Bytes(), v)
+		if err != nil {
+			t.Fatalf("%s %s did not return JSON: %s\n%s", method, path, err, w.Body.String())
+		}
+	}
+	return w
+}
+
+func TestServerRead(t *testing.T) {
+	d := serveTestContext(t)
+	h := (&Server{Context: "file://" + d}).Handler()
+
+	var list []map[string]interface{}
+	w := getJSON(t, h, "GET", "/things", nil, &list)
+	if w.Code != http.StatusOK || len(list) != 4 {
+		t.Fatalf("Expected 4 Things, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, ref := range []string{"web.yml", "urn:uuid:2222", "2222", "web"} {
+		var thing map[string]interface{}
+		w = getJSON(t, h, "GET", "/things/"+ref, nil, &thing)
+		if w.Code != http.StatusOK || thing["location"] != "web.yml" {
+			t.Fatalf("The Thing '%s' was not found: %d %s", ref, w.Code, w.Body.String())
+		}
+	}
+
+	etag := w.Header().Get("ETag")
+	w = getJSON(t, h, "GET", "/things/web", map[string]string{"If-None-Match": etag}, nil)
+	if etag == "" || w.Code != http.StatusNotModified {
+		t.Fatalf("The unchanged Thing should not have been sent again: %d", w.Code)
+	}
+
+	var rel []map[string]interface{}
+	w = getJSON(t, h, "GET", "/relations/web?kind=is", nil, &rel)
+	if len(rel) != 1 || rel[0]["thing_url"] != "categories/server.yml" {
+		t.Fatalf("Wrong relations: %s", w.Body.String())
+	}
+	w = getJSON(t, h, "GET", "/backlinks/server", nil, &list)
+	if len(list) != 1 || list[0]["name"] != "web" {
+		t.Fatalf("Wrong backlinks: %s", w.Body.String())
+	}
+	w = getJSON(t, h, "GET", "/search?q=NGINX", nil, &list)
+	if len(list) != 1 || list[0]["name"] != "web" {
+		t.Fatalf("Wrong search result: %s", w.Body.String())
+	}
+
+	var v map[string]interface{}
+	w = getJSON(t, h, "GET", "/validate/web", nil, &v)
+	if v["valid"] != true {
+		t.Fatalf("The Thing should be valid: %s", w.Body.String())
+	}
+	w = getJSON(t, h, "GET", "/validate/webcache", nil, &v)
+	if v["valid"] != false || !strings.Contains(w.Body.String(), "port") {
+		t.Fatalf("The Thing should not be valid: %s", w.Body.String())
+	}
+
+	t.Log("Now failing successfully (unknown, ambiguous, wrong method):")
+	w = getJSON(t, h, "GET", "/things/nothing", nil, &v)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404, got %d", w.Code)
+	}
+	w = getJSON(t, h, "GET", "/things/we", nil, &v)
+	if w.Code != http.StatusMultipleChoices || len(v["candidates"].([]interface{})) != 2 {
+		t.Fatalf("Expected the candidates, got %d %s", w.Code, w.Body.String())
+	}
+	w = getJSON(t, h, "POST", "/things/web", nil, &v)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected 405, got %d", w.Code)
+	}
+}
+
+func sendJSON(h http.Handler, method string, path string, body string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for k, e := range header {
+		r.Header.Set(k, e)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestServerWrite(t *testing.T) {
+	d := serveTestContext(t)
+	h := (&Server{Context: "file://" + d, Schema: "schema.yml", Token: "secret"}).Handler()
+	auth := map[string]string{"Authorization": "Bearer secret"}
+
+	t.Log("Now failing successfully (no or wrong credentials):")
+	w := sendJSON(h, "DELETE", "/things/web", "", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", w.Code)
+	}
+	w = sendJSON(h, "DELETE", "/things/web", "", map[string]string{"Authorization": "Bearer wrong"})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", w.Code)
+	}
+	w = sendJSON(h, "DELETE", "/things/web", "", map[string]string{"Authorization": "secret"})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for the token without scheme, got %d", w.Code)
+	}
+	w = sendJSON((&Server{Context: "file://" + d}).Handler(), "DELETE", "/things/web", "", auth)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403 without a token configured, got %d", w.Code)
+	}
+
+	w = sendJSON(h, "PATCH", "/things/web", `{"parameter": {"port": 8080}}`, auth)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("Expected 428 without If-Match, got %d", w.Code)
+	}
+	w = sendJSON(h, "PATCH", "/things/web", `{"parameter": {"port": 8080}}`, map[string]string{"Authorization": "Bearer secret", "If-Match": `"old"`})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412 with an old ETag, got %d", w.Code)
+	}
+
+	etag := getJSON(t, h, "GET", "/things/web", nil, nil).Header().Get("ETag")
+	w = sendJSON(h, "PATCH", "/things/web", `{"parameter": {"port": "none"}}`, map[string]string{"Authorization": "Bearer secret", "If-Match": etag})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "problems") {
+		t.Fatalf("Expected 422 for an invalid Thing, got %d %s", w.Code, w.Body.String())
+	}
+	w = sendJSON(h, "PATCH", "/things/web", `{"parameter": {"port": 8080}}`, map[string]string{"Authorization": "Bearer secret", "If-Match": etag})
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("The patch should have worked, got %d %s", w.Code, w.Body.String())
+	}
+	b, _ := os.ReadFile(filepath.Join(d, "web.yml"))
+	if !strings.Contains(string(b), "port: 8080") || !strings.Contains(string(b), "software: nginx") {
+		t.Fatalf("The file was not patched: %s", string(b))
+	}
+	t.Log("Now failing successfully (concurrent edit):")
+	w = sendJSON(h, "PATCH", "/things/web", `{"parameter": {"port": 81}}`, map[string]string{"Authorization": "Bearer secret", "If-Match": etag})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412 for the outdated ETag, got %d", w.Code)
+	}
+
+	w = sendJSON(h, "PUT", "/things/new/db.yml", `{"id": {"name": "db"}, "parameter": {"port": 5432}}`, auth)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("The Thing should have been created, got %d %s", w.Code, w.Body.String())
+	}
+	w = sendJSON(h, "PUT", "/things/db", `{"id": {"name": "db"}, "parameter": {"port": 5433}}`, map[string]string{"Authorization": "Bearer secret", "If-Match": w.Header().Get("ETag")})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "5433") {
+		t.Fatalf("The Thing should have been replaced, got %d %s", w.Code, w.Body.String())
+	}
+	t.Log("Now failing successfully (outside the context):")
+	for _, o := range []string{filepath.Dir(d) + "/outside.yml", d + "-outside/outside.yml"} {
+		w = sendJSON(h, "PUT", "/things/file:"+o, `{"id": {"name": "out"}}`, auth)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "do not match") {
+			t.Fatalf("Things outside the context must not be created, got %d %s", w.Code, w.Body.String())
+		}
+		if _, err := os.Stat(o); !os.IsNotExist(err) {
+			t.Fatalf("The file %s must not have been written.", o)
+		}
+	}
+	t.Log("Now failing successfully (not a Thing file):")
+	w = sendJSON(h, "PUT", "/things/notes.txt", `{"id": {"name": "notes"}}`, auth)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a path without '.yml', got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(d, "notes.txt")); !os.IsNotExist(err) {
+		t.Fatal("The file must not have been written.")
+	}
+
+	t.Log("Now failing successfully (a name prefix is not enough to change a Thing):")
+	any := map[string]string{"Authorization": "Bearer secret", "If-Match": "*"}
+	for _, m := range []string{"DELETE", "PATCH"} {
+		w = sendJSON(h, m, "/things/we", `{"parameter": {"port": 1}}`, any)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404 for %s of a name prefix, got %d %s", m, w.Code, w.Body.String())
+		}
+	}
+	w = sendJSON(h, "PUT", "/things/we", `{"id": {"name": "we"}}`, any)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected 412 for PUT of a name prefix, got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(d, "web.yml")); err != nil {
+		t.Fatal("The Thing the prefix matches must not have been touched.")
+	}
+	os.WriteFile(filepath.Join(d, "twins.yml"), []byte("---\nid:\n  name: twin\n---\nid:\n  name: twin\n"), 0600)
+	w = sendJSON(h, "DELETE", "/things/twin", "", any)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for an ambiguous name, got %d %s", w.Code, w.Body.String())
+	}
+	w = sendJSON(h, "DELETE", "/things/twins.yml%232", "", any)
+	if fi, err := os.Stat(filepath.Join(d, "twins.yml")); w.Code != http.StatusNoContent || err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("The document should have been removed keeping the mode, got %d %v", w.Code, err)
+	}
+
+	etag = getJSON(t, h, "GET", "/things/db", nil, nil).Header().Get("ETag")
+	w = sendJSON(h, "DELETE", "/things/db", "", map[string]string{"Authorization": "Bearer secret", "If-Match": etag})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("The Thing should have been removed, got %d %s", w.Code, w.Body.String())
+	}
+	_, err := os.Stat(filepath.Join(d, "new", "db.yml"))
+	if !os.IsNotExist(err) {
+		t.Fatal("The file should be gone.")
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	d := serveTestContext(t)
+	t.Log("Now failing successfully (not watching):")
+	w := getJSON(t, (&Server{Context: "file://" + d}).Handler(), "GET", "/events", nil, nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 without a watcher, got %d", w.Code)
+	}
+
+	watcher, err := util.NewWatcher("file://"+d, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+	s := httptest.NewServer((&Server{Context: "file://" + d, Watcher: watcher}).Handler())
+	defer s.Close()
+	r, err := http.Get(s.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", r.Header.Get("Content-Type"))
+	}
+	os.Remove(filepath.Join(d, "categories", "server.yml"))
+	watcher.Update([]string{"categories/server.yml"})
+	lines := bufio.NewScanner(r.Body)
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "data: ") {
+			if !strings.Contains(lines.Text(), `"removed":["categories/server.yml"]`) {
+				t.Fatalf("Expected the removal in the event, got %s", lines.Text())
+			}
+			return
+		}
+	}
+	t.Fatal("Expected an event.")
+}
@@ -13,8 +13,13 @@ Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"strings"
+	"text/tabwriter"
+	"text/template"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -25,7 +30,9 @@ import (
 var showCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show View",
-	Long:  `Show a representation of the information stored in the knowledge base.`,
+	Long: `Show a representation of the information stored in the knowledge base.
+If several sections are requested, they are combined into one document with
+the keys 'parameter', 'behavior', 'category' and 'relation'.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
@@ -50,22 +57,62 @@ var showCmd = &cobra.Command{
 			par = "*"
 		}
 
-		theThing, e := util.ParseThingFromFile(thing)
+		viper.BindPFlag("output", cmd.PersistentFlags().Lookup("output"))
+		output := viper.GetString("output")
+
+		viper.BindPFlag("template", cmd.PersistentFlags().Lookup("template"))
+		tmpl := viper.GetString("template")
+
+		thing, e := util.ResolveThingLocation(thing, context, false)
 		if e != nil {
-			log.Fatalf("Could not parse Thing from file: %s.\n", e)
+			log.Fatalf("Could not find the Thing: %s\n", e)
 		}
 
-		if beh != "" {
-			ShowBehavior(context, theThing, beh)
-		}
-		if cat {
-			ShowRelation(context, theThing, "is")
+		viper.BindPFlag("interpolate", cmd.PersistentFlags().Lookup("interpolate"))
+		interpolate := viper.GetBool("interpolate")
+
+		things, e := util.ParseThingsFromFile(thing)
+		if e != nil {
+			log.Fatalf("Could not parse Thing from file: %s.\n", e)
 		}
-		if rel != "" {
-			ShowRelation(context, theThing, rel)
+
+		var kb *util.KnowledgeBase
+		if interpolate {
+			// without a context only the own variables can be resolved
+			kb, _ = util.LoadKnowledgeBase(context)
 		}
-		if par != "" {
-			ShowParameter(context, theThing, par)
+
+		for i, theThing := range things {
+			if i > 0 && output == "yaml" {
+				fmt.Fprintln(cmd.OutOrStdout(), "---")
+			}
+			if interpolate {
+				ct := &util.ContextThing{Thing: theThing, Path: thing, Document: i + 1, Documents: len(things)}
+				theThing.Parameter, e = util.InterpolateParameters(kb, ct)
+				if e != nil {
+					log.Fatalf("Could not interpolate the parameters: %s", e)
+				}
+			}
+			data := make(map[string]interface{})
+			if beh != "" {
+				data["behavior"] = ShowBehavior(context, theThing, beh)
+			}
+			if cat {
+				data["category"] = ShowRelation(context, theThing, "is")
+			}
+			if rel != "" {
+				data["relation"] = ShowRelation(context, theThing, rel)
+			}
+			if par != "" {
+				data["parameter"], e = ShowParameter(context, theThing, par)
+				if e != nil {
+					log.Fatalf("Could not find the parameter: %s\n", e)
+				}
+			}
+			e = WriteShowOutput(cmd.OutOrStdout(), data, output, tmpl)
+			if e != nil {
+				log.Fatalf("Could not output the Thing: %s.\n", e)
+			}
 		}
 	},
 }
@@ -79,54 +126,94 @@ func init() {
 	// and all subcommands, e.g.:
 	// showCmd.PersistentFlags().String("foo", "", "A help for foo")
 
-	showCmd.PersistentFlags().StringP("thing", "t", "", "summarize the info for this thing")
+	showCmd.PersistentFlags().StringP("thing", "t", "", "summarize the info for this thing: a path ('file#n' or 'file#name' selects a document), UUID, name or name prefix")
 	showCmd.MarkPersistentFlagRequired("thing")
-	showCmd.PersistentFlags().StringP("parameters", "P", "", "display the values set in 'parameters' (default)")
+	showCmd.PersistentFlags().StringP("parameters", "P", "", "display the values set in 'parameters' (default), e.g. 'network.interfaces[0].ip', '*' or '[?(@.port > 80)]'")
 	showCmd.PersistentFlags().StringP("behavior", "B", "", "display the capabilities set in 'behaviour:'")
 	showCmd.PersistentFlags().BoolP("categories", "C", false, "display the category hierarchies set in 'relation:is'")
 	showCmd.PersistentFlags().StringP("relations", "R", "", "display the relations set in 'relation'")
+	showCmd.PersistentFlags().BoolP("interpolate", "I", false, "resolve the tsunki variables like '${port}' or '${thing:other.parameter.port}' in the parameters")
+	showCmd.PersistentFlags().StringP("output", "o", "yaml", "the output format: yaml, json, table or template")
+	showCmd.PersistentFlags().String("template", "", "the Go text/template to use with '--output template'")
 
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// showCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-func ShowBehavior(context string, theThing util.Thing, behavior string) {
-	fmt.Println("util.ShowBehavior(", context, ", theThing-struct, ", behavior, ") called")
-	var m []byte
+func ShowBehavior(context string, theThing util.Thing, behavior string) interface{} {
 	if behavior == "*" {
-		m, _ = util.Marshal(theThing.Behavior)
-	} else {
-		m, _ = util.Marshal(theThing.Behavior[behavior])
+		return theThing.Behavior
 	}
-	fmt.Println(string(m))
+	return theThing.Behavior[behavior]
 }
 
-func ShowParameter(context string, theThing util.Thing, parameter string) {
-	fmt.Println("util.ShowParameter(", context, ", theThing-struct, ", parameter, ") called")
-	var m []byte
+// The parameter may be a path into nested values, see util.QueryPath.
+func ShowParameter(context string, theThing util.Thing, parameter string) (interface{}, error) {
 	if parameter == "*" {
-		m, _ = util.Marshal(theThing.Parameter)
-	} else {
-		m, _ = util.Marshal(theThing.Parameter[parameter])
+		return theThing.Parameter, nil
+	}
+	p, err := util.ToGeneric(theThing.Parameter)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Println(string(m))
+	return util.QueryPath(p, parameter)
 }
 
-func ShowRelation(context string, theThing util.Thing, kind string) {
-	fmt.Println("util.ShowRelation(", context, ", theThing-struct, ", kind, ") called")
-	var m []byte
+func ShowRelation(context string, theThing util.Thing, kind string) interface{} {
 	if kind == "*" {
-		m, _ = util.Marshal(theThing.Relation)
-	} else {
-		var ls []util.ThingRelation
-		for i := range theThing.Relation {
-			l := theThing.Relation[i]
-			if (l.Kind == kind) || (kind == "is" && l.Kind == "") {
-				ls = append(ls, l)
-			}
+		return theThing.Relation
+	}
+	var ls []util.ThingRelation
+	for i := range theThing.Relation {
+		l := theThing.Relation[i]
+		if (l.Kind == kind) || (kind == "is" && l.Kind == "") {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+// WriteShowOutput writes the sections in the requested format. A single
+// section is written as is, several sections are combined by their names.
+func WriteShowOutput(w io.Writer, sections map[string]interface{}, output string, tmpl string) error {
+
+	var data interface{} = sections
+	if len(sections) == 1 {
+		for _, v := range sections {
+			data = v
+		}
+	}
+	data, err := util.ToGeneric(data)
+	if err != nil {
+		return err
+	}
+	switch output {
+	case "yaml":
+		m, err := util.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(m)
+		return err
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		f := util.Flatten(data)
+		for _, k := range util.SortedKeys(f) {
+			v := strings.ReplaceAll(fmt.Sprint(f[k]), "\n", "\\n")
+			fmt.Fprintf(tw, "%s\t%s\n", k, v)
+		}
+		return tw.Flush()
+	case "template":
+		t, err := template.New("show").Parse(tmpl)
+		if err != nil {
+			return err
 		}
-		m, _ = util.Marshal(ls)
+		return t.Execute(w, data)
 	}
-	fmt.Println(string(m))
+	return fmt.Errorf("Unknown output format '%s', use one of: yaml, json, table, template", output)
 }
@@ -15,10 +15,13 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
+	"gitlab.com/zwischenloesung/natem/util"
 )
 
 func init() {
@@ -75,3 +78,61 @@ func TestExecuteShowOptions(t *testing.T) {
 		t.Fatal("The show command should have failed as the required -t was missing in one call.")
 	}
 }
+
+func TestWriteShowOutput(t *testing.T) {
+	a, err := util.ParseThingFromFile("../util/testing/roundtrip.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ShowParameter("", a, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := map[string]interface{}{"parameter": p}
+	c := bytes.NewBufferString("")
+	err = WriteShowOutput(c, b, "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d map[string]interface{}
+	err = json.Unmarshal(c.Bytes(), &d)
+	if err != nil || d["alpha"] != "single" {
+		t.Fatalf("A single section should be written as valid JSON on its own, got: %s", c.String())
+	}
+	b["relation"] = ShowRelation("", a, "is")
+	c.Reset()
+	err = WriteShowOutput(c, b, "json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(c.Bytes(), &d)
+	if err != nil || d["parameter"] == nil || d["relation"] == nil {
+		t.Fatalf("Several sections should be combined into one document, got: %s", c.String())
+	}
+	c.Reset()
+	err = WriteShowOutput(c, b, "table", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(c.String(), "relation[0].thing_url") || !strings.Contains(c.String(), "A multi-line\\ndescription.") {
+		t.Fatalf("The table should list every value by its path, got: %s", c.String())
+	}
+	c.Reset()
+	err = WriteShowOutput(c, b, "template", "{{.parameter.zulu}}/{{(index .relation 0).kind}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != "1/is" {
+		t.Fatalf("The template was not applied correctly, got: %s", c.String())
+	}
+	c.Reset()
+	err = WriteShowOutput(c, b, "yaml", "")
+	if err != nil || strings.Contains(c.String(), "called") {
+		t.Fatalf("The YAML output should be clean, got: %s", c.String())
+	}
+	t.Log("Now failing successfully (unknown format):")
+	err = WriteShowOutput(c, b, "xml", "")
+	if err == nil {
+		t.Fatal("The format 'xml' is not supported.")
+	}
+}
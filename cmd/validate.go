@@ -14,6 +14,7 @@ package cmd
 
 import (
 	"log"
+	"strconv"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -54,7 +55,7 @@ func init() {
 	// and all subcommands, e.g.:
 	// validateCmd.PersistentFlags().String("foo", "", "A help for foo")
 
-	validateCmd.PersistentFlags().StringP("thing", "t", "", "the thing to be validated, either in URL or short form")
+	validateCmd.PersistentFlags().StringP("thing", "t", "", "the thing to be validated, either in URL or short form (UUID, name or name prefix)")
 	validateCmd.MarkPersistentFlagRequired("thing")
 	validateCmd.PersistentFlags().StringP("schema", "s", "", "the schema to use for validation against, either in URL or short form")
 	validateCmd.PersistentFlags().BoolP("context-less", "C", false, "validate a thing outside of any context")
@@ -73,6 +74,11 @@ func ValidateThing(contextPath string, hasContext bool, thingPath string, schema
 	if e != nil {
 		log.Fatalf("Invalid schema path due to this error: %s.\n", e)
 	}
+	thingPath, e = util.ResolveThingLocation(thingPath, contextPath, hasContext)
+	if e != nil {
+		log.Fatalf("Could not find the Thing: %s\n", e)
+	}
+	thingPath, fragment := util.SplitThingFragment(thingPath)
 	thingURLPath, e := util.GetThingURLPath(thingPath, contextPath, hasContext)
 	if e != nil {
 		log.Fatalf("Invalid Thing path due to this error: %s.\n", e)
@@ -81,17 +87,34 @@ func ValidateThing(contextPath string, hasContext bool, thingPath string, schema
 	if e != nil {
 		log.Fatalf("Invalid schema content due to this error: %s.\n", e)
 	}
-	thingBytes, e := util.ReadYAMLDocumentFromFile(thingURLPath)
+	documents, e := util.ReadYAMLDocumentsFromFile(thingURLPath)
 	if e != nil {
 		log.Fatalf("Invalid thing content due to this error: %s.\n", e)
 	}
-	r, e := util.ValidateThing(schemaBytes, thingBytes)
+	selected, e := util.SelectThingDocuments(documents, fragment)
 	if e != nil {
-		log.Fatalf("Could not validate the Thing due to this error: %s.\n", e)
+		log.Fatalf("Invalid thing content due to this error: %s.\n", e)
+	}
+	failed := 0
+	for i, thingBytes := range selected {
+		name := thingURLPath
+		if fragment != "" {
+			name += "#" + fragment
+		} else if len(documents) > 1 {
+			name += "#" + strconv.Itoa(i+1)
+		}
+		r, e := util.ValidateThing(schemaBytes, thingBytes)
+		if e != nil {
+			log.Fatalf("Could not validate the Thing %s due to this error: %s.\n", name, e)
+		}
+		if r {
+			log.Printf("The document %s was validated successfully against the schema.\n", name)
+		} else {
+			log.Printf("The document %s failed to validate against the schema.\n", name)
+			failed++
+		}
 	}
-	if r {
-		log.Printf("The document was validated successfully against the schema.\n")
-	} else {
-		log.Fatalf("The document failed to validate against the schema.\n")
+	if failed > 0 {
+		log.Fatalf("%d of %d documents failed to validate against the schema.\n", failed, len(selected))
 	}
 }
@@ -0,0 +1,123 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch the context and check the Things on changes",
+	Long: `Watch the context directory and re-read the files as they change. The
+Things in a changed file, and the Things referring to them, are validated
+against their schema and their relations and schemas are checked to point to
+something. The results are printed as they come, as text or as one JSON
+object per line.`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		viper.BindPFlag("context", rootCmd.PersistentFlags().Lookup("context"))
+		context := viper.GetString("context")
+
+		viper.BindPFlag("schema", cmd.PersistentFlags().Lookup("schema"))
+		schema := viper.GetString("schema")
+
+		viper.BindPFlag("output", cmd.PersistentFlags().Lookup("output"))
+		output := viper.GetString("output")
+
+		w, e := util.NewWatcher(context, schema)
+		if e != nil {
+			log.Fatalf("Could not watch the context: %s.\n", e)
+		}
+		defer w.Close()
+
+		events, _ := w.SubscribeAll()
+		stop := make(chan struct{})
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		go func() {
+			for ev := range events {
+				e := WriteWatchEvent(cmd.OutOrStdout(), ev, output)
+				if e != nil {
+					log.Fatalf("Could not write the diagnostics: %s.\n", e)
+				}
+			}
+		}()
+		w.Check()
+		e = w.Run(stop)
+		if e != nil {
+			log.Fatalf("Could not watch the context: %s.\n", e)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.PersistentFlags().StringP("schema", "s", "", "the schema to validate against if a thing does not name one")
+	watchCmd.PersistentFlags().StringP("output", "o", "text", "the output format: text or json")
+}
+
+// WriteWatchEvent writes the event as text, only mentioning the Things
+// with problems if no files changed, or as a line of JSON.
+func WriteWatchEvent(w io.Writer, ev util.WatchEvent, output string) error {
+
+	switch output {
+	case "json":
+		return json.NewEncoder(w).Encode(ev)
+	case "text":
+		if len(ev.Files) > 0 {
+			fmt.Fprintf(w, "changed: %s\n", strings.Join(ev.Files, ", "))
+		} else {
+			fmt.Fprintf(w, "checked %d Things\n", len(ev.Diagnostics))
+		}
+		if ev.Lost > 0 {
+			fmt.Fprintf(w, "  lost   %d events\n", ev.Lost)
+		}
+		for _, r := range ev.Removed {
+			fmt.Fprintf(w, "  gone   %s\n", r)
+		}
+		for _, e := range ev.Errors {
+			fmt.Fprintf(w, "  error  %s\n", e)
+		}
+		for _, d := range ev.Diagnostics {
+			if len(d.Problems) == 0 {
+				if len(ev.Files) > 0 {
+					fmt.Fprintf(w, "  ok     %s\n", d.Location)
+				}
+				continue
+			}
+			fmt.Fprintf(w, "  failed %s\n", d.Location)
+			for _, p := range d.Problems {
+				fmt.Fprintf(w, "         - %s\n", p)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown output format '%s', use one of: text, json", output)
+}
@@ -0,0 +1,80 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.com/zwischenloesung/natem/util"
+)
+
+// Test the basics...
+func TestExecuteWatchHelp(t *testing.T) {
+	a := bytes.NewBufferString("")
+	b := bytes.NewBufferString("")
+	rootCmd.SetOut(a)
+	rootCmd.SetArgs([]string{"help", "watch"})
+	rootCmd.Execute()
+	aOut, err := io.ReadAll(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"watch", "--help"})
+	rootCmd.Execute()
+	bOut, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(aOut) != string(bOut) {
+		t.Fatalf("expected the same output for `help` and `--help`, but got ...\n\"%s\"\n ... and ... \n\"%s\"", string(aOut), string(bOut))
+	}
+}
+
+func TestWriteWatchEvent(t *testing.T) {
+
+	a := util.WatchEvent{
+		Files:   []string{"web.yml"},
+		Removed: []string{"old.yml"},
+		Diagnostics: []util.Diagnostic{
+			{Location: "db.yml", Problems: []string{}},
+			{Location: "web.yml", Problems: []string{"relation 'old.yml': not found"}},
+		},
+	}
+	b := bytes.NewBufferString("")
+	if e := WriteWatchEvent(b, a, "text"); e != nil {
+		t.Fatal(e)
+	}
+	c := "changed: web.yml\n  gone   old.yml\n  ok     db.yml\n  failed web.yml\n         - relation 'old.yml': not found\n"
+	if b.String() != c {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", c, b.String())
+	}
+	b.Reset()
+	WriteWatchEvent(b, a, "json")
+	if strings.Count(b.String(), "\n") != 1 || !strings.Contains(b.String(), `"removed":["old.yml"]`) {
+		t.Fatalf("Expected one line of JSON, got %s.\n", b.String())
+	}
+	b.Reset()
+	WriteWatchEvent(b, util.WatchEvent{Lost: 3}, "text")
+	if b.String() != "checked 0 Things\n  lost   3 events\n" {
+		t.Fatalf("Expected the lost events to be mentioned, got %s.\n", b.String())
+	}
+	t.Log("Now failing successfully (unknown format):")
+	if WriteWatchEvent(b, a, "xml") == nil {
+		t.Fatal("Expected an error for an unknown format.")
+	}
+}
@@ -0,0 +1,571 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A ContextThing is a Thing together with the place it was found at.
+type ContextThing struct {
+	Thing
+	// the file path relative to the context
+	Path string
+	// the position of the document inside the file, starting with 1
+	Document  int
+	Documents int
+}
+
+// Location returns the path of the Thing, with the document number attached
+// if the file contains more than one document.
+func (ct *ContextThing) Location() string {
+	if ct.Documents > 1 {
+		return ct.Path + "#" + strconv.Itoa(ct.Document)
+	}
+	return ct.Path
+}
+
+// A KnowledgeBase contains all the Things found in a context.
+type KnowledgeBase struct {
+	ContextPath string
+	Things      []*ContextThing
+	// files or documents that could not be parsed
+	Errors []error
+
+	byUuid     map[string]*ContextThing
+	byName     map[string][]*ContextThing
+	byLocation map[string]*ContextThing
+	// only known if loaded from an index
+	words     map[string][]*ContextThing
+	backlinks map[*ContextThing][]*ContextThing
+	// the relations between the Things, see relationGraph
+	outgoing map[*ContextThing][]relationEdge
+	incoming map[*ContextThing][]relationEdge
+}
+
+func isThingFile(name string) bool {
+	return strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml")
+}
+
+// LoadKnowledgeBase walks the context directory and parses every document
+// of every YAML file as a Thing of its own. Hidden directories are skipped.
+// If the context has an index, only the files changed since are parsed.
+func LoadKnowledgeBase(context string) (*KnowledgeBase, error) {
+
+	contextPath, err := GetContextPath(context)
+	if err != nil {
+		return nil, err
+	}
+	// the index is only used once created, and only if it can be used
+	if _, err := os.Stat(IndexPath(contextPath)); err == nil {
+		if kb, err := loadIndexedKnowledgeBase(contextPath); err == nil {
+			return kb, nil
+		}
+	}
+	kb := &KnowledgeBase{ContextPath: contextPath}
+	err = walkThingFiles(contextPath, func(path string, rel string) error {
+		kb.Things = append(kb.Things, kb.loadFile(path, rel)...)
+		return nil
+	})
+	return kb, err
+}
+
+// Call the function for every Thing file in the context, skipping hidden
+// directories.
+func walkThingFiles(contextPath string, f func(path string, rel string) error) error {
+
+	return filepath.WalkDir(contextPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != contextPath && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isThingFile(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(contextPath, path)
+		if err != nil {
+			return err
+		}
+		return f(path, rel)
+	})
+}
+
+func (kb *KnowledgeBase) loadFile(path string, rel string) []*ContextThing {
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		kb.Errors = append(kb.Errors, fmt.Errorf("%s: %s", rel, err))
+		return nil
+	}
+	things, errs := parseThingFile(content, rel)
+	kb.Errors = append(kb.Errors, errs...)
+	return things
+}
+
+// Parse every document of the file content as a Thing of its own. Unlike
+// ParseThing no UUID is made up, a Thing without one keeps it empty.
+func parseThingFile(content []byte, rel string) ([]*ContextThing, []error) {
+
+	var things []*ContextThing
+	var errs []error
+	documents := SplitYAMLDocuments(content)
+	if len(documents) < 1 {
+		return things, []error{fmt.Errorf("%s: Unable to parse sensible data from file.", rel)}
+	}
+	for i, d := range documents {
+		var t Thing
+		err := Unmarshal(d, &t)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s#%d: %s", rel, i+1, err))
+			continue
+		}
+		things = append(things, &ContextThing{t, rel, i + 1, len(documents)})
+	}
+	return things, errs
+}
+
+// FilePath returns the absolute path of the file containing the Thing.
+func (kb *KnowledgeBase) FilePath(ct *ContextThing) string {
+	return filepath.Join(kb.ContextPath, ct.Path)
+}
+
+var ThingNotFoundError = errors.New("No Thing matches this reference.\n")
+
+// An AmbiguousThingError lists all the Things a reference could mean.
+type AmbiguousThingError struct {
+	Ref        string
+	Candidates []*ContextThing
+}
+
+func (e *AmbiguousThingError) Error() string {
+	var c []string
+	for _, ct := range e.Candidates {
+		c = append(c, fmt.Sprintf("  %s (%s, %s)", ct.Id.Name, ct.Location(), ct.Id.Uuid))
+	}
+	return fmt.Sprintf("The reference '%s' is ambiguous, candidates are:\n%s\n", e.Ref, strings.Join(c, "\n"))
+}
+
+// Build the lookup tables once.
+func (kb *KnowledgeBase) index() {
+
+	if kb.byUuid != nil {
+		return
+	}
+	kb.byUuid = make(map[string]*ContextThing)
+	kb.byName = make(map[string][]*ContextThing)
+	kb.byLocation = make(map[string]*ContextThing)
+	for _, ct := range kb.Things {
+		if ct.Id.Uuid != "" {
+			kb.byUuid[ct.Id.Uuid] = ct
+		}
+		if ct.Id.Name != "" {
+			kb.byName[ct.Id.Name] = append(kb.byName[ct.Id.Name], ct)
+		}
+		kb.byLocation[ct.Location()] = ct
+	}
+}
+
+/*
+	Resolve
+	  args
+		ref				a location relative to the context, a UUID
+						(with or without 'urn:uuid:'), an Id.Name or an
+						unambiguous prefix of an Id.Name
+	  returns
+		*ContextThing	the Thing found
+		error			ThingNotFoundError or an *AmbiguousThingError
+*/
+func (kb *KnowledgeBase) Resolve(ref string) (*ContextThing, error) {
+	return kb.resolve(ref, true)
+}
+
+// ResolveRelation is Resolve for the references stored in Things, e.g. in
+// 'thing_url', where a prefix of a name must not count, as a reference
+// that points nowhere would silently point to another Thing.
+func (kb *KnowledgeBase) ResolveRelation(ref string) (*ContextThing, error) {
+	return kb.resolve(ref, false)
+}
+
+func (kb *KnowledgeBase) resolve(ref string, prefix bool) (*ContextThing, error) {
+
+	if strings.TrimSpace(ref) == "" {
+		return nil, fmt.Errorf("empty reference: %w", ThingNotFoundError)
+	}
+	kb.index()
+	ref = kb.relativeLocation(ref)
+	if ct, ok := kb.byLocation[strings.TrimPrefix(ref, "./")]; ok {
+		return ct, nil
+	}
+	u := ref
+	if !strings.HasPrefix(u, "urn:uuid:") {
+		u = "urn:uuid:" + u
+	}
+	if ct, ok := kb.byUuid[u]; ok {
+		return ct, nil
+	}
+	candidates := kb.byName[ref]
+	if len(candidates) == 0 && prefix {
+		for n, cts := range kb.byName {
+			if strings.HasPrefix(n, ref) {
+				candidates = append(candidates, cts...)
+			}
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	} else if len(candidates) > 1 {
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Location() < candidates[j].Location()
+		})
+		return nil, &AmbiguousThingError{ref, candidates}
+	}
+	return nil, fmt.Errorf("%s: %w", ref, ThingNotFoundError)
+}
+
+// ResolveThingLocation turns the reference into the path of the file, with
+// the document selector attached if needed. An existing file is taken as it
+// is, everything else is looked up in the knowledge base of the context.
+func ResolveThingLocation(ref string, context string, hasContext bool) (string, error) {
+
+	path, fragment := SplitThingFragment(ref)
+	p, err := GetThingURLPath(path, context, hasContext)
+	if err == UrlThingOutsideContextError {
+		return ref, err
+	} else if err == nil {
+		if _, err = os.Stat(p); err == nil {
+			if fragment != "" {
+				p += "#" + fragment
+			}
+			return p, nil
+		}
+	}
+	kb, err := LoadKnowledgeBase(context)
+	if err != nil {
+		return ref, err
+	}
+	ct, err := kb.Resolve(ref)
+	if err != nil {
+		return ref, err
+	}
+	p = kb.FilePath(ct)
+	if ct.Documents > 1 {
+		p += "#" + strconv.Itoa(ct.Document)
+	}
+	return p, nil
+}
+
+// Turn absolute paths and file URLs inside the context into locations.
+func (kb *KnowledgeBase) relativeLocation(ref string) string {
+
+	path, fragment := SplitThingFragment(ref)
+	if !strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "file://") {
+		return ref
+	}
+	p, err := GetThingURLPath(path, "file://"+kb.ContextPath, true)
+	if err != nil {
+		return ref
+	}
+	rel, err := filepath.Rel(kb.ContextPath, p)
+	if err != nil {
+		return ref
+	}
+	if fragment != "" {
+		rel += "#" + fragment
+	}
+	return rel
+}
+
+// Backlinks returns all the Things with a relation pointing to the Thing.
+func (kb *KnowledgeBase) Backlinks(ct *ContextThing) []*ContextThing {
+
+	if kb.backlinks != nil {
+		return append([]*ContextThing{}, kb.backlinks[ct]...)
+	}
+	var r []*ContextThing
+	for _, o := range kb.Things {
+		for _, l := range o.Relation {
+			if t, err := kb.ResolveRelation(l.ThingUrl); err == nil && t == ct {
+				r = append(r, o)
+				break
+			}
+		}
+	}
+	return r
+}
+
+// Search returns the Things containing all the words of the query in their
+// location, id, parameters or behaviors, ignoring the case.
+func (kb *KnowledgeBase) Search(query string) []*ContextThing {
+
+	var r []*ContextThing
+	words := strings.Fields(strings.ToLower(query))
+	if kb.words != nil {
+		return kb.searchWords(words)
+	}
+	for _, ct := range kb.Things {
+		text := strings.ToLower(searchText(ct))
+		found := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				found = false
+				break
+			}
+		}
+		if found {
+			r = append(r, ct)
+		}
+	}
+	return r
+}
+
+// The words of the query have no spaces, so they are found inside the
+// words of the index.
+func (kb *KnowledgeBase) searchWords(words []string) []*ContextThing {
+
+	found := make(map[*ContextThing]int)
+	for _, w := range words {
+		matched := make(map[*ContextThing]bool)
+		for iw, cts := range kb.words {
+			if strings.Contains(iw, w) {
+				for _, ct := range cts {
+					matched[ct] = true
+				}
+			}
+		}
+		for ct := range matched {
+			found[ct]++
+		}
+	}
+	var r []*ContextThing
+	for _, ct := range kb.Things {
+		if found[ct] == len(words) {
+			r = append(r, ct)
+		}
+	}
+	return r
+}
+
+func searchText(ct *ContextThing) string {
+
+	text := []string{ct.Location(), ct.Id.Uuid, ct.Id.Name, ct.Id.Version}
+	for _, m := range []map[string]interface{}{ct.Parameter, ct.Behavior} {
+		g, err := ToGeneric(m)
+		if err != nil {
+			continue
+		}
+		for k, v := range Flatten(g) {
+			text = append(text, k, fmt.Sprint(v))
+		}
+	}
+	return strings.Join(text, "\n")
+}
+
+// ReadDocument returns the YAML document the Thing was parsed from.
+func (kb *KnowledgeBase) ReadDocument(ct *ContextThing) ([]byte, error) {
+
+	documents, err := ReadYAMLDocumentsFromFile(kb.FilePath(ct))
+	if err != nil {
+		return nil, err
+	}
+	if ct.Document < 1 || ct.Document > len(documents) {
+		return nil, fmt.Errorf("%s: the document is gone.\n", ct.Location())
+	}
+	return documents[ct.Document-1], nil
+}
+
+// ValidateContextThing validates the Thing against its own schema, or the
+// one given if it does not name any, and returns the problems found.
+func (kb *KnowledgeBase) ValidateContextThing(ct *ContextThing, schema string) ([]string, error) {
+
+	context := "file://" + kb.ContextPath
+	schemaPath, err := GetThingSchemaPath(&ct.Thing, context)
+	if err != nil {
+		return nil, err
+	}
+	if schemaPath == "" && schema != "" {
+		schemaPath, err = GetThingURLPath(schema, context, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if schemaPath == "" {
+		return nil, errors.New("There is no schema to validate against.\n")
+	}
+	schemaBytes, err := ReadYAMLDocumentFromFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	d, err := kb.ReadDocument(ct)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateThingProblems(schemaBytes, d)
+}
+
+// DeleteThing removes the Thing from its file, or the whole file if it
+// contains nothing else.
+func (kb *KnowledgeBase) DeleteThing(ct *ContextThing) error {
+
+	path := kb.FilePath(ct)
+	documents, err := ReadYAMLDocumentsFromFile(path)
+	if err != nil {
+		return err
+	}
+	if len(documents) < 2 {
+		return os.Remove(path)
+	}
+	if ct.Document < 1 || ct.Document > len(documents) {
+		return fmt.Errorf("%s: the document is gone.\n", ct.Location())
+	}
+	documents = append(documents[:ct.Document-1], documents[ct.Document:]...)
+	return ReplaceFile(path, JoinYAMLDocuments(documents))
+}
+
+// Parents returns the Things this Thing 'is', in the order of the
+// relations. Relations without kind count as 'is'.
+func (kb *KnowledgeBase) Parents(ct *ContextThing) []*ContextThing {
+
+	var r []*ContextThing
+	for _, l := range ct.Relation {
+		if l.Kind != "is" && l.Kind != "" {
+			continue
+		}
+		if p, err := kb.ResolveRelation(l.ThingUrl); err == nil && p != ct {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+// Children returns the Things that directly are this Thing.
+func (kb *KnowledgeBase) Children(ct *ContextThing) []*ContextThing {
+
+	var r []*ContextThing
+	for _, o := range kb.Things {
+		for _, p := range kb.Parents(o) {
+			if p == ct {
+				r = append(r, o)
+				break
+			}
+		}
+	}
+	return r
+}
+
+// Descendants returns the Things that are the Thing, directly or through
+// others, following the 'is' relations, each once.
+func (kb *KnowledgeBase) Descendants(ct *ContextThing) []*ContextThing {
+
+	var r []*ContextThing
+	seen := map[*ContextThing]bool{ct: true}
+	queue := []*ContextThing{ct}
+	for len(queue) > 0 {
+		for _, c := range kb.Children(queue[0]) {
+			if !seen[c] {
+				seen[c] = true
+				r = append(r, c)
+				queue = append(queue, c)
+			}
+		}
+		queue = queue[1:]
+	}
+	return r
+}
+
+// SortedThings returns the Things ordered by their location.
+func (kb *KnowledgeBase) SortedThings() []*ContextThing {
+
+	r := append([]*ContextThing{}, kb.Things...)
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Location() < r[j].Location()
+	})
+	return r
+}
+
+/*
+	ReloadFile
+	  args
+		rel				the path of the file relative to the context, the
+						file may be gone
+	  returns
+		[]*ContextThing	the Things that were in the file before
+		[]*ContextThing	the Things that are in the file now
+*/
+func (kb *KnowledgeBase) ReloadFile(rel string) ([]*ContextThing, []*ContextThing) {
+
+	var old []*ContextThing
+	var things []*ContextThing
+	for _, ct := range kb.Things {
+		if ct.Path == rel {
+			old = append(old, ct)
+		} else {
+			things = append(things, ct)
+		}
+	}
+	var errs []error
+	for _, e := range kb.Errors {
+		if !strings.HasPrefix(e.Error(), rel+":") && !strings.HasPrefix(e.Error(), rel+"#") {
+			errs = append(errs, e)
+		}
+	}
+	kb.Errors = errs
+	var loaded []*ContextThing
+	path := filepath.Join(kb.ContextPath, rel)
+	if _, err := os.Stat(path); err == nil {
+		loaded = kb.loadFile(path, rel)
+	}
+	kb.Things = append(things, loaded...)
+	kb.byUuid = nil
+	kb.words = nil
+	kb.backlinks = nil
+	kb.outgoing = nil
+	kb.incoming = nil
+	return old, loaded
+}
+
+// CheckLinks returns the relations and schemas of the Thing that do not
+// point to anything.
+func (kb *KnowledgeBase) CheckLinks(ct *ContextThing) []string {
+
+	var problems []string
+	for _, l := range ct.Relation {
+		if _, err := kb.ResolveRelation(l.ThingUrl); err != nil {
+			problems = append(problems, fmt.Sprintf("relation '%s': %s", l.ThingUrl, strings.TrimSpace(err.Error())))
+		}
+	}
+	for _, s := range ct.Schema {
+		if s.NameUrl == nil || s.Url == "" {
+			continue
+		}
+		p, err := GetThingURLPath(s.Url, "file://"+kb.ContextPath, false)
+		if err == nil {
+			_, err = os.Stat(p)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("schema '%s': %s", s.Url, strings.TrimSpace(err.Error())))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,177 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Copy a context of testing/contexts to a directory of its own, for the
+// test to change as it likes.
+func testContext(t *testing.T, name string) string {
+
+	d := t.TempDir()
+	src := filepath.Join("testing", "contexts", name)
+	err := filepath.WalkDir(src, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return os.MkdirAll(filepath.Join(d, rel), 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(d, rel), content, 0644)
+	})
+	if err != nil {
+		t.Fatalf("Could not copy the context '%s': %s.\n", name, err)
+	}
+	return d
+}
+
+func TestLoadKnowledgeBase(t *testing.T) {
+
+	d := t.TempDir()
+	c, e := os.ReadFile("testing/multi.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	os.MkdirAll(filepath.Join(d, "sub"), 0755)
+	os.MkdirAll(filepath.Join(d, ".hidden"), 0755)
+	os.WriteFile(filepath.Join(d, "sub", "multi.yml"), c, 0644)
+	os.WriteFile(filepath.Join(d, ".hidden", "multi.yml"), c, 0644)
+	os.WriteFile(filepath.Join(d, "single.yaml"), []byte("id:\n  name: single\n"), 0644)
+	os.WriteFile(filepath.Join(d, "notes.txt"), []byte("no thing"), 0644)
+
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatalf("Error loading the knowledge base: %s.\n", e)
+	}
+	if len(kb.Things) != 4 {
+		t.Fatalf("Expected 4 Things, got %d.\n", len(kb.Things))
+	}
+	for _, a := range kb.Things {
+		if a.Id.Name == "second" && a.Location() != "sub/multi.yml#2" {
+			t.Fatalf("Wrong location for the second document: %s.\n", a.Location())
+		}
+		if a.Id.Name == "single" && a.Location() != "single.yaml" {
+			t.Fatalf("Wrong location for a single document: %s.\n", a.Location())
+		}
+	}
+	t.Log("Now failing successfully (remote context):")
+	_, e = LoadKnowledgeBase("https://example.org/foo")
+	if e == nil {
+		t.Fatal("Remote contexts can not be loaded..")
+	}
+}
+
+func TestResolve(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: webserver\n  uuid: urn:uuid:1234\n"), 0644)
+	os.WriteFile(filepath.Join(d, "web2.yml"), []byte("id:\n  name: webcache\n"), 0644)
+	os.WriteFile(filepath.Join(d, "db.yml"), []byte("id:\n  name: database\n---\nid:\n  name: database-replica\n"), 0644)
+	kb, e := LoadKnowledgeBase(d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	tests := map[string]string{
+		"web.yml":          "web.yml",
+		"urn:uuid:1234":    "web.yml",
+		"1234":             "web.yml",
+		"webcache":         "web2.yml",
+		"webs":             "web.yml",
+		"database":         "db.yml#1",
+		"database-r":       "db.yml#2",
+		"db.yml#2":         "db.yml#2",
+		"database-replica": "db.yml#2",
+	}
+	for r, l := range tests {
+		a, e := kb.Resolve(r)
+		if e != nil {
+			t.Fatalf("Resolving '%s' failed: %s.\n", r, e)
+		}
+		if a.Location() != l {
+			t.Fatalf("Resolving '%s' returned %s instead of %s.\n", r, a.Location(), l)
+		}
+	}
+	t.Log("Now failing successfully (ambiguous and unknown references):")
+	_, e = kb.Resolve("web")
+	var ae *AmbiguousThingError
+	if !errors.As(e, &ae) || len(ae.Candidates) != 2 || !strings.Contains(e.Error(), "web2.yml") {
+		t.Fatalf("The reference should have been ambiguous: %s.\n", e)
+	}
+	t.Logf("got the expected error: %s", e)
+	_, e = kb.Resolve("nothing")
+	if !errors.Is(e, ThingNotFoundError) {
+		t.Fatalf("The reference should not have been found: %s.\n", e)
+	}
+	for _, r := range []string{"", " ", "urn:uuid:"} {
+		if _, e = kb.Resolve(r); !errors.Is(e, ThingNotFoundError) {
+			t.Fatalf("The empty reference '%s' should not have been found: %v.\n", r, e)
+		}
+	}
+	if _, e = kb.ResolveRelation("webs"); !errors.Is(e, ThingNotFoundError) {
+		t.Fatalf("A relation must not resolve a prefix of a name: %v.\n", e)
+	}
+	if b, e := kb.ResolveRelation("webcache"); e != nil || b.Location() != "web2.yml" {
+		t.Fatalf("A relation should resolve the exact name: %v.\n", e)
+	}
+	a, e := ResolveThingLocation("webcache", "file://"+d, true)
+	if e != nil || a != filepath.Join(d, "web2.yml") {
+		t.Fatalf("The location was not resolved: %s %s.\n", a, e)
+	}
+	a, e = ResolveThingLocation("db.yml#2", "file://"+d, true)
+	if e != nil || a != filepath.Join(d, "db.yml")+"#2" {
+		t.Fatalf("The existing file should have been taken as it is: %s %s.\n", a, e)
+	}
+}
+
+func TestReloadFile(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "a.yml"), []byte("id:\n  name: a\nrelation:\n  - thing_url: b.yml\nschema:\n  - url: schema.yml\n"), 0644)
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	a := kb.Things[0]
+	if len(kb.CheckLinks(a)) != 2 {
+		t.Fatalf("Expected the relation and the schema to be broken: %v.\n", kb.CheckLinks(a))
+	}
+	os.WriteFile(filepath.Join(d, "b.yml"), []byte("---\nid:\n  name: b1\n---\nid:\n  name: b2\n"), 0644)
+	b, c := kb.ReloadFile("b.yml")
+	if len(b) != 0 || len(c) != 2 || len(kb.Things) != 3 {
+		t.Fatalf("Expected two new Things, got %d old, %d new.\n", len(b), len(c))
+	}
+	if _, e = kb.Resolve("b2"); e != nil {
+		t.Fatalf("Expected to find the new Thing: %s.\n", e)
+	}
+	os.Remove(filepath.Join(d, "b.yml"))
+	b, c = kb.ReloadFile("b.yml")
+	if len(b) != 2 || len(c) != 0 || len(kb.Things) != 1 {
+		t.Fatalf("Expected two Things gone, got %d old, %d new.\n", len(b), len(c))
+	}
+}
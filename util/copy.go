@@ -0,0 +1,169 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// The value of the key in a mapping node, nil if there is none.
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// Set the value of the key in a mapping node, the key is appended if new.
+func setMappingValue(n *yamlv3.Node, key string, value *yamlv3.Node) {
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			value.HeadComment = n.Content[i+1].HeadComment
+			value.LineComment = n.Content[i+1].LineComment
+			n.Content[i+1] = value
+			return
+		}
+	}
+	k := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}
+	n.Content = append(n.Content, k, value)
+}
+
+func deleteMappingKey(n *yamlv3.Node, key string) {
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// The mapping node at the key, created if missing or empty.
+func mappingNode(n *yamlv3.Node, key string) *yamlv3.Node {
+
+	v := mappingValue(n, key)
+	if v == nil || v.Kind != yamlv3.MappingNode {
+		v = &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		setMappingValue(n, key, v)
+	}
+	return v
+}
+
+// Append a mapping of strings to the sequence at the key, the sequence is
+// created if missing or empty.
+func appendToSequence(n *yamlv3.Node, key string, entry [][2]string) {
+
+	v := mappingValue(n, key)
+	if v == nil || v.Kind != yamlv3.SequenceNode {
+		v = &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		setMappingValue(n, key, v)
+	}
+	e := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	for _, f := range entry {
+		setMappingValue(e, f[0], &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: f[1]})
+	}
+	v.Content = append(v.Content, e)
+}
+
+/*
+	DeriveThingDocument
+	  args
+		content		the document of the Thing to derive from
+		source		the location of that Thing, to add a 'derived_from'
+					relation, or empty
+		author		the name of the author of the new Thing, or empty
+		date		the date the author is added with
+	  returns
+		[]byte		the document with a new UUID, without the version and
+					the URLs of the original, but otherwise unchanged
+		Thing		the new Thing
+*/
+func DeriveThingDocument(content []byte, source string, author string, date string) ([]byte, Thing, error) {
+
+	var t Thing
+	doc, err := ParseThingDocument(content)
+	if err != nil {
+		return nil, t, err
+	}
+	m := doc.root.Content[0]
+	if m.Kind != yamlv3.MappingNode {
+		return nil, t, errors.New("The Thing is not a mapping.\n")
+	}
+	id := mappingNode(m, "id")
+	t.GenId()
+	setMappingValue(id, "uuid", &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: t.Id.Uuid})
+	deleteMappingKey(id, "version")
+	deleteMappingKey(id, "url")
+	if source != "" {
+		appendToSequence(m, "relation", [][2]string{{"thing_url", source}, {"kind", "derived_from"}})
+	}
+	if author != "" {
+		appendToSequence(mappingNode(m, "legal"), "author", [][2]string{{"name", author}, {"date", date}})
+	}
+	b, err := doc.encode()
+	if err != nil {
+		return nil, t, err
+	}
+	err = Unmarshal(b, &t)
+	return b, t, err
+}
+
+/*
+	CopyThing
+	  args
+		ct			the Thing to copy
+		to			the path of the new file, relative to the context
+		derived		whether to add a 'derived_from' relation to the
+					original
+		author		the name of the author to add, or empty
+		date		the date the author is added with
+	  returns
+		Thing		the new Thing, written to its own file, comments and
+					style of the original are kept
+*/
+func (kb *KnowledgeBase) CopyThing(ct *ContextThing, to string, derived bool, author string, date string) (Thing, error) {
+
+	var t Thing
+	to, err := ContextRelativePath(to)
+	if err != nil {
+		return t, err
+	}
+	content, err := kb.ReadDocument(ct)
+	if err != nil {
+		return t, err
+	}
+	source := ""
+	if derived {
+		source = ct.Location()
+	}
+	content, t, err = DeriveThingDocument(content, source, author, date)
+	if err != nil {
+		return t, err
+	}
+	if !isThingFile(to) {
+		return t, errors.New("Not a Thing file, use '.yml' or '.yaml'.\n")
+	}
+	dir, file, err := prepareThingFile(to, "file://"+kb.ContextPath, true, false)
+	if err != nil {
+		return t, err
+	}
+	return t, os.WriteFile(filepath.Join(dir, file), JoinYAMLDocuments([][]byte{content}), 0644)
+}
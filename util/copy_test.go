@@ -0,0 +1,82 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeriveThingDocument(t *testing.T) {
+
+	a := []byte("# the web server\nid:\n  uuid: urn:uuid:2222\n  name: web\n  version: \"3\"\n  url:\n    - web.yml\nrelation:\n  - thing_url: server.yml\nlegal:\n  author:\n    - name: Alice\n      date: \"2020-01-01\"\n")
+	b, c, e := DeriveThingDocument(a, "web.yml", "Bob", "2021-06-01")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if c.Id.Uuid == "urn:uuid:2222" || !strings.HasPrefix(c.Id.Uuid, "urn:uuid:") {
+		t.Fatalf("Expected a new UUID, got '%s'.\n", c.Id.Uuid)
+	}
+	d := "# the web server\nid:\n  uuid: " + c.Id.Uuid + "\n  name: web\nrelation:\n  - thing_url: server.yml\n  - thing_url: web.yml\n    kind: derived_from\nlegal:\n  author:\n    - name: Alice\n      date: \"2020-01-01\"\n    - name: Bob\n      date: \"2021-06-01\"\n"
+	if string(b) != d {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", d, b)
+	}
+	// the sections are created if missing
+	b, c, e = DeriveThingDocument([]byte("parameter:\n  port: 80\n"), "web.yml", "Bob", "2021-06-01")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(c.Relation) != 1 || c.Relation[0].Kind != "derived_from" || len(c.Legal.Author) != 1 || c.Legal.Author[0].Name != "Bob" {
+		t.Fatalf("Expected the relation and the author to be added ...\n%s", b)
+	}
+	t.Log("Now failing successfully (not a mapping):")
+	if _, _, e = DeriveThingDocument([]byte("- a\n- b\n"), "", "", ""); e == nil {
+		t.Fatal("Expected an error for a list.\n")
+	}
+}
+
+func TestCopyThing(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("---\nid:\n  uuid: urn:uuid:1111\n  name: db\n---\nid:\n  uuid: urn:uuid:2222\n  name: web\nparameter:\n  port: 80\n"), 0644)
+	kb, _ := LoadKnowledgeBase("file://" + d)
+	ct, _ := kb.Resolve("web")
+	a, e := kb.CopyThing(ct, "copies/web.yml", true, "", "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	kb, _ = LoadKnowledgeBase("file://" + d)
+	b, e := kb.Resolve("copies/web.yml")
+	if e != nil || b.Id.Uuid != a.Id.Uuid || b.Parameter["port"] != 80.0 {
+		t.Fatalf("Expected the copy to be found: %v %v.\n", b, e)
+	}
+	if c, e := kb.Resolve(b.Relation[0].ThingUrl); e != nil || c.Id.Uuid != "urn:uuid:2222" {
+		t.Fatalf("Expected the copy to be derived from the original: %v %v.\n", c, e)
+	}
+	t.Log("Now failing successfully (the target exists):")
+	if _, e = kb.CopyThing(ct, "web.yml", false, "", ""); e == nil {
+		t.Fatal("Expected an error for an existing target.\n")
+	}
+	t.Log("Now failing successfully (outside the context):")
+	for _, f := range []string{"../web.yml", "copies/../../web.yml", filepath.Join(filepath.Dir(d), "web.yml")} {
+		if _, e = kb.CopyThing(ct, f, false, "", ""); !errors.Is(e, UrlThingOutsideContextError) {
+			t.Fatalf("Expected '%s' to be refused: %v.\n", f, e)
+		}
+	}
+	if _, e = os.Stat(filepath.Join(filepath.Dir(d), "web.yml")); !os.IsNotExist(e) {
+		t.Fatal("Nothing should have been written outside the context.\n")
+	}
+}
@@ -0,0 +1,501 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The columns of a table that are not parameters.
+var csvIdColumns = []string{"location", "uuid", "name"}
+
+func isCSVIdColumn(c string) bool {
+	for _, i := range csvIdColumns {
+		if c == i {
+			return true
+		}
+	}
+	return false
+}
+
+// The text of a cell, strings as they are, everything else as JSON.
+func csvCell(v interface{}) string {
+
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+/*
+	ExportCSV
+	  args
+		w			the writer to write the table to
+		things		the Things, a row each
+		comma		the separator, ',' for CSV or '\t' for TSV
+	  The columns are the location, the UUID and the name, followed by
+	  the parameters flattened, e.g. 'network.interfaces[0].ip', in a
+	  stable order.
+*/
+func ExportCSV(w io.Writer, things []*ContextThing, comma rune) error {
+
+	columns := make(map[string]interface{})
+	var rows []map[string]interface{}
+	for _, ct := range things {
+		g, err := ToGeneric(ct.Parameter)
+		if err != nil {
+			return err
+		}
+		f := Flatten(g)
+		// no parameters at all
+		delete(f, "")
+		for k := range f {
+			columns[k] = true
+		}
+		rows = append(rows, f)
+	}
+	header := append([]string{}, csvIdColumns...)
+	for _, k := range SortedKeys(columns) {
+		if !isCSVIdColumn(k) {
+			header = append(header, k)
+		}
+	}
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for i, ct := range things {
+		record := []string{ct.Location(), ct.Id.Uuid, ct.Id.Name}
+		for _, k := range header[len(csvIdColumns):] {
+			record = append(record, csvCell(rows[i][k]))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// How the rows of a table are turned into Things.
+type CSVImportOptions struct {
+	// the separator, ',' for CSV or '\t' for TSV
+	Comma rune
+	// the directory in the context for the new Things without location
+	Out string
+	// the schema to coerce the values by, instead of the Things' own
+	Schema string
+}
+
+// A CSVImportResult tells what happened to a record of the table.
+type CSVImportResult struct {
+	// the number of the record, starting with 1 for the header; a quoted
+	// cell spanning several lines is still one record
+	Record   int
+	Location string
+	// one of: created, updated, unchanged
+	Action string
+}
+
+// A CSVRowError is a record that could not be imported.
+type CSVRowError struct {
+	Record int
+	Err    error
+}
+
+func (e *CSVRowError) Error() string {
+	return fmt.Sprintf("record %d: %s", e.Record, strings.TrimSpace(e.Err.Error()))
+}
+
+func (e *CSVRowError) Unwrap() error {
+	return e.Err
+}
+
+// The JSON type the schema gives the parameter at the path, empty if
+// unknown.
+func schemaParameterType(schema interface{}, p string) string {
+
+	steps, err := parsePath(p)
+	if err != nil {
+		return ""
+	}
+	s, _ := schema.(map[string]interface{})
+	props, _ := s["properties"].(map[string]interface{})
+	s, _ = props["parameter"].(map[string]interface{})
+	for _, step := range steps {
+		if s == nil {
+			return ""
+		}
+		switch step.kind {
+		case "key":
+			props, _ := s["properties"].(map[string]interface{})
+			if n, ok := props[step.key].(map[string]interface{}); ok {
+				s = n
+			} else {
+				s, _ = s["additionalProperties"].(map[string]interface{})
+			}
+		case "index":
+			s, _ = s["items"].(map[string]interface{})
+		default:
+			return ""
+		}
+	}
+	switch t := s["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, e := range t {
+			if n, ok := e.(string); ok && n != "null" {
+				return n
+			}
+		}
+	}
+	return ""
+}
+
+// The JSON type of a value already set.
+func valueType(v interface{}) string {
+
+	switch v.(type) {
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return ""
+}
+
+// CoerceCSVValue turns the text of a cell into a value of the JSON type,
+// into a string if the type is unknown.
+func CoerceCSVValue(cell string, jsonType string) (interface{}, error) {
+
+	switch jsonType {
+	case "integer":
+		i, err := strconv.ParseInt(strings.TrimSpace(cell), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an integer", cell)
+		}
+		return float64(i), nil
+	case "number":
+		f, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a number", cell)
+		}
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(strings.TrimSpace(cell))
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a boolean", cell)
+		}
+		return b, nil
+	case "array", "object":
+		var v interface{}
+		if err := json.Unmarshal([]byte(cell), &v); err != nil || valueType(v) != jsonType {
+			return nil, fmt.Errorf("'%s' is not a JSON %s", cell, jsonType)
+		}
+		return v, nil
+	}
+	return cell, nil
+}
+
+// Set the value at the path, creating the maps and lists on the way.
+func setPathValue(data interface{}, steps []pathStep, v interface{}) (interface{}, error) {
+
+	if len(steps) == 0 {
+		return v, nil
+	}
+	s := steps[0]
+	switch s.kind {
+	case "key":
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			if data != nil {
+				return nil, fmt.Errorf("'%s' is not a map", strings.TrimPrefix(s.text, "."))
+			}
+			m = make(map[string]interface{})
+		}
+		n, err := setPathValue(m[s.key], steps[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		m[s.key] = n
+		return m, nil
+	case "index":
+		l, ok := data.([]interface{})
+		if !ok && data != nil {
+			return nil, fmt.Errorf("'%s' is not a list", s.text)
+		}
+		if s.index < 0 {
+			return nil, fmt.Errorf("'%s' is not a position", s.text)
+		}
+		for len(l) <= s.index {
+			l = append(l, nil)
+		}
+		n, err := setPathValue(l[s.index], steps[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		l[s.index] = n
+		return l, nil
+	}
+	return nil, fmt.Errorf("'%s' can not be set", s.text)
+}
+
+var csvNameSlug = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type csvImporter struct {
+	kb      *KnowledgeBase
+	opts    CSVImportOptions
+	schemas map[string]interface{}
+}
+
+// The schema for the Thing, nil if there is none.
+func (ci *csvImporter) schema(t *Thing) (interface{}, error) {
+
+	p := ci.opts.Schema
+	if p == "" {
+		var err error
+		p, err = GetThingSchemaPath(t, "file://"+ci.kb.ContextPath)
+		if err != nil || p == "" {
+			return nil, err
+		}
+	}
+	if s, ok := ci.schemas[p]; ok {
+		return s, nil
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var s interface{}
+	if err = Unmarshal(content, &s); err != nil {
+		return nil, err
+	}
+	ci.schemas[p] = s
+	return s, nil
+}
+
+// Find the Thing of the row by its UUID, which must be known, or without
+// one by its exact name and else by its location.
+func (ci *csvImporter) match(uuid string, name string, location string) (*ContextThing, error) {
+
+	ci.kb.index()
+	if uuid != "" {
+		if !strings.HasPrefix(uuid, "urn:uuid:") {
+			uuid = "urn:uuid:" + uuid
+		}
+		if ct, ok := ci.kb.byUuid[uuid]; ok {
+			return ct, nil
+		}
+		return nil, fmt.Errorf("Unknown UUID '%s'.\n", uuid)
+	}
+	switch cts := ci.kb.byName[name]; len(cts) {
+	case 0:
+	case 1:
+		return cts[0], nil
+	default:
+		for _, ct := range cts {
+			if ct.Location() == location {
+				return ct, nil
+			}
+		}
+		return nil, &AmbiguousThingError{name, cts}
+	}
+	return ci.kb.byLocation[location], nil
+}
+
+func (ci *csvImporter) row(header []string, record []string) (string, string, error) {
+
+	cells := make(map[string]string)
+	for i, c := range header {
+		if i < len(record) {
+			cells[c] = record[i]
+		}
+	}
+	uuid, name := strings.TrimSpace(cells["uuid"]), strings.TrimSpace(cells["name"])
+	location := strings.TrimSpace(cells["location"])
+	if uuid == "" && name == "" && location == "" {
+		return "", "", errors.New("Neither a UUID, a name nor a location to find the Thing by.\n")
+	}
+	ct, err := ci.match(uuid, name, location)
+	if err != nil {
+		return "", "", err
+	}
+	var t Thing
+	if ct != nil {
+		t = ct.Thing
+		location = ct.Location()
+	} else {
+		if location == "" {
+			if name == "" {
+				return "", "", errors.New("A new Thing needs a name or a location.\n")
+			}
+			location = path.Join(filepath.ToSlash(ci.opts.Out), csvNameSlug.ReplaceAllString(name, "_")+".yml")
+		}
+		t.Id.Name = name
+	}
+	g, err := ToGeneric(t.Parameter)
+	if err != nil {
+		return "", "", err
+	}
+	old, _ := ToGeneric(g)
+	schema, err := ci.schema(&t)
+	if err != nil {
+		return "", "", fmt.Errorf("schema: %s", err)
+	}
+	for _, c := range header {
+		if isCSVIdColumn(c) || cells[c] == "" {
+			continue
+		}
+		steps, err := parsePath(c)
+		if err != nil {
+			return "", "", fmt.Errorf("column '%s': %s", c, err)
+		}
+		jsonType := schemaParameterType(schema, c)
+		if jsonType == "" {
+			current, _ := QueryPath(g, c)
+			jsonType = valueType(current)
+		}
+		v, err := CoerceCSVValue(cells[c], jsonType)
+		if err == nil {
+			g, err = setPathValue(g, steps, v)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("column '%s': %s", c, err)
+		}
+	}
+	if ct != nil && reflect.DeepEqual(old, g) {
+		return location, "unchanged", nil
+	}
+	j, err := json.Marshal(g)
+	if err == nil {
+		t.Parameter = nil
+		err = json.Unmarshal(j, &t.Parameter)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if ct != nil {
+		return location, "updated", ci.kb.writeThing(ct, &t)
+	}
+	_, _, err = WriteThingFile(&t, location, "file://"+ci.kb.ContextPath, true, false)
+	return location, "created", err
+}
+
+// Write the Thing back to its document, the other documents of the file
+// and the comments are kept.
+func (kb *KnowledgeBase) writeThing(ct *ContextThing, t *Thing) error {
+
+	p := kb.FilePath(ct)
+	documents, err := ReadYAMLDocumentsFromFile(p)
+	if err != nil {
+		return err
+	}
+	if ct.Document < 1 || ct.Document > len(documents) {
+		return fmt.Errorf("%s: the document is gone.\n", ct.Location())
+	}
+	doc, err := ParseThingDocument(documents[ct.Document-1])
+	if err != nil {
+		return err
+	}
+	if err = doc.Update(t); err != nil {
+		return err
+	}
+	if documents[ct.Document-1], err = doc.encode(); err != nil {
+		return err
+	}
+	return os.WriteFile(p, JoinYAMLDocuments(documents), 0644)
+}
+
+/*
+	ImportCSV
+	  args
+		r			the table, with the column names in the first row
+		opts		see CSVImportOptions
+	  returns
+		[]CSVImportResult	the records imported
+		[]error		the records that could not be imported, as
+					*CSVRowError
+	  A record updates the Thing with the UUID, which must exist, or
+	  without UUID the one with the name, or else at the location, or
+	  creates a new one at the location, or named after it below the
+	  directory of the options. Empty cells are left alone, the others
+	  are converted to the type the schema gives them, or the type the
+	  value already has, or else taken as text.
+*/
+func (kb *KnowledgeBase) ImportCSV(r io.Reader, opts CSVImportOptions) ([]CSVImportResult, []error) {
+
+	cr := csv.NewReader(r)
+	cr.Comma = opts.Comma
+	cr.FieldsPerRecord = -1
+	if opts.Comma == '\t' {
+		cr.LazyQuotes = true
+	}
+	header, err := cr.Read()
+	if err != nil {
+		return nil, []error{&CSVRowError{1, err}}
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	ci := &csvImporter{kb, opts, make(map[string]interface{})}
+	var results []CSVImportResult
+	var errs []error
+	for record := 2; ; record++ {
+		cells, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, &CSVRowError{record, err})
+			continue
+		}
+		location, action, err := ci.row(header, cells)
+		if err != nil {
+			errs = append(errs, &CSVRowError{record, err})
+			continue
+		}
+		results = append(results, CSVImportResult{record, location, action})
+		if action != "unchanged" {
+			kb.ReloadFile(strings.SplitN(location, "#", 2)[0])
+		}
+	}
+	return results, errs
+}
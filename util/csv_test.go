@@ -0,0 +1,161 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func csvTestContext(t *testing.T) *KnowledgeBase {
+
+	kb, err := LoadKnowledgeBase("file://" + testContext(t, "csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kb
+}
+
+func TestExportCSV(t *testing.T) {
+
+	kb := csvTestContext(t)
+	ct, _ := kb.Resolve("server")
+	a := bytes.NewBufferString("")
+	if e := ExportCSV(a, kb.Descendants(ct), ','); e != nil {
+		t.Fatal(e)
+	}
+	b := "location,uuid,name,network.ip,port,tags[0]\nweb.yml,urn:uuid:2222,web,10.0.0.1,80,\ndb.yml,urn:uuid:3333,db,,5432,sql\n"
+	if a.String() != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a.String())
+	}
+	a.Reset()
+	ExportCSV(a, []*ContextThing{ct}, '\t')
+	if a.String() != "location\tuuid\tname\nserver.yml\turn:uuid:1111\tserver\n" {
+		t.Fatalf("Unexpected TSV ...\n%s", a.String())
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+
+	kb := csvTestContext(t)
+	a := "uuid,name,location,port,tls,network.ip,tags\n" +
+		"2222,,,8080,true,10.0.0.2,\n" +
+		",db,,5432,,,\"[\"\"sql\"\",\"\"pg\"\"]\"\n" +
+		",cache,,6379,,,\n" +
+		",web,,eighty,,,\n" +
+		",,,1,,,\n" +
+		"urn:uuid:2222,,,x,,,\n" +
+		"9999,web,,1,,,\n"
+	b, c := kb.ImportCSV(strings.NewReader(a), CSVImportOptions{Comma: ',', Out: "new"})
+	d := []CSVImportResult{{2, "web.yml", "updated"}, {3, "db.yml", "updated"}, {4, "new/cache.yml", "created"}}
+	if !reflect.DeepEqual(b, d) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", d, b)
+	}
+	t.Log("Now failing successfully (bad records):")
+	var f []string
+	for _, e := range c {
+		f = append(f, e.Error())
+	}
+	g := []string{
+		"record 5: column 'port': 'eighty' is not an integer",
+		"record 6: Neither a UUID, a name nor a location to find the Thing by.",
+		"record 7: column 'port': 'x' is not an integer",
+		"record 8: Unknown UUID 'urn:uuid:9999'.",
+	}
+	if !reflect.DeepEqual(f, g) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", g, f)
+	}
+	// the values have the types of the schema, or the ones they had
+	content, _ := os.ReadFile(filepath.Join(kb.ContextPath, "web.yml"))
+	h := "---\n# the web server\nid:\n  uuid: urn:uuid:2222\n  name: web\nschema:\n  - url: schema.yml\nrelation:\n  - thing_url: server.yml\nparameter:\n  port: 8080\n  network:\n    ip: 10.0.0.2\n  tls: true\n"
+	if string(content) != h {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", h, content)
+	}
+	kb, _ = LoadKnowledgeBase("file://" + kb.ContextPath)
+	ct, _ := kb.Resolve("db")
+	if !reflect.DeepEqual(ct.Parameter["tags"], []interface{}{"sql", "pg"}) || ct.Parameter["port"] != 5432.0 {
+		t.Fatalf("Unexpected parameters %v.\n", ct.Parameter)
+	}
+	ct, _ = kb.Resolve("cache")
+	if ct.Parameter["port"] != "6379" || !strings.HasPrefix(ct.Id.Uuid, "urn:uuid:") {
+		t.Fatalf("Expected a new Thing with the port as text, got %v.\n", ct.Thing)
+	}
+	// the same again changes nothing
+	b, _ = kb.ImportCSV(strings.NewReader("name,port\ncache,6379\n"), CSVImportOptions{Comma: ','})
+	if len(b) != 1 || b[0].Action != "unchanged" {
+		t.Fatalf("Expected the row to be unchanged, got %v.\n", b)
+	}
+}
+
+func TestCoerceCSVValue(t *testing.T) {
+
+	for _, a := range []struct {
+		cell     string
+		jsonType string
+		value    interface{}
+	}{
+		{"42", "integer", 42.0},
+		{"4.2", "number", 4.2},
+		{"false", "boolean", false},
+		{"{\"a\":1}", "object", map[string]interface{}{"a": 1.0}},
+		{"42", "", "42"},
+	} {
+		v, e := CoerceCSVValue(a.cell, a.jsonType)
+		if e != nil || !reflect.DeepEqual(v, a.value) {
+			t.Fatalf("Expected %v for '%s' as %s, got %v %v.\n", a.value, a.cell, a.jsonType, v, e)
+		}
+	}
+	t.Log("Now failing successfully (not an object):")
+	if _, e := CoerceCSVValue("[1]", "object"); e == nil {
+		t.Fatal("Expected an error for a list as object.\n")
+	}
+}
+
+func TestExportImportCSV(t *testing.T) {
+
+	kb := csvTestContext(t)
+	a := bytes.NewBufferString("")
+	if e := ExportCSV(a, kb.SortedThings(), ','); e != nil {
+		t.Fatal(e)
+	}
+	if !strings.Contains(a.String(), "\nproxy.yml,,proxy,") {
+		t.Fatalf("Expected no UUID for a Thing without one ...\n%s", a.String())
+	}
+	b := strings.ReplaceAll(strings.ReplaceAll(a.String(), ",6379,", ",6380,"), ",2,", ",3,")
+	c, d := kb.ImportCSV(strings.NewReader(b), CSVImportOptions{Comma: ','})
+	if len(d) > 0 {
+		t.Fatalf("Expected the table to be imported back: %v.\n", d)
+	}
+	e := []CSVImportResult{
+		{2, "db.yml", "unchanged"},
+		{3, "proxy.yml", "updated"},
+		{4, "schema.yml", "unchanged"},
+		{5, "server.yml", "unchanged"},
+		{6, "twins.yml#1", "unchanged"},
+		{7, "twins.yml#2", "updated"},
+		{8, "web.yml", "unchanged"},
+	}
+	if !reflect.DeepEqual(c, e) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", e, c)
+	}
+	// like every Thing written, it has a UUID now
+	kb, _ = LoadKnowledgeBase("file://" + kb.ContextPath)
+	ct, _ := kb.Resolve("proxy.yml")
+	if ct.Parameter["port"] != 6380.0 || !strings.HasPrefix(ct.Id.Uuid, "urn:uuid:") {
+		t.Fatalf("Expected the port to change, got %v.\n", ct.Thing)
+	}
+}
@@ -0,0 +1,380 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// A Change is one difference between two versions of a Thing. The path
+// uses the syntax of QueryPath, relations are keyed by 'kind:thing_url',
+// repeated ones by 'kind:thing_url~n'.
+type Change struct {
+	// one of: add, remove, change
+	Op   string      `json:"op"`
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// RelationKey identifies a relation independent of its position.
+func RelationKey(r ThingRelation) string {
+	kind := r.Kind
+	if kind == "" {
+		kind = "is"
+	}
+	return kind + ":" + r.ThingUrl
+}
+
+// The keys of the relations by RelationKey, a repeated relation gets the
+// number of its occurrence appended, e.g. 'is:a.yml~2', unless another
+// relation already has that key.
+func relationKeys(relations []ThingRelation) []string {
+
+	taken := make(map[string]bool)
+	for _, l := range relations {
+		taken[RelationKey(l)] = true
+	}
+	seen := make(map[string]int)
+	r := make([]string, len(relations))
+	for i, l := range relations {
+		k := RelationKey(l)
+		seen[k]++
+		if seen[k] == 1 {
+			r[i] = k
+			continue
+		}
+		n := seen[k]
+		for taken[k+"~"+strconv.Itoa(n)] {
+			n++
+		}
+		seen[k] = n
+		r[i] = k + "~" + strconv.Itoa(n)
+		taken[r[i]] = true
+	}
+	return r
+}
+
+/*
+	SemanticForm
+	  args
+		thing		the Thing to compare
+	  returns
+		map			the generic form of the Thing without the empty
+					values and with the relations keyed by RelationKey,
+					repeated ones counted
+*/
+func SemanticForm(thing Thing) (map[string]interface{}, error) {
+
+	relations := thing.Relation
+	thing.Relation = nil
+	g, err := ToGeneric(thing)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := pruneEmpty(g).(map[string]interface{})
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+	if len(relations) > 0 {
+		r := make(map[string]interface{})
+		keys := relationKeys(relations)
+		for i, l := range relations {
+			e, err := ToGeneric(l)
+			if err != nil {
+				return nil, err
+			}
+			// the kind is part of the key, where it can not be empty
+			delete(e.(map[string]interface{}), "kind")
+			r[keys[i]] = pruneEmpty(e)
+		}
+		m["relation"] = r
+	}
+	return m, nil
+}
+
+func pruneEmpty(o interface{}) interface{} {
+
+	switch v := o.(type) {
+	case map[string]interface{}:
+		r := make(map[string]interface{})
+		for k, e := range v {
+			if p := pruneEmpty(e); p != nil {
+				r[k] = p
+			}
+		}
+		if len(r) == 0 {
+			return nil
+		}
+		return r
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		r := make([]interface{}, len(v))
+		for i, e := range v {
+			r[i] = pruneEmpty(e)
+		}
+		return r
+	case string:
+		if v == "" {
+			return nil
+		}
+	}
+	return o
+}
+
+var plainPathKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// JoinPath appends a key to a path, quoting it if needed.
+func JoinPath(prefix string, key string) string {
+	if !plainPathKey.MatchString(key) {
+		return prefix + "['" + key + "']"
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// DiffThings returns the changes from the old to the new Thing, ordered by
+// path.
+func DiffThings(old Thing, new Thing) ([]Change, error) {
+
+	a, err := SemanticForm(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := SemanticForm(new)
+	if err != nil {
+		return nil, err
+	}
+	changes := []Change{}
+	diffValues("", a, b, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, a interface{}, b interface{}, changes *[]Change) {
+
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	// sections coming or going are listed by their entries
+	if plainPathKey.MatchString(path) {
+		if _, ok := b.(map[string]interface{}); ok && a == nil {
+			a = map[string]interface{}{}
+		}
+		if _, ok := a.(map[string]interface{}); ok && b == nil {
+			b = map[string]interface{}{}
+		}
+	}
+	switch {
+	case a == nil:
+		*changes = append(*changes, Change{Op: "add", Path: path, New: b})
+		return
+	case b == nil:
+		*changes = append(*changes, Change{Op: "remove", Path: path, Old: a})
+		return
+	}
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		keys := make(map[string]bool)
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(JoinPath(path, k), am[k], bm[k], changes)
+		}
+		return
+	}
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && bok {
+		for i := 0; i < len(al) || i < len(bl); i++ {
+			var x, y interface{}
+			if i < len(al) {
+				x = al[i]
+			}
+			if i < len(bl) {
+				y = bl[i]
+			}
+			diffValues(path+"["+strconv.Itoa(i)+"]", x, y, changes)
+		}
+		return
+	}
+	*changes = append(*changes, Change{Op: "change", Path: path, Old: a, New: b})
+}
+
+// SemanticLeaves returns the leaf values of the semantic form by their
+// path, see SemanticForm and JoinPath.
+func SemanticLeaves(form map[string]interface{}) map[string]interface{} {
+
+	r := make(map[string]interface{})
+	semanticLeaves("", form, r)
+	return r
+}
+
+func semanticLeaves(path string, o interface{}, r map[string]interface{}) {
+
+	switch v := o.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			semanticLeaves(JoinPath(path, k), e, r)
+		}
+	case []interface{}:
+		for i, e := range v {
+			semanticLeaves(path+"["+strconv.Itoa(i)+"]", e, r)
+		}
+	default:
+		r[path] = v
+	}
+}
+
+/*
+	ThingJSONPatch
+	  args
+		old, new			the Things to compare
+	  returns
+		[]PatchOperation	a JSON patch (RFC 6902) turning the JSON form of
+							the old Thing into the new one, relations are
+							matched by RelationKey, new ones appended
+*/
+func ThingJSONPatch(old Thing, new Thing) ([]PatchOperation, error) {
+
+	a, err := ToGeneric(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ToGeneric(new)
+	if err != nil {
+		return nil, err
+	}
+	a, b = pruneEmpty(a), pruneEmpty(b)
+	if a == nil {
+		a = map[string]interface{}{}
+	}
+	if b == nil {
+		b = map[string]interface{}{}
+	}
+	patch := []PatchOperation{}
+	patchValues("", a, b, &patch)
+	return patch, nil
+}
+
+func genericRelationKey(e interface{}) string {
+	m, _ := e.(map[string]interface{})
+	kind, _ := m["kind"].(string)
+	url, _ := m["thing_url"].(string)
+	return RelationKey(ThingRelation{ThingUrl: url, Kind: kind})
+}
+
+func patchValues(path string, a interface{}, b interface{}, patch *[]PatchOperation) {
+
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		var keys []string
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + pointerToken(k)
+			x, xok := am[k]
+			y, yok := bm[k]
+			switch {
+			case !yok:
+				*patch = append(*patch, PatchOperation{"remove", p, nil})
+			case !xok:
+				*patch = append(*patch, PatchOperation{"add", p, y})
+			default:
+				patchValues(p, x, y, patch)
+			}
+		}
+		return
+	}
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok && bok && path == "/relation" {
+		patchRelations(path, al, bl, patch)
+		return
+	}
+	if aok && bok {
+		for i := 0; i < len(al) && i < len(bl); i++ {
+			patchValues(path+"/"+strconv.Itoa(i), al[i], bl[i], patch)
+		}
+		for i := len(al) - 1; i >= len(bl); i-- {
+			*patch = append(*patch, PatchOperation{"remove", path + "/" + strconv.Itoa(i), nil})
+		}
+		for i := len(al); i < len(bl); i++ {
+			*patch = append(*patch, PatchOperation{"add", path + "/-", bl[i]})
+		}
+		return
+	}
+	*patch = append(*patch, PatchOperation{"replace", path, b})
+}
+
+// Remove the relations gone, from the end, then change the ones kept and
+// append the new ones.
+func patchRelations(path string, a []interface{}, b []interface{}, patch *[]PatchOperation) {
+
+	used := make([]bool, len(b))
+	match := make([]int, len(a))
+	for i, x := range a {
+		match[i] = -1
+		for j, y := range b {
+			if !used[j] && genericRelationKey(x) == genericRelationKey(y) {
+				used[j] = true
+				match[i] = j
+				break
+			}
+		}
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		if match[i] < 0 {
+			*patch = append(*patch, PatchOperation{"remove", path + "/" + strconv.Itoa(i), nil})
+		}
+	}
+	n := 0
+	for i := range a {
+		if match[i] >= 0 {
+			patchValues(path+"/"+strconv.Itoa(n), a[i], b[match[i]], patch)
+			n++
+		}
+	}
+	for j, y := range b {
+		if !used[j] {
+			*patch = append(*patch, PatchOperation{"add", path + "/-", y})
+		}
+	}
+}
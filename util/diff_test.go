@@ -0,0 +1,104 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffThings(t *testing.T) {
+
+	var a, b Thing
+	Unmarshal([]byte("id:\n  name: web\nrelation:\n  - thing_url: server.yml\n  - thing_url: db.yml\n    kind: needs\nparameter:\n  port: 80\n  old: x\n  list: [1, 2]\n"), &a)
+	Unmarshal([]byte("id:\n  name: web\n  version: \"2\"\nrelation:\n  - thing_url: db.yml\n    kind: needs\n    version: \"5\"\n  - thing_url: server.yml\n    kind: is\nparameter:\n  port: 8080\n  list: [1, 2, 3]\n"), &b)
+	c, e := DiffThings(a, b)
+	if e != nil {
+		t.Fatal(e)
+	}
+	d := []Change{
+		{Op: "add", Path: "id.version", New: "2"},
+		{Op: "add", Path: "parameter.list[2]", New: 3.0},
+		{Op: "remove", Path: "parameter.old", Old: "x"},
+		{Op: "change", Path: "parameter.port", Old: 80.0, New: 8080.0},
+		{Op: "add", Path: "relation['needs:db.yml'].version", New: "5"},
+	}
+	if !reflect.DeepEqual(c, d) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", d, c)
+	}
+	if c, _ = DiffThings(a, a); len(c) != 0 {
+		t.Fatalf("Expected no changes, got %v.\n", c)
+	}
+	// the paths can be queried
+	f, _ := SemanticForm(b)
+	if v, e := QueryPath(f, "relation['needs:db.yml'].version"); e != nil || v != "5" {
+		t.Fatalf("Expected to find the relation version: %v %v.\n", v, e)
+	}
+}
+
+func TestDiffThingsRepeatedRelations(t *testing.T) {
+
+	var a, b Thing
+	Unmarshal([]byte("relation:\n  - thing_url: server.yml\n    version: \"1\"\n  - thing_url: server.yml\n    version: \"2\"\n"), &a)
+	Unmarshal([]byte("relation:\n  - thing_url: server.yml\n    version: \"1\"\n"), &b)
+	c, e := DiffThings(a, b)
+	if e != nil {
+		t.Fatal(e)
+	}
+	d := []Change{
+		{Op: "remove", Path: "relation['is:server.yml~2']", Old: map[string]interface{}{"thing_url": "server.yml", "version": "2"}},
+	}
+	if !reflect.DeepEqual(c, d) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", d, c)
+	}
+	f := relationKeys([]ThingRelation{{ThingUrl: "a"}, {ThingUrl: "a~2"}, {ThingUrl: "a"}, {ThingUrl: "a"}})
+	if !reflect.DeepEqual(f, []string{"is:a", "is:a~2", "is:a~3", "is:a~4"}) {
+		t.Fatalf("Expected the keys to stay unique, got %v.\n", f)
+	}
+}
+
+func TestThingJSONPatch(t *testing.T) {
+
+	var a, b, c Thing
+	Unmarshal([]byte("id:\n  name: web\nrelation:\n  - thing_url: gone.yml\n  - thing_url: server.yml\n  - thing_url: db.yml\n    kind: needs\nparameter:\n  port: 80\n  list: [1, 2, 3]\n"), &a)
+	Unmarshal([]byte("id:\n  name: web\nrelation:\n  - thing_url: new.yml\n  - thing_url: db.yml\n    kind: needs\n    version: \"5\"\n  - thing_url: server.yml\nparameter:\n  port: 8080\n  list: [1]\nbehavior:\n  start: now\n"), &b)
+	p, e := ThingJSONPatch(a, b)
+	if e != nil {
+		t.Fatal(e)
+	}
+	d := []PatchOperation{
+		{"add", "/behavior", map[string]interface{}{"start": "now"}},
+		{"remove", "/parameter/list/2", nil},
+		{"remove", "/parameter/list/1", nil},
+		{"replace", "/parameter/port", 8080.0},
+		{"remove", "/relation/0", nil},
+		{"add", "/relation/1/version", "5"},
+		{"add", "/relation/-", map[string]interface{}{"thing_url": "new.yml"}},
+	}
+	if !reflect.DeepEqual(p, d) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", d, p)
+	}
+	// applied to the JSON form of the old Thing, it results in the new one
+	g, _ := ToGeneric(a)
+	g, e = ApplyJSONPatch(g, p)
+	if e != nil {
+		t.Fatal(e)
+	}
+	j, _ := json.Marshal(g)
+	json.Unmarshal(j, &c)
+	if changes, _ := DiffThings(b, c); len(changes) != 0 {
+		t.Fatalf("Expected the patch to result in the new Thing: %v.\n", changes)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// ToGeneric converts structs to the maps and slices a JSON parser would
+// produce, so every value can be accessed by its JSON/YAML key.
+func ToGeneric(o interface{}) (interface{}, error) {
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	var g interface{}
+	err = json.Unmarshal(b, &g)
+	return g, err
+}
+
+// Flatten returns all the leaf values of a generic value by their path,
+// e.g. 'network.interfaces[0].ip'.
+func Flatten(o interface{}) map[string]interface{} {
+
+	r := make(map[string]interface{})
+	flatten("", o, r)
+	return r
+}
+
+func flatten(prefix string, o interface{}, r map[string]interface{}) {
+
+	switch v := o.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			r[prefix] = v
+		}
+		for k, e := range v {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flatten(p, e, r)
+		}
+	case []interface{}:
+		if len(v) == 0 && prefix != "" {
+			r[prefix] = v
+		}
+		for i, e := range v {
+			flatten(prefix+"["+strconv.Itoa(i)+"]", e, r)
+		}
+	default:
+		r[prefix] = v
+	}
+}
+
+// SortedKeys returns the keys of a map in a stable order.
+func SortedKeys(m map[string]interface{}) []string {
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SortedStrings returns the keys of a map of strings in a stable order.
+func SortedStrings(m map[string]string) []string {
+
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
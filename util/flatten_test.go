@@ -0,0 +1,35 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+
+	a := ThingRelation{ThingUrl: "foo.yml", Kind: "is"}
+	b, e := ToGeneric(map[string]interface{}{"relation": []ThingRelation{a}, "x": map[string]interface{}{"y": 1}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	c := Flatten(b)
+	if c["relation[0].thing_url"] != "foo.yml" || c["x.y"] != float64(1) {
+		t.Fatalf("Flattening did not work as expected: %v.\n", c)
+	}
+	d := SortedKeys(c)
+	if d[0] != "relation[0].kind" || d[len(d)-1] != "x.y" {
+		t.Fatalf("The keys were not sorted: %v.\n", d)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A GitCommit is a commit that touched a file, with the path the file had
+// back then, relative to the top of the repository.
+type GitCommit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+	Path    string `json:"path"`
+}
+
+// Run git in the directory and return what it printed.
+func runGit(dir string, args ...string) ([]byte, error) {
+
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GitTopLevel returns the top directory of the repository the path is in.
+func GitTopLevel(path string) (string, error) {
+
+	out, err := runGit(filepath.Dir(path), "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+/*
+	GitLog
+	  args
+		path		the file, following it across renames
+	  returns
+		[]GitCommit	the commits touching the file, the newest first
+		string		the top directory of the repository
+		error		if git failed, e.g. outside of a repository
+*/
+func GitLog(path string) ([]GitCommit, string, error) {
+
+	top, err := GitTopLevel(path)
+	if err != nil {
+		return nil, "", err
+	}
+	abs, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, top, err
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return nil, top, err
+	}
+	out, err := runGit(top, "log", "--follow", "--name-only", "--format=%x01%H%x00%an%x00%aI%x00%s", "--", rel)
+	if err != nil {
+		return nil, top, err
+	}
+	var commits []GitCommit
+	for _, entry := range strings.Split(string(out), "\x01")[1:] {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		fields := strings.SplitN(lines[0], "\x00", 4)
+		if len(fields) < 4 {
+			continue
+		}
+		c := GitCommit{Hash: fields[0], Author: fields[1], Date: fields[2], Subject: fields[3], Path: rel}
+		for _, l := range lines[1:] {
+			if l = strings.TrimSpace(l); l != "" {
+				c.Path = l
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits, top, nil
+}
+
+// GitShow returns the content of the file, relative to the top of the
+// repository, as of the revision.
+func GitShow(top string, rev string, path string) ([]byte, error) {
+	return runGit(top, "show", rev+":"+filepath.ToSlash(path))
+}
+
+// GitPathAt returns the path the file had at the revision, relative to the
+// top of the repository, following renames.
+func GitPathAt(path string, rev string) (string, string, error) {
+
+	commits, top, err := GitLog(path)
+	if err != nil {
+		return "", top, err
+	}
+	out, err := runGit(top, "rev-list", rev)
+	if err != nil {
+		return "", top, err
+	}
+	ancestors := make(map[string]bool)
+	for _, h := range strings.Fields(string(out)) {
+		ancestors[h] = true
+	}
+	for _, c := range commits {
+		if ancestors[c.Hash] {
+			return c.Path, top, nil
+		}
+	}
+	return "", top, fmt.Errorf("The file did not exist at %s.\n", rev)
+}
+
+// GitUserName returns the name git records as author in the directory,
+// empty if none is configured.
+func GitUserName(dir string) string {
+
+	out, err := runGit(dir, "config", "user.name")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,142 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+// A ThingRevision is the Thing as of a commit, and what the commit
+// changed.
+type ThingRevision struct {
+	Commit GitCommit `json:"commit"`
+	// nil if the Thing did not exist after the commit
+	Thing   *Thing   `json:"thing"`
+	Changes []Change `json:"changes"`
+}
+
+// Pick the Thing out of a version of its file: the document with the same
+// UUID, or else the one the fragment selects. Missing UUIDs are not made
+// up, so they do not show up as changes.
+func selectRevisionThing(content []byte, uuid string, fragment string) (*Thing, error) {
+
+	documents := SplitYAMLDocuments(content)
+	if uuid != "" {
+		for _, d := range documents {
+			var t Thing
+			if Unmarshal(d, &t) == nil && t.Id.Uuid == uuid {
+				return &t, nil
+			}
+		}
+	}
+	i, err := FindThingDocumentIndex(documents, fragment)
+	if err != nil {
+		return nil, err
+	}
+	var t Thing
+	err = Unmarshal(documents[i], &t)
+	return &t, err
+}
+
+/*
+	ThingHistory
+	  args
+		location	the path of the file, with the document selector
+					attached if needed
+		uuid		the UUID of the Thing, to find it in earlier versions
+					of a file with several documents, may be empty
+	  returns
+		[]ThingRevision	the commits touching the file, the newest
+						first, those not changing the Thing left out
+*/
+func ThingHistory(location string, uuid string) ([]ThingRevision, error) {
+
+	path, fragment := SplitThingFragment(location)
+	commits, top, err := GitLog(path)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []ThingRevision
+	var things []*Thing
+	for _, c := range commits {
+		var t *Thing
+		if content, err := GitShow(top, c.Hash, c.Path); err == nil {
+			t, _ = selectRevisionThing(content, uuid, fragment)
+		}
+		revisions = append(revisions, ThingRevision{Commit: c, Thing: t})
+		things = append(things, t)
+	}
+	var r []ThingRevision
+	for i := range revisions {
+		old := Thing{}
+		if i+1 < len(things) && things[i+1] != nil {
+			old = *things[i+1]
+		}
+		new := Thing{}
+		if things[i] != nil {
+			new = *things[i]
+		}
+		revisions[i].Changes, err = DiffThings(old, new)
+		if err != nil {
+			return nil, err
+		}
+		if len(revisions[i].Changes) > 0 {
+			r = append(r, revisions[i])
+		}
+	}
+	return r, nil
+}
+
+// ThingAt returns the Thing as of the revision.
+func ThingAt(location string, uuid string, rev string) (*Thing, error) {
+
+	path, fragment := SplitThingFragment(location)
+	p, top, err := GitPathAt(path, rev)
+	if err != nil {
+		return nil, err
+	}
+	content, err := GitShow(top, rev, p)
+	if err != nil {
+		return nil, err
+	}
+	return selectRevisionThing(content, uuid, fragment)
+}
+
+// BlameThing returns for every value of the newest revision the commit
+// that last changed it, by the paths of SemanticLeaves.
+func BlameThing(revisions []ThingRevision) (map[string]interface{}, map[string]GitCommit, error) {
+
+	blame := make(map[string]GitCommit)
+	if len(revisions) == 0 || revisions[0].Thing == nil {
+		return map[string]interface{}{}, blame, nil
+	}
+	form, err := SemanticForm(*revisions[0].Thing)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaves := SemanticLeaves(form)
+	// walk from the oldest to the newest, the last change wins
+	for i := len(revisions) - 1; i >= 0; i-- {
+		for _, c := range revisions[i].Changes {
+			for p := range leaves {
+				if p == c.Path || isSubPath(c.Path, p) {
+					blame[p] = revisions[i].Commit
+				}
+			}
+		}
+	}
+	return leaves, blame, nil
+}
+
+func isSubPath(prefix string, path string) bool {
+	if len(path) <= len(prefix) || path[:len(prefix)] != prefix {
+		return false
+	}
+	return path[len(prefix)] == '.' || path[len(prefix)] == '['
+}
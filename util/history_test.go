@@ -0,0 +1,94 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Run git in a temporary repository, with a fixed author.
+func gitTest(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=Tester", "-c", "user.email=tester@example.org", "-c", "commit.gpgsign=false"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s\n%s", args, err, out)
+	}
+}
+
+func gitTestRepository(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	d := t.TempDir()
+	gitTest(t, d, "init", "-q")
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nparameter:\n  port: 80\n"), 0644)
+	gitTest(t, d, "add", "-A")
+	gitTest(t, d, "commit", "-q", "-m", "Add web")
+	os.WriteFile(filepath.Join(d, "other.yml"), []byte("id:\n  name: other\n"), 0644)
+	gitTest(t, d, "add", "-A")
+	gitTest(t, d, "commit", "-q", "-m", "Add other")
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nrelation:\n  - thing_url: other.yml\nparameter:\n  port: 8080\n"), 0644)
+	gitTest(t, d, "commit", "-q", "-a", "-m", "Change the port")
+	gitTest(t, d, "mv", "web.yml", "www.yml")
+	gitTest(t, d, "commit", "-q", "-m", "Rename web")
+	return d
+}
+
+func TestThingHistory(t *testing.T) {
+
+	d := gitTestRepository(t)
+	a, e := ThingHistory(filepath.Join(d, "www.yml"), "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	// the rename changes nothing about the Thing
+	if len(a) != 2 || a[0].Commit.Subject != "Change the port" || a[1].Commit.Subject != "Add web" {
+		t.Fatalf("Expected two revisions, got %v.\n", a)
+	}
+	if len(a[0].Changes) != 2 || a[0].Changes[0].Path != "parameter.port" || a[0].Changes[1].Path != "relation['is:other.yml']" {
+		t.Fatalf("Unexpected changes: %v.\n", a[0].Changes)
+	}
+	if a[1].Commit.Path != "web.yml" || a[1].Commit.Author != "Tester" {
+		t.Fatalf("Expected the old path and the author: %v.\n", a[1].Commit)
+	}
+
+	b, e := ThingAt(filepath.Join(d, "www.yml"), "", "HEAD~3")
+	if e != nil || b.Parameter["port"] != 80.0 {
+		t.Fatalf("Expected the first version: %v %v.\n", b, e)
+	}
+	leaves, blame, e := BlameThing(a)
+	if e != nil || leaves["parameter.port"] != 8080.0 {
+		t.Fatalf("Expected the current values: %v %v.\n", leaves, e)
+	}
+	if blame["parameter.port"].Subject != "Change the port" || blame["id.name"].Subject != "Add web" {
+		t.Fatalf("Unexpected blame: %v.\n", blame)
+	}
+
+	t.Log("Now failing successfully (before the Thing existed):")
+	gitTest(t, d, "tag", "start", "HEAD~3")
+	os.WriteFile(filepath.Join(d, "late.yml"), []byte("id:\n  name: late\n"), 0644)
+	gitTest(t, d, "add", "-A")
+	gitTest(t, d, "commit", "-q", "-m", "Add late")
+	if _, e = ThingAt(filepath.Join(d, "late.yml"), "", "start"); e == nil {
+		t.Fatal("The Thing did not exist back then.")
+	}
+	t.Log("Now failing successfully (not a repository):")
+	c := t.TempDir()
+	os.WriteFile(filepath.Join(c, "web.yml"), []byte("id:\n  name: web\n"), 0644)
+	if _, e = ThingHistory(filepath.Join(c, "web.yml"), ""); e == nil {
+		t.Fatal("Expected an error outside of a repository.")
+	}
+}
@@ -0,0 +1,387 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The pages of the site, all of them in the same directory.
+const siteTemplates = `
+{{define "head"}}<!DOCTYPE html>
+<html lang="en-US">
+<head>
+<meta charset="UTF-8">
+<title>{{.}}</title>
+</head>
+<body>
+<script src="https://cdn.jsdelivr.net/npm/mermaid/dist/mermaid.min.js"></script>
+<script>mermaid.initialize({startOnLoad:true});</script>
+<p><a href="index.html">Index</a></p>
+{{end}}
+{{define "foot"}}</body>
+</html>
+{{end}}
+{{define "links"}}<ul>
+{{range .}}<li>{{template "link" .}}</li>
+{{end}}</ul>
+{{end}}
+{{define "link"}}{{if .Page}}<a href="{{.Page}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}{{if .Note}} ({{.Note}}){{end}}{{end}}
+{{define "tree"}}<ul>
+{{range .}}<li><a href="{{.Page}}">{{.Title}}</a>{{if .Children}}
+{{template "tree" .Children}}{{end}}</li>
+{{end}}</ul>
+{{end}}
+{{define "index"}}{{template "head" "Knowledge Base"}}
+<h1>Knowledge Base</h1>
+<h2>Categories</h2>
+{{template "tree" .Categories}}
+<h2>Things</h2>
+{{template "links" .Things}}
+{{template "foot"}}{{end}}
+{{define "category"}}{{template "head" .Title}}
+<h1>Category {{.Title}}</h1>
+<p><a href="{{.Page}}">About this category</a></p>
+{{if .Parents}}<h2>Part of</h2>
+{{template "links" .Parents}}{{end}}
+<h2>Members</h2>
+{{template "tree" .Members}}
+{{template "foot"}}{{end}}
+{{define "thing"}}{{template "head" .Title}}
+<h1>{{.Title}}</h1>
+<table>
+<tr><th>Location</th><td>{{.Location}}</td></tr>
+{{if .Uuid}}<tr><th>UUID</th><td>{{.Uuid}}</td></tr>{{end}}
+<tr><th>Name</th><td>{{.Thing.Id.Name}}</td></tr>
+<tr><th>Version</th><td>{{.Thing.Id.Version}}</td></tr>
+</table>
+{{if .CategoryPage}}<p><a href="{{.CategoryPage}}">Members of this category</a></p>{{end}}
+{{if .Parameters}}<h2>Parameters</h2>
+<table>
+{{range .Parameters}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Behavior}}<h2>Behavior</h2>
+<pre>{{.Behavior}}</pre>{{end}}
+{{if .Legal}}<h2>Legal</h2>
+{{range .Legal}}<h3>{{.Title}}</h3>
+{{template "links" .Links}}{{end}}{{end}}
+{{if .Relations}}<h2>Relations</h2>
+{{template "links" .Relations}}{{end}}
+{{if .Backlinks}}<h2>Backlinks</h2>
+{{template "links" .Backlinks}}{{end}}
+{{if .Diagram}}<h2>Diagram</h2>
+<div class="mermaid">
+{{.Diagram}}</div>{{end}}
+{{template "foot"}}{{end}}
+`
+
+type siteLink struct {
+	Page  string
+	Title string
+	Note  string
+}
+
+type siteTree struct {
+	Page     string
+	Title    string
+	Children []siteTree
+}
+
+type siteKeyValue struct {
+	Key   string
+	Value string
+}
+
+type siteLegal struct {
+	Title string
+	Links []siteLink
+}
+
+type sitePage struct {
+	Title        string
+	Location     string
+	Uuid         string
+	Thing        Thing
+	CategoryPage string
+	Parameters   []siteKeyValue
+	Behavior     string
+	Legal        []siteLegal
+	Relations    []siteLink
+	Backlinks    []siteLink
+	Diagram      string
+}
+
+// The slug of a page keeps the location readable and stays unique: the
+// slashes become '_', everything else that is not safe in a file name is
+// written as '~' and its hex code, '_' and '~' included.
+func pageSlug(ct *ContextThing) string {
+	var b strings.Builder
+	for _, c := range []byte(ct.Location()) {
+		switch {
+		case c == '/':
+			b.WriteByte('_')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "~%02x", c)
+		}
+	}
+	return b.String()
+}
+
+func thingPage(ct *ContextThing) string {
+	return "thing-" + pageSlug(ct) + ".html"
+}
+
+func categoryPage(ct *ContextThing) string {
+	return "category-" + pageSlug(ct) + ".html"
+}
+
+func thingTitle(ct *ContextThing) string {
+	if ct.Id.Name != "" {
+		return ct.Id.Name
+	}
+	return ct.Location()
+}
+
+func thingLink(ct *ContextThing, note string) siteLink {
+	return siteLink{thingPage(ct), thingTitle(ct), note}
+}
+
+/*
+	RenderSite
+	  args
+		kb			the knowledge base to render
+		outDir		the directory to write the pages to
+	  The site contains an index, a page per Thing and a page per
+	  category, i.e. every Thing another Thing 'is'. The output only
+	  depends on the knowledge base, so it can be compared between runs.
+*/
+func RenderSite(kb *KnowledgeBase, outDir string) error {
+
+	t, err := template.New("site").Parse(siteTemplates)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = cleanSite(outDir)
+	if err != nil {
+		return err
+	}
+	things := kb.SortedThings()
+
+	write := func(name string, tmpl string, data interface{}) error {
+		fh, err := os.Create(filepath.Join(outDir, name))
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		return t.ExecuteTemplate(fh, tmpl, data)
+	}
+
+	var roots []siteTree
+	var all []siteLink
+	for _, ct := range things {
+		all = append(all, thingLink(ct, ct.Location()))
+		children := kb.Children(ct)
+		if len(children) > 0 && len(kb.Parents(ct)) == 0 {
+			roots = append(roots, categoryTree(kb, ct, map[*ContextThing]bool{}))
+		}
+	}
+	err = write("index.html", "index", map[string]interface{}{"Categories": roots, "Things": all})
+	if err != nil {
+		return err
+	}
+
+	for _, ct := range things {
+		p := buildThingPage(kb, ct)
+		err = write(thingPage(ct), "thing", p)
+		if err != nil {
+			return err
+		}
+		if p.CategoryPage == "" {
+			continue
+		}
+		var parents []siteLink
+		for _, o := range kb.Parents(ct) {
+			parents = append(parents, siteLink{categoryPage(o), thingTitle(o), ""})
+		}
+		err = write(categoryPage(ct), "category", map[string]interface{}{
+			"Title":   thingTitle(ct),
+			"Page":    thingPage(ct),
+			"Parents": parents,
+			"Members": categoryTree(kb, ct, map[*ContextThing]bool{}).Children,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the pages of an earlier rendering, Things may have gone since.
+func cleanSite(outDir string) error {
+	pages := []string{filepath.Join(outDir, "index.html")}
+	for _, pattern := range []string{"thing-*.html", "category-*.html"} {
+		m, err := filepath.Glob(filepath.Join(outDir, pattern))
+		if err != nil {
+			return err
+		}
+		pages = append(pages, m...)
+	}
+	for _, p := range pages {
+		err := os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Walk down the 'is' hierarchy, categories link to their category page.
+func categoryTree(kb *KnowledgeBase, ct *ContextThing, visited map[*ContextThing]bool) siteTree {
+
+	visited[ct] = true
+	children := kb.Children(ct)
+	page := thingPage(ct)
+	if len(children) > 0 {
+		page = categoryPage(ct)
+	}
+	tree := siteTree{page, thingTitle(ct), nil}
+	for _, c := range sortThings(children) {
+		if !visited[c] {
+			tree.Children = append(tree.Children, categoryTree(kb, c, visited))
+		}
+	}
+	return tree
+}
+
+func sortThings(cts []*ContextThing) []*ContextThing {
+	kb := &KnowledgeBase{Things: cts}
+	return kb.SortedThings()
+}
+
+func buildThingPage(kb *KnowledgeBase, ct *ContextThing) sitePage {
+
+	p := sitePage{Title: thingTitle(ct), Location: ct.Location(), Thing: ct.Thing, Uuid: ct.Id.Uuid}
+	if len(kb.Children(ct)) > 0 {
+		p.CategoryPage = categoryPage(ct)
+	}
+	if g, err := ToGeneric(ct.Parameter); err == nil {
+		f := Flatten(g)
+		for _, k := range SortedKeys(f) {
+			p.Parameters = append(p.Parameters, siteKeyValue{k, fmt.Sprint(f[k])})
+		}
+	}
+	if len(ct.Behavior) > 0 {
+		if b, err := Marshal(ct.Behavior); err == nil {
+			p.Behavior = string(b)
+		}
+	}
+	for _, l := range []struct {
+		title   string
+		entries []NameUrlVersionDateGeo
+	}{{"Authors", ct.Legal.Author}, {"References", ct.Legal.Reference}, {"Licenses", ct.Legal.License}} {
+		var links []siteLink
+		for _, e := range l.entries {
+			links = append(links, legalLink(e))
+		}
+		if len(links) > 0 {
+			p.Legal = append(p.Legal, siteLegal{l.title, links})
+		}
+	}
+
+	var lines []string
+	nodes := map[*ContextThing]string{ct: "n0"}
+	node := func(o *ContextThing) string {
+		if n, ok := nodes[o]; ok {
+			return n
+		}
+		n := fmt.Sprintf("n%d", len(nodes))
+		nodes[o] = n
+		lines = append(lines, fmt.Sprintf("    click %s \"%s\"", n, thingPage(o)))
+		return n
+	}
+	lines = append(lines, "    n0"+mermaidLabel(thingTitle(ct)))
+	for i, l := range ct.Relation {
+		kind := l.Kind
+		if kind == "" {
+			kind = "is"
+		}
+		o, err := kb.ResolveRelation(l.ThingUrl)
+		if err != nil {
+			p.Relations = append(p.Relations, siteLink{"", l.ThingUrl, kind})
+			lines = append(lines, fmt.Sprintf("    n0 -->|%s| u%d%s", mermaidText(kind), i, mermaidLabel(l.ThingUrl)))
+			continue
+		}
+		p.Relations = append(p.Relations, thingLink(o, kind))
+		lines = append(lines, fmt.Sprintf("    n0 -->|%s| %s%s", mermaidText(kind), node(o), mermaidLabel(thingTitle(o))))
+	}
+	for _, o := range sortThings(kb.Backlinks(ct)) {
+		var kinds []string
+		for _, l := range o.Relation {
+			if t, err := kb.ResolveRelation(l.ThingUrl); err == nil && t == ct {
+				if l.Kind == "" {
+					kinds = append(kinds, "is")
+				} else {
+					kinds = append(kinds, l.Kind)
+				}
+			}
+		}
+		kind := strings.Join(kinds, ", ")
+		p.Backlinks = append(p.Backlinks, thingLink(o, kind))
+		lines = append(lines, fmt.Sprintf("    %s%s -->|%s| n0", node(o), mermaidLabel(thingTitle(o)), mermaidText(kind)))
+	}
+	if len(ct.Relation) > 0 || len(p.Backlinks) > 0 {
+		p.Diagram = "    graph LR\n" + strings.Join(lines, "\n") + "\n"
+	}
+	return p
+}
+
+func legalLink(e NameUrlVersionDateGeo) siteLink {
+
+	var l siteLink
+	var notes []string
+	if e.NameUrlVersion != nil {
+		if e.NameUrl != nil {
+			l.Title = e.Name
+			l.Page = e.Url
+			if l.Title == "" {
+				l.Title = e.Url
+			}
+		}
+		if e.Version != "" {
+			notes = append(notes, e.Version)
+		}
+	}
+	if e.DateGeo != nil && e.Date != "" {
+		notes = append(notes, e.Date)
+	}
+	l.Note = strings.Join(notes, ", ")
+	return l
+}
+
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;", "\n", " ").Replace(s)
+}
+
+func mermaidLabel(s string) string {
+	return `["` + mermaidText(s) + `"]`
+}
@@ -0,0 +1,112 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderSite(t *testing.T) {
+
+	d := t.TempDir()
+	os.MkdirAll(filepath.Join(d, "categories"), 0755)
+	os.WriteFile(filepath.Join(d, "categories", "server.yml"), []byte("id:\n  name: server\n  uuid: urn:uuid:1111\n"), 0644)
+	os.WriteFile(filepath.Join(d, "categories", "host.yml"), []byte("id:\n  name: host\nrelation:\n  - thing_url: categories/server.yml\n"), 0644)
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nrelation:\n  - thing_url: categories/host.yml\n    kind: is\n  - thing_url: nowhere.yml\n    kind: needs\nparameter:\n  port: 80\n  tags:\n    - \"<b>\"\nlegal:\n  author:\n    - name: Jane\n      date: \"2021-01-01\"\n"), 0644)
+
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	a := filepath.Join(t.TempDir(), "a")
+	b := filepath.Join(t.TempDir(), "b")
+	if e = RenderSite(kb, a); e != nil {
+		t.Fatalf("Could not render the site: %s.\n", e)
+	}
+	// a fresh load generates new UUIDs for the Things without one
+	kb, _ = LoadKnowledgeBase("file://" + d)
+	if e = RenderSite(kb, b); e != nil {
+		t.Fatalf("Could not render the site: %s.\n", e)
+	}
+	pages, _ := filepath.Glob(filepath.Join(a, "*.html"))
+	if len(pages) != 6 {
+		t.Fatalf("Expected an index, 3 Thing and 2 category pages, got %v.\n", pages)
+	}
+	for _, p := range pages {
+		c, _ := os.ReadFile(p)
+		e, err := os.ReadFile(filepath.Join(b, filepath.Base(p)))
+		if err != nil || string(c) != string(e) {
+			t.Fatalf("The page %s differs between the runs.\n", filepath.Base(p))
+		}
+	}
+
+	c, _ := os.ReadFile(filepath.Join(a, "thing-web.yml.html"))
+	for _, e := range []string{
+		`<a href="thing-categories_host.yml.html">host</a> (is)`,
+		"nowhere.yml (needs)",
+		"<th>port</th><td>80</td>",
+		"&lt;b&gt;",
+		"Jane (2021-01-01)",
+		"n0 --&gt;|is| n1[&#34;host&#34;]",
+	} {
+		if !strings.Contains(string(c), e) {
+			t.Fatalf("Expected '%s' in the page:\n%s", e, c)
+		}
+	}
+	c, _ = os.ReadFile(filepath.Join(a, "thing-categories_server.yml.html"))
+	if !strings.Contains(string(c), "urn:uuid:1111") || !strings.Contains(string(c), `<a href="thing-categories_host.yml.html">host</a> (is)`) {
+		t.Fatalf("Expected the UUID and the backlink in the page:\n%s", c)
+	}
+	c, _ = os.ReadFile(filepath.Join(a, "index.html"))
+	if !strings.Contains(string(c), `<a href="category-categories_server.yml.html">server</a>`) {
+		t.Fatalf("Expected the root category in the index:\n%s", c)
+	}
+}
+
+func TestRenderSiteSlugs(t *testing.T) {
+
+	d := t.TempDir()
+	os.MkdirAll(filepath.Join(d, "a"), 0755)
+	os.WriteFile(filepath.Join(d, "a", "b.yml"), []byte("id:\n  name: slash\n"), 0644)
+	os.WriteFile(filepath.Join(d, "a_b.yml"), []byte("id:\n  name: underscore\n"), 0644)
+	os.WriteFile(filepath.Join(d, "c.yml"), []byte("id:\n  name: c1\n---\nid:\n  name: c2\n"), 0644)
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	a := t.TempDir()
+	os.WriteFile(filepath.Join(a, "thing-gone.yml.html"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(a, "notes.txt"), []byte("mine"), 0644)
+	if e = RenderSite(kb, a); e != nil {
+		t.Fatalf("Could not render the site: %s.\n", e)
+	}
+	seen := make(map[string]string)
+	for _, ct := range kb.Things {
+		p := thingPage(ct)
+		if o, ok := seen[p]; ok {
+			t.Fatalf("%s and %s share the page %s.\n", o, ct.Location(), p)
+		}
+		seen[p] = ct.Location()
+	}
+	pages, _ := filepath.Glob(filepath.Join(a, "thing-*.html"))
+	if len(pages) != len(kb.Things) {
+		t.Fatalf("Expected a page per Thing and none of the old ones, got %v.\n", pages)
+	}
+	if _, e = os.Stat(filepath.Join(a, "notes.txt")); e != nil {
+		t.Fatalf("Only the generated pages should have been removed: %s.\n", e)
+	}
+}
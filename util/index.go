@@ -0,0 +1,422 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The format of the index, older ones are rebuilt.
+const indexVersion = 2
+
+// An Index caches the parsed Things of a context, the relations between
+// them and the words to search for.
+type Index struct {
+	Version int                     `json:"version"`
+	Files   map[string]*IndexedFile `json:"files"`
+	Edges   []IndexEdge             `json:"edges"`
+	Words   map[string][]string     `json:"words"`
+}
+
+// An IndexedFile is known to be unchanged as long as its modification time
+// and size, or else its hash, stay the same.
+type IndexedFile struct {
+	ModTime   int64          `json:"mtime"`
+	Size      int64          `json:"size"`
+	Hash      string         `json:"hash"`
+	Documents int            `json:"documents"`
+	Things    []IndexedThing `json:"things"`
+	Errors    []string       `json:"errors"`
+}
+
+type IndexedThing struct {
+	Document int   `json:"document"`
+	Thing    Thing `json:"thing"`
+}
+
+// An IndexEdge is a relation, To is empty if it points nowhere.
+type IndexEdge struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Kind     string `json:"kind"`
+	ThingUrl string `json:"thing_url"`
+}
+
+// The changes between the index and the files of the context.
+type IndexStatus struct {
+	Files   int
+	Things  int
+	Added   []string
+	Changed []string
+	Removed []string
+}
+
+func (s *IndexStatus) IsStale() bool {
+	return len(s.Added)+len(s.Changed)+len(s.Removed) > 0
+}
+
+// IndexPath returns where the index of the context is kept.
+func IndexPath(contextPath string) string {
+	return filepath.Join(contextPath, ".natem", "index")
+}
+
+func ReadIndex(contextPath string) (*Index, error) {
+
+	content, err := os.ReadFile(IndexPath(contextPath))
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{}
+	err = json.Unmarshal(content, ix)
+	if err != nil {
+		return nil, err
+	}
+	if ix.Version != indexVersion {
+		return nil, fmt.Errorf("The index has version %d, expected %d.\n", ix.Version, indexVersion)
+	}
+	if ix.Files == nil {
+		ix.Files = make(map[string]*IndexedFile)
+	}
+	return ix, nil
+}
+
+// Write the index to a temporary file of its own first, so readers never
+// see half of it, not even with several writers at once.
+func (ix *Index) write(contextPath string) error {
+
+	p := IndexPath(contextPath)
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "index-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func hashOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func indexFile(fi os.FileInfo, content []byte, rel string) *IndexedFile {
+
+	f := &IndexedFile{ModTime: fi.ModTime().UnixNano(), Size: fi.Size(), Hash: hashOf(content)}
+	f.Documents = len(SplitYAMLDocuments(content))
+	things, errs := parseThingFile(content, rel)
+	for _, ct := range things {
+		f.Things = append(f.Things, IndexedThing{ct.Document, ct.Thing})
+	}
+	for _, e := range errs {
+		f.Errors = append(f.Errors, e.Error())
+	}
+	return f
+}
+
+/*
+	refresh
+	  args
+		contextPath		the directory of the context
+		dryRun			only find the changes, do not parse anything
+	  returns
+		IndexStatus		the files added, changed or removed since the
+						last refresh; files only touched do not count
+		error			if the context could not be read
+*/
+func (ix *Index) refresh(contextPath string, dryRun bool) (*IndexStatus, error) {
+
+	s := &IndexStatus{}
+	seen := make(map[string]bool)
+	err := walkThingFiles(contextPath, func(path string, rel string) error {
+		seen[rel] = true
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		old := ix.Files[rel]
+		if old != nil && old.ModTime == fi.ModTime().UnixNano() && old.Size == fi.Size() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.Hash == hashOf(content) {
+			if !dryRun {
+				old.ModTime = fi.ModTime().UnixNano()
+				old.Size = fi.Size()
+			}
+			return nil
+		}
+		if old == nil {
+			s.Added = append(s.Added, rel)
+		} else {
+			s.Changed = append(s.Changed, rel)
+		}
+		if !dryRun {
+			ix.Files[rel] = indexFile(fi, content, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return s, err
+	}
+	for rel := range ix.Files {
+		if !seen[rel] {
+			s.Removed = append(s.Removed, rel)
+		}
+	}
+	sort.Strings(s.Removed)
+	if !dryRun {
+		for _, rel := range s.Removed {
+			delete(ix.Files, rel)
+		}
+		if s.IsStale() || ix.Words == nil {
+			ix.derive(contextPath)
+		}
+	}
+	s.Files = len(ix.Files)
+	for _, f := range ix.Files {
+		s.Things += len(f.Things)
+	}
+	return s, nil
+}
+
+// The knowledge base as stored in the index.
+func (ix *Index) knowledgeBase(contextPath string) *KnowledgeBase {
+
+	kb := &KnowledgeBase{ContextPath: contextPath}
+	var files []string
+	for rel := range ix.Files {
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+	for _, rel := range files {
+		f := ix.Files[rel]
+		for _, it := range f.Things {
+			kb.Things = append(kb.Things, &ContextThing{it.Thing, rel, it.Document, f.Documents})
+		}
+		for _, e := range f.Errors {
+			kb.Errors = append(kb.Errors, fmt.Errorf("%s", e))
+		}
+	}
+	return kb
+}
+
+// Work out the relations and the words from the Things.
+func (ix *Index) derive(contextPath string) {
+
+	kb := ix.knowledgeBase(contextPath)
+	ix.Edges = []IndexEdge{}
+	ix.Words = make(map[string][]string)
+	for _, ct := range kb.Things {
+		for _, l := range ct.Relation {
+			e := IndexEdge{From: ct.Location(), Kind: l.Kind, ThingUrl: l.ThingUrl}
+			if t, err := kb.ResolveRelation(l.ThingUrl); err == nil {
+				e.To = t.Location()
+			}
+			ix.Edges = append(ix.Edges, e)
+		}
+		words := make(map[string]bool)
+		for _, w := range strings.Fields(strings.ToLower(searchText(ct))) {
+			words[w] = true
+		}
+		for w := range words {
+			ix.Words[w] = append(ix.Words[w], ct.Location())
+		}
+	}
+}
+
+// Read the index, bring it up to date and save it if anything changed.
+func loadIndexedKnowledgeBase(contextPath string) (*KnowledgeBase, error) {
+
+	ix, err := ReadIndex(contextPath)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ix.refresh(contextPath, false)
+	if err != nil {
+		return nil, err
+	}
+	if s.IsStale() {
+		// a read-only context can still be used, just not as fast
+		ix.write(contextPath)
+	}
+	kb := ix.knowledgeBase(contextPath)
+	kb.useIndex(ix)
+	return kb, nil
+}
+
+func (kb *KnowledgeBase) useIndex(ix *Index) {
+
+	kb.index()
+	kb.words = make(map[string][]*ContextThing)
+	for w, locations := range ix.Words {
+		for _, l := range locations {
+			if ct, ok := kb.byLocation[l]; ok {
+				kb.words[w] = append(kb.words[w], ct)
+			}
+		}
+	}
+	kb.backlinks = make(map[*ContextThing][]*ContextThing)
+	kb.outgoing = make(map[*ContextThing][]relationEdge)
+	kb.incoming = make(map[*ContextThing][]relationEdge)
+	for _, e := range ix.Edges {
+		from, ok := kb.byLocation[e.From]
+		to, tok := kb.byLocation[e.To]
+		if !ok || !tok {
+			continue
+		}
+		kb.addRelationEdge(from, e.Kind, to)
+		l := kb.backlinks[to]
+		if len(l) == 0 || l[len(l)-1] != from {
+			kb.backlinks[to] = append(l, from)
+		}
+	}
+}
+
+// RebuildIndex parses the whole context and writes a new index.
+func RebuildIndex(context string) (*IndexStatus, error) {
+
+	contextPath, err := GetContextPath(context)
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{Version: indexVersion, Files: make(map[string]*IndexedFile)}
+	s, err := ix.refresh(contextPath, false)
+	if err != nil {
+		return nil, err
+	}
+	return s, ix.write(contextPath)
+}
+
+// GetIndexStatus compares the index with the files, without updating it.
+func GetIndexStatus(context string) (*IndexStatus, error) {
+
+	contextPath, err := GetContextPath(context)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := ReadIndex(contextPath)
+	if err != nil {
+		return nil, err
+	}
+	return ix.refresh(contextPath, true)
+}
+
+// VerifyIndex checks the index for being consistent and up to date, and
+// returns the problems found.
+func VerifyIndex(context string) ([]string, error) {
+
+	contextPath, err := GetContextPath(context)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := ReadIndex(contextPath)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	seen := make(map[string]bool)
+	err = walkThingFiles(contextPath, func(path string, rel string) error {
+		seen[rel] = true
+		f := ix.Files[rel]
+		if f == nil {
+			problems = append(problems, rel+": not in the index")
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if f.Hash != hashOf(content) {
+			problems = append(problems, rel+": changed since indexed")
+		} else if f.Documents != len(SplitYAMLDocuments(content)) {
+			problems = append(problems, rel+": wrong number of documents")
+		}
+		return nil
+	})
+	if err != nil {
+		return problems, err
+	}
+	var files []string
+	for rel := range ix.Files {
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+	for _, rel := range files {
+		if !seen[rel] {
+			problems = append(problems, rel+": gone since indexed")
+		}
+	}
+	derived := &Index{Files: ix.Files}
+	derived.derive(contextPath)
+	if !reflect.DeepEqual(sortedEdges(derived.Edges), sortedEdges(ix.Edges)) {
+		problems = append(problems, "the relations do not match the Things")
+	}
+	if !sameWords(derived.Words, ix.Words) {
+		problems = append(problems, "the words do not match the Things")
+	}
+	return problems, nil
+}
+
+func sortedEdges(edges []IndexEdge) []IndexEdge {
+	r := append([]IndexEdge{}, edges...)
+	sort.Slice(r, func(i, j int) bool {
+		return fmt.Sprint(r[i]) < fmt.Sprint(r[j])
+	})
+	return r
+}
+
+func sameWords(a map[string][]string, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for w, la := range a {
+		lb := append([]string{}, b[w]...)
+		la = append([]string{}, la...)
+		sort.Strings(la)
+		sort.Strings(lb)
+		if !reflect.DeepEqual(la, lb) {
+			return false
+		}
+	}
+	return true
+}
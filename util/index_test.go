@@ -0,0 +1,133 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func indexTestContext(t *testing.T) string {
+	return testContext(t, "index")
+}
+
+func locations(cts []*ContextThing) []string {
+	var r []string
+	for _, ct := range cts {
+		r = append(r, ct.Location())
+	}
+	return r
+}
+
+func TestIndex(t *testing.T) {
+
+	d := indexTestContext(t)
+	c := "file://" + d
+	a, _ := LoadKnowledgeBase(c)
+	s, e := RebuildIndex(c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s.Files != 2 || s.Things != 3 {
+		t.Fatalf("Expected 3 Things in 2 files, got %d in %d.\n", s.Things, s.Files)
+	}
+	b, e := LoadKnowledgeBase(c)
+	if e != nil || b.words == nil {
+		t.Fatalf("Expected the knowledge base from the index: %v.\n", e)
+	}
+	for _, q := range []string{"nginx", "web inx", "sub/", "nothing"} {
+		if x, y := locations(a.Search(q)), locations(b.Search(q)); len(x) != len(y) || (len(x) > 0 && x[0] != y[0]) {
+			t.Fatalf("Expected the same result for '%s', got %v and %v.\n", q, x, y)
+		}
+	}
+	x, _ := b.Resolve("server")
+	if y := locations(b.Backlinks(x)); len(y) != 2 || y[0] != "sub/web.yml#1" {
+		t.Fatalf("Expected the backlinks from the index, got %v.\n", y)
+	}
+	problems, e := VerifyIndex(c)
+	if e != nil || len(problems) != 0 {
+		t.Fatalf("Expected the index to be fine: %v %v.\n", problems, e)
+	}
+
+	// only touching a file does not count
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(d, "server.yml"), later, later)
+	s, _ = GetIndexStatus(c)
+	if s.IsStale() {
+		t.Fatalf("Expected the touched file to be unchanged: %v.\n", s)
+	}
+
+	os.WriteFile(filepath.Join(d, "server.yml"), []byte("id:\n  name: host\n  uuid: urn:uuid:1111\n"), 0644)
+	os.WriteFile(filepath.Join(d, "new.yml"), []byte("id:\n  name: new\n"), 0644)
+	os.Remove(filepath.Join(d, "sub", "web.yml"))
+	s, _ = GetIndexStatus(c)
+	if len(s.Added) != 1 || len(s.Changed) != 1 || len(s.Removed) != 1 {
+		t.Fatalf("Expected one file added, changed and removed: %v.\n", s)
+	}
+	t.Log("Now failing successfully (stale index):")
+	problems, _ = VerifyIndex(c)
+	if len(problems) != 3 {
+		t.Fatalf("Expected three problems: %v.\n", problems)
+	}
+	b, _ = LoadKnowledgeBase(c)
+	if _, e = b.Resolve("host"); e != nil || len(b.Things) != 2 {
+		t.Fatalf("Expected the changes to be picked up: %v.\n", locations(b.Things))
+	}
+	if s, _ = GetIndexStatus(c); s.IsStale() {
+		t.Fatal("Expected the index to be updated on the way.")
+	}
+
+	t.Log("Now failing successfully (broken index):")
+	os.WriteFile(IndexPath(d), []byte("{"), 0644)
+	b, e = LoadKnowledgeBase(c)
+	if e != nil || b.words != nil || len(b.Things) != 2 {
+		t.Fatalf("Expected to fall back to parsing the files: %v.\n", e)
+	}
+	if _, e = GetIndexStatus(c); e == nil {
+		t.Fatal("Expected the broken index to be reported.")
+	}
+}
+
+func TestIndexReproducible(t *testing.T) {
+
+	d := indexTestContext(t)
+	c := "file://" + d
+	if _, e := RebuildIndex(c); e != nil {
+		t.Fatal(e)
+	}
+	a, e := os.ReadFile(IndexPath(d))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e = RebuildIndex(c); e != nil {
+		t.Fatal(e)
+	}
+	b, e := os.ReadFile(IndexPath(d))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(a) != string(b) {
+		t.Fatalf("Expected the same index twice, got ...\n%s\n... and ...\n%s", a, b)
+	}
+	x, _ := LoadKnowledgeBase(c)
+	if y, e := x.Resolve("web"); e != nil || y.Id.Uuid != "" {
+		t.Fatalf("Expected no UUID for a Thing without one: %v.\n", e)
+	}
+	f, _ := os.ReadDir(filepath.Dir(IndexPath(d)))
+	if len(f) != 1 {
+		t.Fatalf("Expected only the index to be left, got %v.\n", f)
+	}
+}
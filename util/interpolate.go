@@ -0,0 +1,194 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Tsunki variables look like '${network.port}' for a parameter of the same
+// Thing (or one it inherits from via 'is') and '${thing:other.parameter.port}'
+// for any value of another Thing, named by its name, UUID or location, e.g.
+// '${thing:other.yml.parameter.port}'. '$${' escapes a literal '${'.
+var tsunkiVariable = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// An InterpolationError collects all the variables that could not be
+// resolved, each with the place it was used at.
+type InterpolationError struct {
+	Problems []string
+}
+
+func (e *InterpolationError) Error() string {
+	return "Could not resolve all the variables:\n  " + strings.Join(e.Problems, "\n  ") + "\n"
+}
+
+type interpolator struct {
+	kb       *KnowledgeBase
+	stack    []string
+	problems []string
+}
+
+// InterpolateParameters returns the parameters of the Thing with all the
+// variables replaced. The knowledge base is used to find inherited and
+// related Things, it may be nil.
+func InterpolateParameters(kb *KnowledgeBase, ct *ContextThing) (map[string]interface{}, error) {
+
+	p, err := ToGeneric(ct.Parameter)
+	if err != nil {
+		return nil, err
+	}
+	ip := &interpolator{kb: kb}
+	r, _ := ip.value(ct, "parameter", p).(map[string]interface{})
+	if len(ip.problems) > 0 {
+		return r, &InterpolationError{ip.problems}
+	}
+	return r, nil
+}
+
+func (ip *interpolator) value(ct *ContextThing, path string, v interface{}) interface{} {
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		r := make(map[string]interface{})
+		for k, e := range t {
+			r[k] = ip.value(ct, path+"."+k, e)
+		}
+		return r
+	case []interface{}:
+		var r []interface{}
+		for i, e := range t {
+			r = append(r, ip.value(ct, path+"["+strconv.Itoa(i)+"]", e))
+		}
+		return r
+	case string:
+		return ip.expand(ct, path, t)
+	}
+	return v
+}
+
+func (ip *interpolator) expand(ct *ContextThing, path string, s string) interface{} {
+
+	m := tsunkiVariable.FindAllStringSubmatchIndex(s, -1)
+	// a variable on its own keeps the type of the value it refers to
+	if len(m) == 1 && m[0][0] == 0 && m[0][1] == len(s) && s[1] == '{' {
+		if v, ok := ip.lookup(ct, path, s[m[0][2]:m[0][3]]); ok {
+			return v
+		}
+		return s
+	}
+	return tsunkiVariable.ReplaceAllStringFunc(s, func(variable string) string {
+		if strings.HasPrefix(variable, "$$") {
+			return variable[1:]
+		}
+		v, ok := ip.lookup(ct, path, variable[2:len(variable)-1])
+		if !ok {
+			return variable
+		}
+		return fmt.Sprint(v)
+	})
+}
+
+// Find the value a variable refers to and interpolate it in turn, in the
+// context of the Thing it was found in.
+func (ip *interpolator) lookup(ct *ContextThing, path string, ref string) (interface{}, bool) {
+
+	where := ct.Location() + ": " + path
+	var owner *ContextThing
+	var v interface{}
+	var valuePath string
+	var err error
+	if strings.HasPrefix(ref, "thing:") {
+		owner, valuePath, v, err = ip.lookupThing(strings.TrimPrefix(ref, "thing:"))
+	} else {
+		owner, v, err = ip.lookupParameter(ct, ref, make(map[*ContextThing]bool))
+		valuePath = "parameter." + ref
+	}
+	if err != nil {
+		ip.problems = append(ip.problems, fmt.Sprintf("%s: ${%s}: %s", where, ref, err))
+		return nil, false
+	}
+	key := owner.Location() + ": " + valuePath
+	for i, s := range ip.stack {
+		if s == key {
+			cycle := append(ip.stack[i:], key)
+			ip.problems = append(ip.problems, fmt.Sprintf("%s: ${%s}: reference cycle: %s", where, ref, strings.Join(cycle, " -> ")))
+			return nil, false
+		}
+	}
+	ip.stack = append(ip.stack, key)
+	v = ip.value(owner, valuePath, v)
+	ip.stack = ip.stack[:len(ip.stack)-1]
+	return v, true
+}
+
+// Look for the parameter in the Thing first, then in the Things it 'is'.
+func (ip *interpolator) lookupParameter(ct *ContextThing, ref string, visited map[*ContextThing]bool) (*ContextThing, interface{}, error) {
+
+	visited[ct] = true
+	p, err := ToGeneric(ct.Parameter)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := QueryPath(p, ref)
+	if err == nil {
+		return ct, v, nil
+	}
+	if ip.kb != nil {
+		for _, r := range ct.Relation {
+			if r.Kind != "is" && r.Kind != "" {
+				continue
+			}
+			parent, perr := ip.kb.ResolveRelation(r.ThingUrl)
+			if perr != nil || visited[parent] {
+				continue
+			}
+			if o, v, perr := ip.lookupParameter(parent, ref, visited); perr == nil {
+				return o, v, nil
+			}
+		}
+	}
+	return nil, nil, err
+}
+
+// lookupThing splits the reference at the last '.' that leaves a Thing in
+// front of it, so locations like 'other.yml' work as well as names.
+func (ip *interpolator) lookupThing(ref string) (*ContextThing, string, interface{}, error) {
+
+	if ip.kb == nil {
+		return nil, "", nil, fmt.Errorf("no knowledge base to look up other Things")
+	}
+	i := strings.LastIndex(ref, ".")
+	if i < 1 {
+		return nil, "", nil, fmt.Errorf("the reference must look like 'thing:name.path'")
+	}
+	var other *ContextThing
+	var err error
+	for ; i > 0; i = strings.LastIndex(ref[:i], ".") {
+		other, err = ip.kb.ResolveRelation(ref[:i])
+		if err == nil {
+			break
+		}
+	}
+	if other == nil {
+		return nil, "", nil, err
+	}
+	g, err := ToGeneric(other.Thing)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	v, err := QueryPath(g, ref[i+1:])
+	return other, ref[i+1:], v, err
+}
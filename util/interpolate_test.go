@@ -0,0 +1,91 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateParameters(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "server.yml"), []byte(`
+id:
+  name: server
+parameter:
+  domain: example.org
+  port: 22
+`), 0644)
+	os.WriteFile(filepath.Join(d, "db.yml"), []byte(`
+id:
+  name: db
+parameter:
+  port: 5432
+  url: "${host}:${port}"
+  host: "db.${domain}"
+`), 0644)
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte(`
+id:
+  name: web
+relation:
+  - thing_url: server.yml
+    kind: is
+parameter:
+  host: "www.${domain}"
+  db: "${thing:db.parameter.url}"
+  dbport: "${thing:db.parameter.port}"
+  dbname: "${thing:db.yml.id.name}"
+  ssh: "${port}"
+  price: "$${not.a.variable}"
+  list:
+    - "${network.ip}"
+  network:
+    ip: 10.0.0.1
+`), 0644)
+	kb, e := LoadKnowledgeBase(d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	a, e := kb.Resolve("web")
+	if e != nil {
+		t.Fatal(e)
+	}
+	b, e := InterpolateParameters(kb, a)
+	if e == nil {
+		t.Fatal("The variable '${domain}' of 'db' should not have been resolvable.")
+	}
+	t.Logf("got the expected error: %s", e)
+	var ie *InterpolationError
+	if !errors.As(e, &ie) || len(ie.Problems) != 1 || !strings.Contains(ie.Problems[0], "db.yml: parameter.host: ${domain}") {
+		t.Fatalf("The error should tell where the variable was used: %s.\n", e)
+	}
+	if b["host"] != "www.example.org" || b["ssh"] != float64(22) || b["dbport"] != float64(5432) || b["dbname"] != "db" {
+		t.Fatalf("Variables were not resolved as expected: %v.\n", b)
+	}
+	if b["price"] != "${not.a.variable}" || b["list"].([]interface{})[0] != "10.0.0.1" {
+		t.Fatalf("Variables were not resolved as expected: %v.\n", b)
+	}
+
+	t.Log("Now failing successfully (reference cycle):")
+	c := &ContextThing{Thing: Thing{Parameter: map[string]interface{}{"a": "${b}", "b": "x${a}"}}, Path: "cycle.yml"}
+	_, e = InterpolateParameters(nil, c)
+	if e == nil || !strings.Contains(e.Error(), "reference cycle") {
+		t.Fatalf("The cycle should have been detected: %s.\n", e)
+	}
+	t.Logf("got the expected error: %s", e)
+}
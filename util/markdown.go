@@ -0,0 +1,540 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A MarkdownNote is a Markdown file with its YAML front matter.
+type MarkdownNote struct {
+	// the path relative to the imported directory, with slashes
+	Path        string
+	FrontMatter map[string]interface{}
+	Body        string
+	content     []byte
+}
+
+// How Markdown notes are turned into Things.
+type MarkdownImportOptions struct {
+	// the directory in the context to write the Things to
+	Out string
+	// store the body as 'parameter' or as 'target'
+	Body string
+	// the kind of the relations for the links in the body
+	LinkKind string
+	// replace the Things imported before
+	Overwrite bool
+}
+
+// ParseMarkdown splits the front matter from the body, the front matter is
+// the YAML between the '---' lines at the very start.
+func ParseMarkdown(content []byte) (map[string]interface{}, string, error) {
+
+	fm := make(map[string]interface{})
+	lines := strings.SplitAfter(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return fm, strings.Join(lines, ""), nil
+	}
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "---" {
+			continue
+		}
+		if err := Unmarshal([]byte(strings.Join(lines[1:i], "")), &fm); err != nil {
+			return nil, "", err
+		}
+		if fm == nil {
+			fm = make(map[string]interface{})
+		}
+		return fm, strings.TrimPrefix(strings.Join(lines[i+1:], ""), "\n"), nil
+	}
+	// never closed, so not a front matter
+	return fm, strings.Join(lines, ""), nil
+}
+
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]|#]+)(#[^\[\]|]*)?(\|[^\[\]]*)?\]\]`)
+
+// WikiLinks returns the targets of the '[[x]]', '[[x|label]]' and
+// '[[x#heading]]' links in the text, each once.
+func WikiLinks(text string) []string {
+
+	var r []string
+	seen := make(map[string]bool)
+	for _, m := range wikiLink.FindAllStringSubmatch(text, -1) {
+		l := strings.TrimSpace(m[1])
+		if !seen[l] {
+			seen[l] = true
+			r = append(r, l)
+		}
+	}
+	return r
+}
+
+// ReadMarkdownNotes reads all the '.md' files below the directory, hidden
+// directories are skipped.
+func ReadMarkdownNotes(dir string) ([]*MarkdownNote, []error) {
+
+	var notes []*MarkdownNote
+	var errs []error
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".md") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", rel, err))
+			return nil
+		}
+		fm, body, err := ParseMarkdown(content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", rel, err))
+			return nil
+		}
+		notes = append(notes, &MarkdownNote{filepath.ToSlash(rel), fm, body, content})
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return notes, errs
+}
+
+// The name of the note, as used in the links.
+func (n *MarkdownNote) name() string {
+	return strings.TrimSuffix(path.Base(n.Path), ".md")
+}
+
+// The location of the Thing of the note, relative to the context.
+func (n *MarkdownNote) location(out string) string {
+	return path.Join(filepath.ToSlash(out), strings.TrimSuffix(n.Path, ".md")+".yml")
+}
+
+// Turn a link into a reference, the location of the note linked to if it
+// is imported too, by path or else by name, or the link as it is.
+func markdownReference(link string, notes []*MarkdownNote, out string) string {
+
+	l := strings.TrimSuffix(link, ".md")
+	for _, n := range notes {
+		if strings.TrimSuffix(n.Path, ".md") == l {
+			return n.location(out)
+		}
+	}
+	for _, n := range notes {
+		if n.name() == l {
+			return n.location(out)
+		}
+	}
+	return link
+}
+
+func stringList(v interface{}) []string {
+
+	switch l := v.(type) {
+	case string:
+		return []string{l}
+	case []interface{}:
+		var r []string
+		for _, e := range l {
+			if s, ok := e.(string); ok {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+/*
+	MarkdownThing
+	  args
+		note		the note to turn into a Thing
+		notes		all the notes imported, to resolve the links
+		opts		see MarkdownImportOptions
+	  returns
+		Thing		with the id from 'uuid', 'title' or 'name', 'version'
+					and 'url', the authors from 'author', the relations
+					from 'relation' and from the links in the values, named
+					by the key, e.g. 'is: "[[server]]"', and the links in
+					the body, and the rest of the front matter as parameters
+*/
+func MarkdownThing(note *MarkdownNote, notes []*MarkdownNote, opts MarkdownImportOptions) (Thing, error) {
+
+	var t Thing
+	t.Parameter = make(map[string]interface{})
+	seen := make(map[string]bool)
+	relate := func(link string, kind string) {
+		r := ThingRelation{ThingUrl: markdownReference(link, notes, opts.Out), Kind: kind}
+		if k := RelationKey(r); !seen[k] {
+			seen[k] = true
+			t.Relation = append(t.Relation, r)
+		}
+	}
+	for _, k := range SortedKeys(note.FrontMatter) {
+		v := note.FrontMatter[k]
+		switch k {
+		case "uuid":
+			t.Id.Uuid = fmt.Sprint(v)
+			if !strings.HasPrefix(t.Id.Uuid, "urn:uuid:") {
+				t.Id.Uuid = "urn:uuid:" + t.Id.Uuid
+			}
+		case "title", "name":
+			if t.Id.Name == "" || k == "title" {
+				t.Id.Name = fmt.Sprint(v)
+			}
+		case "version":
+			t.Id.Version = fmt.Sprint(v)
+		case "url":
+			t.Id.Url = stringList(v)
+		case "author", "authors":
+			date, _ := note.FrontMatter["date"].(string)
+			for _, a := range stringList(v) {
+				t.Legal.Author = append(t.Legal.Author, NameUrlVersionDateGeo{&NameUrlVersion{&NameUrl{Name: a}, ""}, &DateGeo{Date: date}, false})
+			}
+		case "relation":
+			var r []ThingRelation
+			b, err := Marshal(v)
+			if err == nil {
+				err = Unmarshal(b, &r)
+			}
+			if err != nil {
+				return t, fmt.Errorf("%s: relation: %s", note.Path, err)
+			}
+			for _, l := range r {
+				relate(l.ThingUrl, l.Kind)
+			}
+		default:
+			var links []string
+			for _, s := range stringList(v) {
+				links = append(links, WikiLinks(s)...)
+			}
+			if len(links) == 0 {
+				t.Parameter[k] = v
+			}
+			for _, l := range links {
+				relate(l, k)
+			}
+		}
+	}
+	if t.Id.Name == "" {
+		t.Id.Name = note.name()
+	}
+	for _, l := range WikiLinks(note.Body) {
+		relate(l, opts.LinkKind)
+	}
+	switch opts.Body {
+	case "target":
+		t.Target = []ThingTarget{{Url: note.Path, Checksum: "sha256:" + hashOf(note.content), Tag: "markdown"}}
+	case "parameter", "":
+		if strings.TrimSpace(note.Body) != "" {
+			t.Parameter["body"] = note.Body
+		}
+	default:
+		return t, fmt.Errorf("Unknown body storage '%s', use one of: parameter, target.\n", opts.Body)
+	}
+	if len(t.Parameter) == 0 {
+		t.Parameter = nil
+	}
+	return t, nil
+}
+
+/*
+	ImportMarkdown
+	  args
+		dir			the directory with the Markdown notes
+		context		the context to write the Things to
+		opts		see MarkdownImportOptions
+	  returns
+		[]string	the locations of the Things written
+		[]error		the notes that could not be imported
+*/
+func ImportMarkdown(dir string, context string, opts MarkdownImportOptions) ([]string, []error) {
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+	notes, errs := ReadMarkdownNotes(dir)
+	contextPath, err := GetContextPath(context)
+	if err != nil {
+		return nil, append(errs, err)
+	}
+	var written []string
+	for _, n := range notes {
+		t, err := MarkdownThing(n, notes, opts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l := n.location(opts.Out)
+		if opts.Body == "target" {
+			t.Target[0].Url = "file://" + filepath.Join(dir, filepath.FromSlash(n.Path))
+		}
+		// a Thing imported again keeps its UUID
+		if t.Id.Uuid == "" && opts.Overwrite {
+			if old, err := ReadYAMLDocumentFromFile(filepath.Join(contextPath, l)); err == nil {
+				var o Thing
+				if Unmarshal(old, &o) == nil {
+					t.Id.Uuid = o.Id.Uuid
+				}
+			}
+		}
+		if _, _, err = WriteThingFile(&t, l, context, true, opts.Overwrite); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", n.Path, strings.TrimSpace(err.Error())))
+			continue
+		}
+		written = append(written, l)
+	}
+	return written, errs
+}
+
+// MarkdownNotePath returns the path of the note of a Thing, 'a/b.yml#2'
+// becomes 'a/b-2.md'.
+func MarkdownNotePath(ct *ContextThing) string {
+
+	p := strings.TrimSuffix(strings.TrimSuffix(filepath.ToSlash(ct.Path), ".yml"), ".yaml")
+	if ct.Documents > 1 {
+		p += "-" + strconv.Itoa(ct.Document)
+	}
+	return p + ".md"
+}
+
+// The link to the note of the Thing referenced, or to the reference as it
+// is if there is no such Thing.
+func (kb *KnowledgeBase) markdownLink(ref string) string {
+	return "[[" + kb.markdownTarget(ref) + "]]"
+}
+
+func (kb *KnowledgeBase) markdownTarget(ref string) string {
+
+	if ct, err := kb.ResolveRelation(ref); err == nil {
+		return strings.TrimSuffix(MarkdownNotePath(ct), ".md")
+	}
+	return ref
+}
+
+// The keys of the front matter MarkdownThing does not take for relations
+// or parameters.
+var markdownKeys = map[string]bool{
+	"uuid": true, "title": true, "name": true, "version": true, "url": true,
+	"author": true, "authors": true, "date": true, "relation": true,
+}
+
+// Whether the value fits into the front matter, i.e. a single line scalar
+// or a list of those.
+func isFrontMatterValue(v interface{}) bool {
+
+	switch x := v.(type) {
+	case string:
+		return !strings.Contains(x, "\n")
+	case []interface{}:
+		for _, e := range x {
+			if _, ok := e.([]interface{}); ok || !isFrontMatterValue(e) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		return false
+	}
+	return true
+}
+
+// Write a value as YAML code block.
+func writeYAMLBlock(b *bytes.Buffer, v interface{}) error {
+
+	y, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	b.WriteString("```yaml\n")
+	b.Write(y)
+	b.WriteString("```\n")
+	return nil
+}
+
+/*
+	ThingMarkdown
+	  args
+		ct			the Thing to write as note
+	  returns
+		[]byte		the note: the id, the relations as wiki-links named by
+					their kind, or in 'relation' if the kind is a key of
+					the id, and the simple parameters in the front
+					matter, the parameter 'body' as body, followed by
+					the other parameters, the behaviors and the legal
+					information as sections, see MarkdownThing for the
+					reverse
+*/
+func (kb *KnowledgeBase) ThingMarkdown(ct *ContextThing) ([]byte, error) {
+
+	fm := make(map[string]interface{})
+	if ct.Id.Uuid != "" {
+		fm["uuid"] = ct.Id.Uuid
+	}
+	fm["title"] = thingTitle(ct)
+	if ct.Id.Version != "" {
+		fm["version"] = ct.Id.Version
+	}
+	if len(ct.Id.Url) > 0 {
+		fm["url"] = ct.Id.Url
+	}
+	links := make(map[string][]interface{})
+	var relations []interface{}
+	for _, l := range ct.Relation {
+		kind := l.Kind
+		if kind == "" {
+			kind = "is"
+		}
+		if markdownKeys[kind] {
+			relations = append(relations, map[string]interface{}{"kind": kind, "thing_url": kb.markdownTarget(l.ThingUrl)})
+			continue
+		}
+		links[kind] = append(links[kind], kb.markdownLink(l.ThingUrl))
+	}
+	if len(relations) > 0 {
+		fm["relation"] = relations
+	}
+	for k, l := range links {
+		if len(l) == 1 {
+			fm[k] = l[0]
+		} else {
+			fm[k] = l
+		}
+	}
+	other := make(map[string]interface{})
+	body, _ := ct.Parameter["body"].(string)
+	for k, v := range ct.Parameter {
+		if k == "body" && body != "" {
+			continue
+		}
+		if _, taken := fm[k]; !taken && !markdownKeys[k] && isFrontMatterValue(v) {
+			fm[k] = v
+		} else {
+			other[k] = v
+		}
+	}
+
+	var b bytes.Buffer
+	y, err := Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString("---\n")
+	b.Write(y)
+	b.WriteString("---\n\n")
+	if body != "" {
+		b.WriteString(body)
+		if !strings.HasSuffix(body, "\n") {
+			b.WriteString("\n")
+		}
+	} else {
+		b.WriteString("# " + thingTitle(ct) + "\n")
+	}
+	if len(other) > 0 {
+		b.WriteString("\n## Parameters\n\n")
+		if err = writeYAMLBlock(&b, other); err != nil {
+			return nil, err
+		}
+	}
+	if len(ct.Behavior) > 0 {
+		b.WriteString("\n## Behavior\n")
+		for _, k := range SortedKeys(ct.Behavior) {
+			b.WriteString("\n### " + k + "\n\n")
+			if err = writeYAMLBlock(&b, ct.Behavior[k]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sections := []struct {
+		title   string
+		entries []NameUrlVersionDateGeo
+	}{{"Author", ct.Legal.Author}, {"Reference", ct.Legal.Reference}, {"License", ct.Legal.License}}
+	hasLegal := false
+	for _, s := range sections {
+		if len(s.entries) == 0 {
+			continue
+		}
+		if !hasLegal {
+			b.WriteString("\n## Legal\n")
+			hasLegal = true
+		}
+		b.WriteString("\n### " + s.title + "\n\n")
+		for _, e := range s.entries {
+			l := legalLink(e)
+			if l.Page != "" {
+				b.WriteString("- [" + l.Title + "](" + l.Page + ")")
+			} else {
+				b.WriteString("- " + l.Title)
+			}
+			if l.Note != "" {
+				b.WriteString(" (" + l.Note + ")")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// ExportMarkdown writes a note per Thing below the directory and returns
+// their paths, see ThingMarkdown. Nothing is written if two Things would get
+// the same note, e.g. 'a/b.yml' and 'a/b.yaml', or 'a/b-2.yml' and the second
+// document of 'a/b.yml'.
+func (kb *KnowledgeBase) ExportMarkdown(outDir string) ([]string, error) {
+
+	things := kb.SortedThings()
+	notes := make(map[string]*ContextThing)
+	for _, ct := range things {
+		n := MarkdownNotePath(ct)
+		if other, ok := notes[n]; ok {
+			return nil, fmt.Errorf("Both '%s' and '%s' would be written to '%s'.\n", other.Location(), ct.Location(), n)
+		}
+		notes[n] = ct
+	}
+	var written []string
+	for _, ct := range things {
+		content, err := kb.ThingMarkdown(ct)
+		if err != nil {
+			return written, fmt.Errorf("%s: %s", ct.Location(), err)
+		}
+		p := filepath.Join(outDir, filepath.FromSlash(MarkdownNotePath(ct)))
+		if err = os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return written, err
+		}
+		if err = os.WriteFile(p, content, 0644); err != nil {
+			return written, err
+		}
+		written = append(written, MarkdownNotePath(ct))
+	}
+	return written, nil
+}
@@ -0,0 +1,209 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkdown(t *testing.T) {
+
+	a, b, e := ParseMarkdown([]byte("---\ntitle: Web\ntags: [a, b]\n---\n\n# Web\n"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if a["title"] != "Web" || b != "# Web\n" {
+		t.Fatalf("Unexpected front matter %v or body '%s'.\n", a, b)
+	}
+	// no front matter at all
+	a, b, e = ParseMarkdown([]byte("# Web\n---\n"))
+	if e != nil || len(a) != 0 || b != "# Web\n---\n" {
+		t.Fatalf("Unexpected front matter %v or body '%s': %v.\n", a, b, e)
+	}
+	t.Log("Now failing successfully (broken front matter):")
+	if _, _, e = ParseMarkdown([]byte("---\ntitle: [\n---\n")); e == nil {
+		t.Fatal("Expected an error for broken YAML.\n")
+	}
+}
+
+func TestWikiLinks(t *testing.T) {
+
+	a := WikiLinks("see [[server]], [[db|the database]] and [[notes/web#setup]], again [[server]]")
+	b := []string{"server", "db", "notes/web"}
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("Expected %v, got %v.\n", b, a)
+	}
+}
+
+func TestMarkdownThing(t *testing.T) {
+
+	a := []*MarkdownNote{
+		{Path: "hosts/server.md"},
+		{Path: "web.md", FrontMatter: map[string]interface{}{"title": "The Web", "uuid": "2222", "author": "Alice", "date": "2021-06-01", "is": "[[server]]", "port": 80.0}, Body: "Uses [[db]] and [[server|the server]].\n"},
+	}
+	b, e := MarkdownThing(a[1], a, MarkdownImportOptions{Out: "notes", LinkKind: "mentions"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if b.Id.Uuid != "urn:uuid:2222" || b.Id.Name != "The Web" {
+		t.Fatalf("Unexpected id %v.\n", b.Id)
+	}
+	c := []ThingRelation{{ThingUrl: "notes/hosts/server.yml", Kind: "is"}, {ThingUrl: "db", Kind: "mentions"}, {ThingUrl: "notes/hosts/server.yml", Kind: "mentions"}}
+	if !reflect.DeepEqual(b.Relation, c) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", c, b.Relation)
+	}
+	d := map[string]interface{}{"date": "2021-06-01", "port": 80.0, "body": "Uses [[db]] and [[server|the server]].\n"}
+	if !reflect.DeepEqual(b.Parameter, d) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", d, b.Parameter)
+	}
+	if len(b.Legal.Author) != 1 || b.Legal.Author[0].Name != "Alice" || b.Legal.Author[0].Date != "2021-06-01" {
+		t.Fatalf("Unexpected authors %v.\n", b.Legal.Author)
+	}
+	t.Log("Now failing successfully (unknown body storage):")
+	if _, e = MarkdownThing(a[1], a, MarkdownImportOptions{Body: "nowhere"}); e == nil {
+		t.Fatal("Expected an error for an unknown body storage.\n")
+	}
+}
+
+func TestImportMarkdown(t *testing.T) {
+
+	a := t.TempDir()
+	os.MkdirAll(filepath.Join(a, "hosts"), 0755)
+	os.MkdirAll(filepath.Join(a, ".obsidian"), 0755)
+	os.WriteFile(filepath.Join(a, "hosts", "server.md"), []byte("# Server\n"), 0644)
+	os.WriteFile(filepath.Join(a, "web.md"), []byte("---\nis: \"[[server]]\"\n---\nServes [[hosts/server]].\n"), 0644)
+	os.WriteFile(filepath.Join(a, ".obsidian", "skipped.md"), []byte("# Skipped\n"), 0644)
+	os.WriteFile(filepath.Join(a, "broken.md"), []byte("---\n: [\n---\n"), 0644)
+	b := t.TempDir()
+	c, e := ImportMarkdown(a, "file://"+b, MarkdownImportOptions{Body: "target", LinkKind: "mentions"})
+	if len(e) != 1 || !strings.HasPrefix(e[0].Error(), "broken.md") {
+		t.Fatalf("Expected only the broken note to fail, got %v.\n", e)
+	}
+	if !reflect.DeepEqual(c, []string{"hosts/server.yml", "web.yml"}) {
+		t.Fatalf("Unexpected Things written %v.\n", c)
+	}
+	kb, _ := LoadKnowledgeBase("file://" + b)
+	d, err := kb.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := kb.CheckLinks(d); len(p) > 0 {
+		t.Fatalf("Expected the links to resolve, got %v.\n", p)
+	}
+	if len(d.Target) != 1 || d.Target[0].Url != "file://"+filepath.Join(a, "web.md") || !strings.HasPrefix(d.Target[0].Checksum, "sha256:") {
+		t.Fatalf("Unexpected target %v.\n", d.Target)
+	}
+	// importing again keeps the UUIDs
+	t.Log("Now failing successfully (the Things exist):")
+	if _, e = ImportMarkdown(a, "file://"+b, MarkdownImportOptions{}); len(e) != 3 {
+		t.Fatalf("Expected the existing Things not to be overwritten, got %v.\n", e)
+	}
+	if _, e = ImportMarkdown(a, "file://"+b, MarkdownImportOptions{Overwrite: true}); len(e) != 1 {
+		t.Fatalf("Expected the Things to be overwritten, got %v.\n", e)
+	}
+	kb, _ = LoadKnowledgeBase("file://" + b)
+	if f, err := kb.Resolve("web"); err != nil || f.Id.Uuid != d.Id.Uuid {
+		t.Fatalf("Expected the UUID to be kept: %v %v.\n", f, err)
+	}
+}
+
+func TestThingMarkdown(t *testing.T) {
+
+	d := t.TempDir()
+	os.MkdirAll(filepath.Join(d, "categories"), 0755)
+	os.WriteFile(filepath.Join(d, "categories", "server.yml"), []byte("---\nid:\n  name: server\n"), 0644)
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("---\nid:\n  uuid: urn:uuid:2222\n  name: web\nrelation:\n  - thing_url: categories/server.yml\n  - thing_url: db\n    kind: needs\nparameter:\n  port: 80\n  body: \"Serves pages.\\n\"\n  tls:\n    cert: web.pem\nbehavior:\n  start:\n    run:\n      command: nginx\nlegal:\n  author:\n    - name: Alice\n      url: https://alice.example\n      date: \"2021-06-01\"\n  license:\n    - name: GPL-3.0\n"), 0644)
+	kb, _ := LoadKnowledgeBase("file://" + d)
+	ct, _ := kb.Resolve("web")
+	a, e := kb.ThingMarkdown(ct)
+	if e != nil {
+		t.Fatal(e)
+	}
+	b := "---\nis: '[[categories/server]]'\nneeds: '[[db]]'\nport: 80\ntitle: web\nuuid: urn:uuid:2222\n---\n\nServes pages.\n\n## Parameters\n\n```yaml\ntls:\n  cert: web.pem\n```\n\n## Behavior\n\n### start\n\n```yaml\nrun:\n  command: nginx\n```\n\n## Legal\n\n### Author\n\n- [Alice](https://alice.example) (2021-06-01)\n\n### License\n\n- GPL-3.0\n"
+	if string(a) != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a)
+	}
+	// and back again
+	c := t.TempDir()
+	written, e := kb.ExportMarkdown(c)
+	if e != nil || !reflect.DeepEqual(written, []string{"categories/server.md", "web.md"}) {
+		t.Fatalf("Unexpected notes written %v: %v.\n", written, e)
+	}
+	notes, errs := ReadMarkdownNotes(c)
+	if len(errs) > 0 || len(notes) != 2 {
+		t.Fatalf("Expected to read the notes back: %v.\n", errs)
+	}
+	f, e := MarkdownThing(notes[1], notes, MarkdownImportOptions{LinkKind: "mentions"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	g := []ThingRelation{{ThingUrl: "categories/server.yml", Kind: "is"}, {ThingUrl: "db", Kind: "needs"}}
+	if f.Id.Uuid != "urn:uuid:2222" || f.Id.Name != "web" || !reflect.DeepEqual(f.Relation, g) || f.Parameter["port"] != 80.0 {
+		t.Fatalf("Unexpected Thing imported back %v.\n", f)
+	}
+}
+
+func TestThingMarkdownKeys(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "server.yml"), []byte("id:\n  name: server\n"), 0644)
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nrelation:\n  - thing_url: server.yml\n    kind: title\n  - thing_url: db\n    kind: uuid\nparameter:\n  version: \"2\"\n"), 0644)
+	kb, _ := LoadKnowledgeBase("file://" + d)
+	ct, _ := kb.Resolve("web")
+	a, e := kb.ThingMarkdown(ct)
+	if e != nil {
+		t.Fatal(e)
+	}
+	b := "---\nrelation:\n- kind: title\n  thing_url: server\n- kind: uuid\n  thing_url: db\ntitle: web\n---\n\n# web\n\n## Parameters\n\n```yaml\nversion: \"2\"\n```\n"
+	if string(a) != b {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", b, a)
+	}
+	c := t.TempDir()
+	kb.ExportMarkdown(c)
+	notes, errs := ReadMarkdownNotes(c)
+	if len(errs) > 0 || len(notes) != 2 {
+		t.Fatalf("Expected to read the notes back: %v.\n", errs)
+	}
+	f, e := MarkdownThing(notes[1], notes, MarkdownImportOptions{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	g := []ThingRelation{{ThingUrl: "server.yml", Kind: "title"}, {ThingUrl: "db", Kind: "uuid"}}
+	if f.Id.Uuid != "" || f.Id.Name != "web" || f.Id.Version != "" || !reflect.DeepEqual(f.Relation, g) {
+		t.Fatalf("Unexpected Thing imported back %v.\n", f)
+	}
+}
+
+func TestExportMarkdownCollision(t *testing.T) {
+
+	b := "---\nid:\n  name: one\n"
+	for _, a := range [][]string{{"b.yml", b, "b.yaml"}, {"b.yml", b + "---\nid:\n  name: two\n", "b-2.yml"}} {
+		d := t.TempDir()
+		os.WriteFile(filepath.Join(d, a[0]), []byte(a[1]), 0644)
+		os.WriteFile(filepath.Join(d, a[2]), []byte("---\nid:\n  name: three\n"), 0644)
+		kb, _ := LoadKnowledgeBase("file://" + d)
+		c := t.TempDir()
+		t.Log("Now failing successfully (same note):")
+		written, e := kb.ExportMarkdown(c)
+		if e == nil || len(written) > 0 {
+			t.Fatalf("Expected '%s' and '%s' to be refused, got %v.\n", a[0], a[2], written)
+		}
+		if f, _ := os.ReadDir(c); len(f) > 0 {
+			t.Fatalf("Expected nothing to be written, got %v.\n", f)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// A MergeConflict is a value both sides changed, each in its own way. The
+// path is that of a Change, it is empty if the whole Thing is concerned.
+type MergeConflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+func mergeForm(thing Thing) (interface{}, error) {
+
+	g, err := ToGeneric(thing)
+	if err != nil {
+		return nil, err
+	}
+	if g = pruneEmpty(g); g == nil {
+		g = map[string]interface{}{}
+	}
+	return g, nil
+}
+
+/*
+	MergeThings
+	  args
+		base			the common ancestor
+		ours, theirs	the two versions to merge
+	  returns
+		Thing			the merged Thing, where both sides changed a value
+						differently, our value is kept
+		[]MergeConflict	the values both sides changed differently
+*/
+func MergeThings(base Thing, ours Thing, theirs Thing) (Thing, []MergeConflict, error) {
+
+	var r Thing
+	b, err := mergeForm(base)
+	if err != nil {
+		return r, nil, err
+	}
+	o, err := mergeForm(ours)
+	if err != nil {
+		return r, nil, err
+	}
+	t, err := mergeForm(theirs)
+	if err != nil {
+		return r, nil, err
+	}
+	conflicts := []MergeConflict{}
+	m := mergeValues("", b, o, t, &conflicts)
+	j, err := json.Marshal(m)
+	if err != nil {
+		return r, nil, err
+	}
+	err = json.Unmarshal(j, &r)
+	return r, conflicts, err
+}
+
+func isMapOrNil(o interface{}) bool {
+	_, ok := o.(map[string]interface{})
+	return ok || o == nil
+}
+
+func isListOrNil(o interface{}) bool {
+	_, ok := o.([]interface{})
+	return ok || o == nil
+}
+
+func mergeValues(path string, base interface{}, ours interface{}, theirs interface{}, conflicts *[]MergeConflict) interface{} {
+
+	switch {
+	case reflect.DeepEqual(ours, theirs):
+		return ours
+	case reflect.DeepEqual(base, ours):
+		return theirs
+	case reflect.DeepEqual(base, theirs):
+		return ours
+	}
+	if isMapOrNil(base) && isMapOrNil(ours) && isMapOrNil(theirs) {
+		return mergeMaps(path, base, ours, theirs, conflicts)
+	}
+	if path == "relation" && isListOrNil(base) && isListOrNil(ours) && isListOrNil(theirs) {
+		return mergeRelations(base, ours, theirs, conflicts)
+	}
+	if l, ok := mergeAppended(base, ours, theirs); ok {
+		return l
+	}
+	*conflicts = append(*conflicts, MergeConflict{path, base, ours, theirs})
+	return ours
+}
+
+func mergeMaps(path string, base interface{}, ours interface{}, theirs interface{}, conflicts *[]MergeConflict) interface{} {
+
+	b, _ := base.(map[string]interface{})
+	o, _ := ours.(map[string]interface{})
+	t, _ := theirs.(map[string]interface{})
+	keys := make(map[string]interface{})
+	for _, m := range []map[string]interface{}{b, o, t} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	r := make(map[string]interface{})
+	for _, k := range SortedKeys(keys) {
+		if v := mergeValues(JoinPath(path, k), b[k], o[k], t[k], conflicts); v != nil {
+			r[k] = v
+		}
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	return r
+}
+
+// Both sides only appended to a list, e.g. to the authors: our entries
+// first, then theirs, without the duplicates.
+func mergeAppended(base interface{}, ours interface{}, theirs interface{}) ([]interface{}, bool) {
+
+	b, _ := base.([]interface{})
+	o, oOk := ours.([]interface{})
+	t, tOk := theirs.([]interface{})
+	if !oOk || !tOk || len(o) < len(b) || len(t) < len(b) {
+		return nil, false
+	}
+	if !reflect.DeepEqual(b, o[:len(b)]) || !reflect.DeepEqual(b, t[:len(b)]) {
+		return nil, false
+	}
+	r := append([]interface{}{}, o...)
+	for _, e := range t[len(b):] {
+		found := false
+		for _, f := range o[len(b):] {
+			if reflect.DeepEqual(e, f) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			r = append(r, e)
+		}
+	}
+	return r, true
+}
+
+// The relations are matched by relationKeys, so a repeated one by its
+// occurrence, the ones added on either side are all kept, ours first.
+func mergeRelations(base interface{}, ours interface{}, theirs interface{}, conflicts *[]MergeConflict) interface{} {
+
+	var keys []string
+	kinds := make(map[string]interface{})
+	byKey := func(o interface{}) map[string]interface{} {
+		r := make(map[string]interface{})
+		l, _ := o.([]interface{})
+		var fs []map[string]interface{}
+		var rs []ThingRelation
+		for _, e := range l {
+			f, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			kind, _ := f["kind"].(string)
+			url, _ := f["thing_url"].(string)
+			fs = append(fs, f)
+			rs = append(rs, ThingRelation{ThingUrl: url, Kind: kind})
+		}
+		for i, k := range relationKeys(rs) {
+			f := fs[i]
+			if _, ok := kinds[k]; !ok {
+				keys = append(keys, k)
+				kinds[k] = nil
+			}
+			// the kind is part of the key, where it can not be empty
+			m := make(map[string]interface{})
+			for n, v := range f {
+				if n == "kind" {
+					if kinds[k] == nil {
+						kinds[k] = v
+					}
+					continue
+				}
+				m[n] = v
+			}
+			r[k] = m
+		}
+		return r
+	}
+	o, t, b := byKey(ours), byKey(theirs), byKey(base)
+	var r []interface{}
+	for _, k := range keys {
+		v := mergeValues(JoinPath("relation", k), b[k], o[k], t[k], conflicts)
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if kinds[k] != nil {
+			m["kind"] = kinds[k]
+		}
+		r = append(r, m)
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	return r
+}
+
+type mergeDocument struct {
+	content []byte
+	thing   Thing
+	used    bool
+}
+
+func parseMergeDocuments(content []byte) ([]*mergeDocument, error) {
+
+	var r []*mergeDocument
+	for _, d := range SplitYAMLDocuments(content) {
+		var t Thing
+		if err := Unmarshal(d, &t); err != nil {
+			return nil, err
+		}
+		r = append(r, &mergeDocument{content: d, thing: t})
+	}
+	return r, nil
+}
+
+// The document with the same UUID, or else at the same position.
+func matchMergeDocument(documents []*mergeDocument, d *mergeDocument, i int) *mergeDocument {
+
+	if d.thing.Id.Uuid != "" {
+		for _, e := range documents {
+			if !e.used && e.thing.Id.Uuid == d.thing.Id.Uuid {
+				e.used = true
+				return e
+			}
+		}
+	}
+	if i < len(documents) && !documents[i].used && (documents[i].thing.Id.Uuid == "" || d.thing.Id.Uuid == "") {
+		documents[i].used = true
+		return documents[i]
+	}
+	return nil
+}
+
+// Append the conflicts to a document, the YAML stays valid and the rest of
+// the document is still a Thing.
+func addMergeConflicts(content []byte, conflicts []MergeConflict) ([]byte, error) {
+
+	if len(conflicts) == 0 {
+		return content, nil
+	}
+	c, err := Marshal(map[string]interface{}{"conflict": conflicts})
+	if err != nil {
+		return nil, err
+	}
+	return append(content, c...), nil
+}
+
+func sameThing(a Thing, b Thing) bool {
+	c, err := DiffThings(a, b)
+	return err == nil && len(c) == 0
+}
+
+/*
+	MergeThingFiles
+	  args
+		base			the content of the common ancestor, may be empty
+		ours, theirs	the contents of the two versions to merge
+	  returns
+		[]byte			the merged content, documents with conflicts have
+						them listed under 'conflict'
+		[]MergeConflict	all the conflicts
+	  The documents are matched by UUID, or else by their position.
+*/
+func MergeThingFiles(base []byte, ours []byte, theirs []byte) ([]byte, []MergeConflict, error) {
+
+	b, err := parseMergeDocuments(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	o, err := parseMergeDocuments(ours)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := parseMergeDocuments(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	var documents [][]byte
+	all := []MergeConflict{}
+	for i, d := range o {
+		x := matchMergeDocument(b, d, i)
+		y := matchMergeDocument(t, d, i)
+		var content []byte
+		var conflicts []MergeConflict
+		switch {
+		case y == nil && x != nil && sameThing(x.thing, d.thing):
+			// removed by them
+			continue
+		case y == nil && x != nil:
+			content = d.content
+			g, _ := mergeForm(x.thing)
+			h, _ := mergeForm(d.thing)
+			conflicts = []MergeConflict{{Base: g, Ours: h}}
+		case y == nil:
+			content = d.content
+		default:
+			base := Thing{}
+			if x != nil {
+				base = x.thing
+			}
+			var merged Thing
+			merged, conflicts, err = MergeThings(base, d.thing, y.thing)
+			if err != nil {
+				return nil, nil, err
+			}
+			if sameThing(merged, d.thing) {
+				content = d.content
+				break
+			}
+			doc, err := ParseThingDocument(d.content)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err = doc.update(&merged); err != nil {
+				return nil, nil, err
+			}
+			if content, err = doc.encode(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if content, err = addMergeConflicts(content, conflicts); err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, content)
+		all = append(all, conflicts...)
+	}
+	for i, d := range t {
+		if d.used {
+			continue
+		}
+		x := matchMergeDocument(b, d, i)
+		var conflicts []MergeConflict
+		switch {
+		case x != nil && sameThing(x.thing, d.thing):
+			// removed by us
+			continue
+		case x != nil:
+			g, _ := mergeForm(x.thing)
+			h, _ := mergeForm(d.thing)
+			conflicts = []MergeConflict{{Base: g, Theirs: h}}
+		}
+		content, err := addMergeConflicts(d.content, conflicts)
+		if err != nil {
+			return nil, nil, err
+		}
+		documents = append(documents, content)
+		all = append(all, conflicts...)
+	}
+	return JoinYAMLDocuments(documents), all, nil
+}
@@ -0,0 +1,104 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeThings(t *testing.T) {
+
+	var a, b, c, d Thing
+	Unmarshal([]byte("id:\n  name: web\nrelation:\n  - thing_url: server.yml\n  - thing_url: gone.yml\nparameter:\n  port: 80\n  host: a\nlegal:\n  author:\n    - name: Alice\n"), &a)
+	Unmarshal([]byte("id:\n  name: web\nrelation:\n  - thing_url: server.yml\n    kind: is\n  - thing_url: db.yml\n    kind: needs\nparameter:\n  port: 8080\n  host: a\nlegal:\n  author:\n    - name: Alice\n    - name: Bob\n"), &b)
+	Unmarshal([]byte("id:\n  name: web\n  version: \"2\"\nrelation:\n  - thing_url: server.yml\n  - thing_url: gone.yml\n  - thing_url: cache.yml\nparameter:\n  port: 80\n  host: b\nlegal:\n  author:\n    - name: Alice\n    - name: Carol\n"), &c)
+	m, conflicts, e := MergeThings(a, b, c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("Expected no conflicts, got %v.\n", conflicts)
+	}
+	Unmarshal([]byte("id:\n  name: web\n  version: \"2\"\nrelation:\n  - thing_url: server.yml\n    kind: is\n  - thing_url: db.yml\n    kind: needs\n  - thing_url: cache.yml\nparameter:\n  port: 8080\n  host: b\nlegal:\n  author:\n    - name: Alice\n    - name: Bob\n    - name: Carol\n"), &d)
+	if !reflect.DeepEqual(m, d) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", d, m)
+	}
+	// a repeated relation is merged by its occurrence
+	var g, h, i Thing
+	Unmarshal([]byte("relation:\n  - thing_url: db.yml\n    version: \"1\"\n  - thing_url: db.yml\n    version: \"2\"\n"), &g)
+	Unmarshal([]byte("relation:\n  - thing_url: db.yml\n    version: \"1\"\n  - thing_url: db.yml\n    version: \"3\"\n"), &h)
+	Unmarshal([]byte("relation:\n  - thing_url: db.yml\n    version: \"1\"\n    priority: high\n  - thing_url: db.yml\n    version: \"2\"\n"), &i)
+	n, conflicts, e := MergeThings(g, h, i)
+	l := []ThingRelation{{ThingUrl: "db.yml", Version: "1", Priority: "high"}, {ThingUrl: "db.yml", Version: "3"}}
+	if e != nil || len(conflicts) != 0 || !reflect.DeepEqual(n.Relation, l) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v %v %v", l, n.Relation, conflicts, e)
+	}
+	t.Log("Now failing successfully (the port changed on both sides):")
+	Unmarshal([]byte("id:\n  name: web\nparameter:\n  port: 443\n"), &c)
+	m, conflicts, e = MergeThings(a, b, c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	f := []MergeConflict{{"parameter.port", 80.0, 8080.0, 443.0}}
+	if !reflect.DeepEqual(conflicts, f) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", f, conflicts)
+	}
+	if m.Parameter["port"] != 8080.0 {
+		t.Fatalf("Expected our value to be kept, got %v.\n", m.Parameter["port"])
+	}
+}
+
+func TestMergeThingFiles(t *testing.T) {
+
+	a := []byte("---\nid:\n  uuid: \"1\"\n  name: web\nparameter:\n  port: 80\n---\nid:\n  uuid: \"2\"\n  name: db\n")
+	b := []byte("---\n# our comment\nid:\n  uuid: \"1\"\n  name: web\nparameter:\n  port: 8080\n---\nid:\n  uuid: \"2\"\n  name: db\n")
+	c := []byte("---\nid:\n  uuid: \"1\"\n  name: web\nparameter:\n  port: 80\n  host: b\n---\nid:\n  uuid: \"3\"\n  name: cache\n")
+	m, conflicts, e := MergeThingFiles(a, b, c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("Expected no conflicts, got %v.\n", conflicts)
+	}
+	d := "---\n# our comment\nid:\n  uuid: \"1\"\n  name: web\nparameter:\n  port: 8080\n  host: b\n---\nid:\n  uuid: \"3\"\n  name: cache\n"
+	if string(m) != d {
+		t.Fatalf("Expected ...\n%s... but got ...\n%s", d, m)
+	}
+	t.Log("Now failing successfully (the port changed on both sides):")
+	c = []byte("---\nid:\n  uuid: \"1\"\n  name: web\nparameter:\n  port: 443\n---\nid:\n  uuid: \"2\"\n  name: db\n")
+	m, conflicts, e = MergeThingFiles(a, b, c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "parameter.port" {
+		t.Fatalf("Expected a conflict on the port, got %v.\n", conflicts)
+	}
+	if !strings.Contains(string(m), "conflict:\n- base: 80\n  ours: 8080\n  path: parameter.port\n  theirs: 443\n") {
+		t.Fatalf("Expected the conflict to be listed, got ...\n%s", m)
+	}
+	// the result is still valid YAML and still the Things
+	documents := SplitYAMLDocuments(m)
+	if len(documents) != 2 {
+		t.Fatalf("Expected 2 documents, got %d.\n", len(documents))
+	}
+	var g map[string]interface{}
+	if e = Unmarshal(documents[0], &g); e != nil {
+		t.Fatal(e)
+	}
+	var h Thing
+	if e = Unmarshal(documents[0], &h); e != nil || h.Parameter["port"] != 8080.0 {
+		t.Fatalf("Expected our Thing to be kept: %v %v.\n", h, e)
+	}
+}
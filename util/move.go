@@ -0,0 +1,288 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A MoveEdit lists the references of a Thing rewritten by a move.
+type MoveEdit struct {
+	Location string   `json:"location"`
+	Changes  []Change `json:"changes"`
+}
+
+// A MovePlan is what a move of a Thing file would do, see PlanMove.
+type MovePlan struct {
+	// the paths relative to the context
+	From  string     `json:"from"`
+	To    string     `json:"to"`
+	Edits []MoveEdit `json:"edits"`
+	// the new content of the files changed, by their current path
+	files map[string][]byte
+}
+
+// Files returns the paths of the files changed, without the one moved.
+func (p *MovePlan) Files() []string {
+
+	var r []string
+	for f := range p.files {
+		if f != p.From {
+			r = append(r, f)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// The reference rewritten if it points to the file moved, in the same
+// style: relative, absolute or as file URL.
+func (kb *KnowledgeBase) movedReference(ref string, from string, to string) (string, bool) {
+
+	path, fragment := SplitThingFragment(ref)
+	if path == "" || filepath.Clean(kb.relativeLocation(path)) != from {
+		return ref, false
+	}
+	var r string
+	switch {
+	case strings.HasPrefix(path, "file://"):
+		r = "file://" + filepath.Join(kb.ContextPath, to)
+	case strings.HasPrefix(path, "/"):
+		r = filepath.Join(kb.ContextPath, to)
+	case strings.HasPrefix(path, "./"):
+		r = "./" + to
+	default:
+		r = to
+	}
+	if fragment != "" {
+		r += "#" + fragment
+	}
+	return r, true
+}
+
+// Rewrite the references of the Thing, that is its relations, schemas and
+// the dependencies of its behaviors, plus its own URLs if it is moved.
+func (kb *KnowledgeBase) moveReferences(t *Thing, from string, to string, moved bool) []Change {
+
+	var changes []Change
+	rewrite := func(path string, ref *string) {
+		if r, ok := kb.movedReference(*ref, from, to); ok && r != *ref {
+			changes = append(changes, Change{Op: "change", Path: path, Old: *ref, New: r})
+			*ref = r
+		}
+	}
+	if moved {
+		for i := range t.Id.Url {
+			rewrite("id.url["+strconv.Itoa(i)+"]", &t.Id.Url[i])
+		}
+	}
+	for i := range t.Relation {
+		rewrite("relation["+strconv.Itoa(i)+"].thing_url", &t.Relation[i].ThingUrl)
+	}
+	for i := range t.Schema {
+		if t.Schema[i].NameUrl != nil {
+			rewrite("schema["+strconv.Itoa(i)+"].url", &t.Schema[i].Url)
+		}
+	}
+	moveDependencies("behavior", t.Behavior, func(path string, ref string) string {
+		rewrite(path, &ref)
+		return ref
+	})
+	return changes
+}
+
+// Walk the generic behaviors and pass the URL of every dependency.
+func moveDependencies(path string, o interface{}, rewrite func(path string, ref string) string) {
+
+	switch v := o.(type) {
+	case map[string]interface{}:
+		for _, k := range SortedKeys(v) {
+			p := JoinPath(path, k)
+			if l, ok := v[k].([]interface{}); ok && k == "dependency" {
+				for i, e := range l {
+					d, ok := e.(map[string]interface{})
+					if u, isString := d["url"].(string); ok && isString {
+						d["url"] = rewrite(p+"["+strconv.Itoa(i)+"].url", u)
+					}
+				}
+				continue
+			}
+			moveDependencies(p, v[k], rewrite)
+		}
+	case []interface{}:
+		for i, e := range v {
+			moveDependencies(path+"["+strconv.Itoa(i)+"]", e, rewrite)
+		}
+	}
+}
+
+// Rewrite the references in every document of a file, the comments and the
+// style of the documents are kept and no UUIDs are made up.
+func (kb *KnowledgeBase) moveFile(rel string, from string, to string) ([]byte, []MoveEdit, error) {
+
+	content, err := os.ReadFile(filepath.Join(kb.ContextPath, rel))
+	if err != nil {
+		return nil, nil, err
+	}
+	location := rel
+	if rel == from {
+		location = to
+	}
+	documents := SplitYAMLDocuments(content)
+	var edits []MoveEdit
+	for i, d := range documents {
+		var t Thing
+		if err := Unmarshal(d, &t); err != nil {
+			return nil, nil, fmt.Errorf("%s#%d: %s", rel, i+1, err)
+		}
+		changes := kb.moveReferences(&t, from, to, rel == from)
+		if len(changes) == 0 {
+			continue
+		}
+		doc, err := ParseThingDocument(d)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s#%d: %s", rel, i+1, err)
+		}
+		if err = doc.update(&t); err != nil {
+			return nil, nil, err
+		}
+		if documents[i], err = doc.encode(); err != nil {
+			return nil, nil, err
+		}
+		l := location
+		if len(documents) > 1 {
+			l += "#" + strconv.Itoa(i+1)
+		}
+		edits = append(edits, MoveEdit{l, changes})
+	}
+	if len(edits) == 0 {
+		return nil, nil, nil
+	}
+	return JoinYAMLDocuments(documents), edits, nil
+}
+
+/*
+	PlanMove
+	  args
+		ct			a Thing of the file to move, the other Things in the
+					same file move along
+		to			the new path of the file, relative to the context
+	  returns
+		MovePlan	the references that would be rewritten in the files
+					of the context
+*/
+func (kb *KnowledgeBase) PlanMove(ct *ContextThing, to string) (*MovePlan, error) {
+
+	to, err := ContextRelativePath(to)
+	if err != nil {
+		return nil, err
+	}
+	if !isThingFile(to) {
+		return nil, fmt.Errorf("Not a Thing file, use '.yml' or '.yaml': %s.\n", to)
+	}
+	if _, err := os.Stat(filepath.Join(kb.ContextPath, to)); !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Not overwriting: %s.\n", to)
+	}
+	plan := &MovePlan{From: ct.Path, To: to, Edits: []MoveEdit{}, files: make(map[string][]byte)}
+	seen := make(map[string]bool)
+	for _, t := range kb.SortedThings() {
+		if seen[t.Path] {
+			continue
+		}
+		seen[t.Path] = true
+		content, edits, err := kb.moveFile(t.Path, plan.From, to)
+		if err != nil {
+			return nil, err
+		}
+		if content != nil {
+			plan.files[t.Path] = content
+			plan.Edits = append(plan.Edits, edits...)
+		}
+	}
+	return plan, nil
+}
+
+/*
+	ApplyMove
+	  args
+		plan		the move as planned by PlanMove
+	  The file is written to its new path first and only removed from the
+	  old one when all the referrers are rewritten, each replaced as a
+	  whole and keeping its mode. If anything fails, the files written so
+	  far are restored, the error also names the ones that could not be.
+*/
+func (kb *KnowledgeBase) ApplyMove(plan *MovePlan) error {
+
+	from := filepath.Join(kb.ContextPath, plan.From)
+	to := filepath.Join(kb.ContextPath, plan.To)
+	fi, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	content, ok := plan.files[plan.From]
+	if !ok {
+		content, err = os.ReadFile(from)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(to, content, fi.Mode().Perm())
+	if err != nil {
+		os.Remove(to)
+		return err
+	}
+	var written []string
+	originals := make(map[string][]byte)
+	rollback := func(err error) error {
+		var failed []string
+		for _, f := range written {
+			if rerr := ReplaceFile(filepath.Join(kb.ContextPath, f), originals[f]); rerr != nil {
+				failed = append(failed, rerr.Error())
+			}
+		}
+		if rerr := os.Remove(to); rerr != nil {
+			failed = append(failed, rerr.Error())
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%s\nThe files could not all be restored:\n%s\n", strings.TrimSpace(err.Error()), strings.Join(failed, "\n"))
+		}
+		return err
+	}
+	for _, f := range plan.Files() {
+		p := filepath.Join(kb.ContextPath, f)
+		c, err := os.ReadFile(p)
+		if err != nil {
+			return rollback(err)
+		}
+		originals[f] = c
+		err = ReplaceFile(p, plan.files[f])
+		if err != nil {
+			return rollback(err)
+		}
+		written = append(written, f)
+	}
+	err = os.Remove(from)
+	if err != nil {
+		return rollback(err)
+	}
+	return nil
+}
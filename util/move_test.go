@@ -0,0 +1,130 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMoveThing(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "server.yml"), []byte("---\n# the server\nid:\n  name: server\n  url:\n    - server.yml\n    - https://example.com/server\nrelation:\n  - thing_url: ./server.yml\n"), 0644)
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("---\nid:\n  name: web\nrelation:\n  - thing_url: server.yml\n    kind: is\n  - thing_url: file://"+d+"/server.yml\nbehavior:\n  install:\n    dependency:\n      - name: server\n        url: "+d+"/server.yml\n---\nid:\n  name: other\nschema:\n  - url: server.yml\n"), 0644)
+	os.WriteFile(filepath.Join(d, "db.yml"), []byte("---\nid:\n  name: db\nrelation:\n  - thing_url: server\n"), 0644)
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ct, _ := kb.Resolve("server")
+	a, e := kb.PlanMove(ct, "hosts/server.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	b := []MoveEdit{
+		{"hosts/server.yml", []Change{
+			{Op: "change", Path: "id.url[0]", Old: "server.yml", New: "hosts/server.yml"},
+			{Op: "change", Path: "relation[0].thing_url", Old: "./server.yml", New: "./hosts/server.yml"},
+		}},
+		{"web.yml#1", []Change{
+			{Op: "change", Path: "relation[0].thing_url", Old: "server.yml", New: "hosts/server.yml"},
+			{Op: "change", Path: "relation[1].thing_url", Old: "file://" + d + "/server.yml", New: "file://" + d + "/hosts/server.yml"},
+			{Op: "change", Path: "behavior.install.dependency[0].url", Old: d + "/server.yml", New: d + "/hosts/server.yml"},
+		}},
+		{"web.yml#2", []Change{
+			{Op: "change", Path: "schema[0].url", Old: "server.yml", New: "hosts/server.yml"},
+		}},
+	}
+	if !reflect.DeepEqual(a.Edits, b) {
+		t.Fatalf("Expected ...\n%v\n... but got ...\n%v", b, a.Edits)
+	}
+	if c := a.Files(); !reflect.DeepEqual(c, []string{"web.yml"}) {
+		t.Fatalf("Expected only web.yml to change, got %v.\n", c)
+	}
+	// nothing is written before the plan is applied
+	if _, e = os.Stat(filepath.Join(d, "server.yml")); e != nil {
+		t.Fatal(e)
+	}
+	if e = kb.ApplyMove(a); e != nil {
+		t.Fatal(e)
+	}
+	kb, _ = LoadKnowledgeBase("file://" + d)
+	ct, e = kb.Resolve("server")
+	if e != nil || ct.Path != "hosts/server.yml" {
+		t.Fatalf("Expected the Thing to be moved: %v %v.\n", ct, e)
+	}
+	c, _ := os.ReadFile(filepath.Join(d, "hosts", "server.yml"))
+	if string(c) != "---\n# the server\nid:\n  name: server\n  url:\n    - hosts/server.yml\n    - https://example.com/server\nrelation:\n  - thing_url: ./hosts/server.yml\n" {
+		t.Fatalf("Unexpected content of the moved file:\n%s", c)
+	}
+	for _, o := range kb.Things {
+		if p := kb.CheckLinks(o); len(p) > 0 {
+			t.Fatalf("Expected all the links to resolve, got %v.\n", p)
+		}
+	}
+	t.Log("Now failing successfully (the target exists):")
+	if _, e = kb.PlanMove(ct, "web.yml"); e == nil {
+		t.Fatal("Expected an error for an existing target.\n")
+	}
+	t.Log("Now failing successfully (outside of the context):")
+	if _, e = kb.PlanMove(ct, "../server.yml"); e == nil {
+		t.Fatal("Expected an error for a target outside the context.\n")
+	}
+}
+
+func TestApplyMoveRollback(t *testing.T) {
+
+	d := t.TempDir()
+	os.WriteFile(filepath.Join(d, "server.yml"), []byte("id:\n  name: server\n"), 0600)
+	a := "id:\n  name: db\nrelation:\n  - thing_url: server.yml\n"
+	os.WriteFile(filepath.Join(d, "db.yml"), []byte(a), 0640)
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nrelation:\n  - thing_url: server.yml\n"), 0644)
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ct, _ := kb.Resolve("server")
+	b, e := kb.PlanMove(ct, "hosts/server.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Log("Now failing successfully (a referrer can not be written):")
+	os.Remove(filepath.Join(d, "web.yml"))
+	os.Mkdir(filepath.Join(d, "web.yml"), 0755)
+	if e = kb.ApplyMove(b); e == nil {
+		t.Fatal("Expected the move to fail.")
+	}
+	if c, _ := os.ReadFile(filepath.Join(d, "db.yml")); string(c) != a {
+		t.Fatalf("Expected db.yml to be restored, got:\n%s", c)
+	}
+	if _, e = os.Stat(filepath.Join(d, "server.yml")); e != nil {
+		t.Fatalf("Expected the file not to be moved: %s.\n", e)
+	}
+	if _, e = os.Stat(filepath.Join(d, "hosts", "server.yml")); !os.IsNotExist(e) {
+		t.Fatalf("Expected the new file to be removed again: %v.\n", e)
+	}
+	os.Remove(filepath.Join(d, "web.yml"))
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\n"), 0644)
+	if e = kb.ApplyMove(b); e != nil {
+		t.Fatal(e)
+	}
+	if c, e := os.Stat(filepath.Join(d, "hosts", "server.yml")); e != nil || c.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the moved file to keep its mode: %v %v.\n", c, e)
+	}
+	if c, e := os.Stat(filepath.Join(d, "db.yml")); e != nil || c.Mode().Perm() != 0640 {
+		t.Fatalf("Expected the referrer to keep its mode: %v %v.\n", c, e)
+	}
+}
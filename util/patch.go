@@ -0,0 +1,185 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ApplyMergePatch applies a JSON merge patch (RFC 7386) to a generic value:
+// maps are merged recursively, 'null' removes a key and everything else
+// replaces the original value.
+func ApplyMergePatch(target interface{}, patch interface{}) interface{} {
+
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	r := make(map[string]interface{})
+	for k, v := range t {
+		r[k] = v
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(r, k)
+		} else {
+			r[k] = ApplyMergePatch(r[k], v)
+		}
+	}
+	return r
+}
+
+// A PatchOperation is one step of a JSON patch (RFC 6902), only 'add',
+// 'remove' and 'replace' are used.
+type PatchOperation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"op": o.Op, "path": o.Path}
+	if o.Op != "remove" {
+		m["value"] = o.Value
+	}
+	return json.Marshal(m)
+}
+
+func (o *PatchOperation) UnmarshalJSON(b []byte) error {
+	var m struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+	err := json.Unmarshal(b, &m)
+	o.Op, o.Path, o.Value = m.Op, m.Path, m.Value
+	return err
+}
+
+// Turn a JSON pointer into its tokens.
+func pointerTokens(pointer string) ([]string, error) {
+
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("The JSON pointer '%s' must start with '/'.\n", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func pointerToken(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// ApplyJSONPatch applies the operations to a generic value, one after the
+// other, and returns the result.
+func ApplyJSONPatch(doc interface{}, patch []PatchOperation) (interface{}, error) {
+
+	var err error
+	for _, o := range patch {
+		tokens, err := pointerTokens(o.Path)
+		if err != nil {
+			return doc, err
+		}
+		doc, err = applyPatchOperation(doc, tokens, o)
+		if err != nil {
+			return doc, err
+		}
+	}
+	return doc, err
+}
+
+func applyPatchOperation(doc interface{}, tokens []string, o PatchOperation) (interface{}, error) {
+
+	if len(tokens) == 0 {
+		if o.Op == "remove" {
+			return nil, nil
+		}
+		return o.Value, nil
+	}
+	t := tokens[0]
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if len(tokens) > 1 {
+			c, ok := v[t]
+			if !ok {
+				return doc, fmt.Errorf("%s: there is no '%s'.\n", o.Path, t)
+			}
+			n, err := applyPatchOperation(c, tokens[1:], o)
+			v[t] = n
+			return v, err
+		}
+		_, ok := v[t]
+		switch o.Op {
+		case "add":
+			v[t] = o.Value
+		case "replace", "remove":
+			if !ok {
+				return doc, fmt.Errorf("%s: there is no '%s'.\n", o.Path, t)
+			}
+			if o.Op == "replace" {
+				v[t] = o.Value
+			} else {
+				delete(v, t)
+			}
+		default:
+			return doc, fmt.Errorf("%s: the operation '%s' is not supported.\n", o.Path, o.Op)
+		}
+		return v, nil
+	case []interface{}:
+		i := len(v)
+		if t != "-" {
+			n, err := strconv.Atoi(t)
+			if err != nil || n < 0 || n > len(v) {
+				return doc, fmt.Errorf("%s: there is no element '%s'.\n", o.Path, t)
+			}
+			i = n
+		}
+		if len(tokens) > 1 || o.Op != "add" {
+			if i >= len(v) {
+				return doc, fmt.Errorf("%s: there is no element '%s'.\n", o.Path, t)
+			}
+		}
+		if len(tokens) > 1 {
+			n, err := applyPatchOperation(v[i], tokens[1:], o)
+			v[i] = n
+			return v, err
+		}
+		switch o.Op {
+		case "add":
+			v = append(v, nil)
+			copy(v[i+1:], v[i:])
+			v[i] = o.Value
+		case "replace":
+			v[i] = o.Value
+		case "remove":
+			v = append(v[:i], v[i+1:]...)
+		default:
+			return doc, fmt.Errorf("%s: the operation '%s' is not supported.\n", o.Path, o.Op)
+		}
+		return v, nil
+	}
+	return doc, fmt.Errorf("%s: '%s' is not inside an object or array.\n", o.Path, t)
+}
@@ -0,0 +1,53 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+
+	var a, b, c interface{}
+	json.Unmarshal([]byte(`{"id": {"name": "a", "version": "1"}, "parameter": {"x": 1, "y": [1, 2]}}`), &a)
+	json.Unmarshal([]byte(`{"id": {"version": "2"}, "parameter": {"x": null, "y": [3]}, "legal": {"author": []}}`), &b)
+	json.Unmarshal([]byte(`{"id": {"name": "a", "version": "2"}, "parameter": {"y": [3]}, "legal": {"author": []}}`), &c)
+	d := ApplyMergePatch(a, b)
+	if !reflect.DeepEqual(c, d) {
+		t.Fatalf("The patch was not applied correctly: %v.\n", d)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+
+	var a, b, c interface{}
+	var p []PatchOperation
+	json.Unmarshal([]byte(`{"id": {"name": "a"}, "relation": [{"thing_url": "x"}, {"thing_url": "y"}], "a/b": 1}`), &a)
+	json.Unmarshal([]byte(`[{"op": "replace", "path": "/id/name", "value": "b"}, {"op": "remove", "path": "/relation/0"}, {"op": "add", "path": "/relation/-", "value": {"thing_url": "z"}}, {"op": "remove", "path": "/a~1b"}, {"op": "add", "path": "/parameter", "value": {"x": false}}]`), &p)
+	json.Unmarshal([]byte(`{"id": {"name": "b"}, "relation": [{"thing_url": "y"}, {"thing_url": "z"}], "parameter": {"x": false}}`), &c)
+	b, e := ApplyJSONPatch(a, p)
+	if e != nil || !reflect.DeepEqual(b, c) {
+		t.Fatalf("The patch was not applied correctly: %v %v.\n", b, e)
+	}
+	d, _ := json.Marshal(p[1])
+	if string(d) != `{"op":"remove","path":"/relation/0"}` {
+		t.Fatalf("Unexpected JSON for a remove operation: %s.\n", d)
+	}
+	t.Log("Now failing successfully (missing path):")
+	if _, e = ApplyJSONPatch(c, []PatchOperation{{"replace", "/id/version", "2"}}); e == nil {
+		t.Fatal("Expected an error for a missing path.")
+	}
+}
@@ -0,0 +1,319 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var PathNotFoundError = errors.New("The path does not exist.\n")
+
+// A PathError tells which part of a path could not be found.
+type PathError struct {
+	Path   string
+	Reason string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("Path '%s': %s.", e.Path, e.Reason)
+}
+
+func (e *PathError) Unwrap() error {
+	return PathNotFoundError
+}
+
+type pathStep struct {
+	// one of: key, index, wildcard, filter
+	kind  string
+	key   string
+	index int
+	// for filters
+	field []string
+	op    string
+	value interface{}
+	text  string
+}
+
+/*
+	QueryPath
+	  args
+		data		the generic value to query, see ToGeneric
+		expr		the path, e.g. 'network.interfaces[0].ip', where
+					'*' and '[*]' match every key or element and
+					'[?(@.name == 'eth0')]' filters the elements
+	  returns
+		interface{}	the value, or a slice of all the values found if
+					the path contains a wildcard or a filter
+		error		a *PathError if nothing was found
+*/
+func QueryPath(data interface{}, expr string) (interface{}, error) {
+
+	steps, err := parsePath(expr)
+	if err != nil {
+		return nil, err
+	}
+	current := []interface{}{data}
+	definite := true
+	done := ""
+	for _, s := range steps {
+		var next []interface{}
+		for _, c := range current {
+			next = append(next, s.apply(c)...)
+		}
+		done += s.text
+		if s.kind == "wildcard" || s.kind == "filter" {
+			definite = false
+		}
+		if len(next) == 0 {
+			return nil, &PathError{strings.TrimPrefix(done, "."), "nothing found"}
+		}
+		current = next
+	}
+	if definite {
+		return current[0], nil
+	}
+	return current, nil
+}
+
+func parsePath(expr string) ([]pathStep, error) {
+
+	var steps []pathStep
+	e := strings.TrimPrefix(strings.TrimSpace(expr), "$")
+	for len(e) > 0 {
+		switch {
+		case e[0] == '.':
+			e = e[1:]
+		case e[0] == '[':
+			end := matchingBracket(e)
+			if end < 0 {
+				return nil, &PathError{expr, "unbalanced brackets"}
+			}
+			s, err := parseBracket(e[1:end])
+			if err != nil {
+				return nil, &PathError{expr, err.Error()}
+			}
+			s.text = e[:end+1]
+			steps = append(steps, s)
+			e = e[end+1:]
+		default:
+			end := strings.IndexAny(e, ".[")
+			if end < 0 {
+				end = len(e)
+			}
+			k := e[:end]
+			if k == "*" {
+				steps = append(steps, pathStep{kind: "wildcard", text: "." + k})
+			} else {
+				steps = append(steps, pathStep{kind: "key", key: k, text: "." + k})
+			}
+			e = e[end:]
+		}
+	}
+	return steps, nil
+}
+
+// Find the closing bracket, brackets inside quotes do not count.
+func matchingBracket(e string) int {
+
+	depth := 0
+	var quote byte
+	for i := 0; i < len(e); i++ {
+		switch {
+		case quote != 0:
+			if e[i] == quote {
+				quote = 0
+			}
+		case e[i] == '\'' || e[i] == '"':
+			quote = e[i]
+		case e[i] == '[':
+			depth++
+		case e[i] == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseBracket(b string) (pathStep, error) {
+
+	b = strings.TrimSpace(b)
+	if b == "*" {
+		return pathStep{kind: "wildcard"}, nil
+	}
+	if n, err := strconv.Atoi(b); err == nil {
+		return pathStep{kind: "index", index: n}, nil
+	}
+	if len(b) > 1 && (b[0] == '\'' || b[0] == '"') && b[len(b)-1] == b[0] {
+		return pathStep{kind: "key", key: b[1 : len(b)-1]}, nil
+	}
+	if strings.HasPrefix(b, "?(") && strings.HasSuffix(b, ")") {
+		return parseFilter(strings.TrimSpace(b[2 : len(b)-1]))
+	}
+	return pathStep{}, fmt.Errorf("can not parse '[%s]'", b)
+}
+
+var filterOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseFilter(f string) (pathStep, error) {
+
+	s := pathStep{kind: "filter"}
+	field := f
+	for _, op := range filterOperators {
+		if i := strings.Index(f, op); i > 0 {
+			field = strings.TrimSpace(f[:i])
+			s.op = op
+			s.value = parseLiteral(strings.TrimSpace(f[i+len(op):]))
+			break
+		}
+	}
+	if field != "@" && !strings.HasPrefix(field, "@.") {
+		return s, fmt.Errorf("the filter '%s' must refer to '@'", f)
+	}
+	if field != "@" {
+		s.field = strings.Split(field[2:], ".")
+	}
+	return s, nil
+}
+
+func parseLiteral(l string) interface{} {
+
+	if len(l) > 1 && (l[0] == '\'' || l[0] == '"') && l[len(l)-1] == l[0] {
+		return l[1 : len(l)-1]
+	}
+	switch l {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if n, err := strconv.ParseFloat(l, 64); err == nil {
+		return n
+	}
+	return l
+}
+
+func (s pathStep) apply(c interface{}) []interface{} {
+
+	switch s.kind {
+	case "key":
+		if m, ok := c.(map[string]interface{}); ok {
+			if v, ok := m[s.key]; ok {
+				return []interface{}{v}
+			}
+		}
+	case "index":
+		if l, ok := c.([]interface{}); ok {
+			i := s.index
+			if i < 0 {
+				i += len(l)
+			}
+			if i >= 0 && i < len(l) {
+				return []interface{}{l[i]}
+			}
+		}
+	case "wildcard", "filter":
+		var r []interface{}
+		for _, v := range children(c) {
+			if s.kind == "wildcard" || s.matches(v) {
+				r = append(r, v)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+// The elements of a list, or the values of a map ordered by key.
+func children(c interface{}) []interface{} {
+
+	switch v := c.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var r []interface{}
+		for _, k := range keys {
+			r = append(r, v[k])
+		}
+		return r
+	}
+	return nil
+}
+
+func (s pathStep) matches(v interface{}) bool {
+
+	for _, f := range s.field {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		v, ok = m[f]
+		if !ok {
+			return false
+		}
+	}
+	switch s.op {
+	case "":
+		return v != nil && v != false
+	case "==":
+		return reflect.DeepEqual(v, s.value)
+	case "!=":
+		return !reflect.DeepEqual(v, s.value)
+	}
+	a, aok := v.(float64)
+	b, bok := s.value.(float64)
+	if !aok || !bok {
+		as, aok := v.(string)
+		bs, bok := s.value.(string)
+		if !aok || !bok {
+			return false
+		}
+		return compare(strings.Compare(as, bs), s.op)
+	}
+	c := 0
+	if a < b {
+		c = -1
+	} else if a > b {
+		c = 1
+	}
+	return compare(c, s.op)
+}
+
+func compare(c int, op string) bool {
+
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
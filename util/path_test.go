@@ -0,0 +1,77 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQueryPath(t *testing.T) {
+
+	a, e := ParseThing([]byte(`
+parameter:
+  network:
+    interfaces:
+      - name: eth0
+        ip: 10.0.0.1
+        mtu: 1500
+      - name: eth1
+        ip: 10.0.1.1
+        mtu: 9000
+  "dotted.key": yes
+`))
+	if e != nil {
+		t.Fatal(e)
+	}
+	b, e := ToGeneric(a.Parameter)
+	if e != nil {
+		t.Fatal(e)
+	}
+	tests := map[string]interface{}{
+		"network.interfaces[0].ip":                      "10.0.0.1",
+		"$.network.interfaces[-1].name":                 "eth1",
+		"['dotted.key']":                                true,
+		"network.interfaces[*].name":                    []interface{}{"eth0", "eth1"},
+		"network.*[1].mtu":                              []interface{}{float64(9000)},
+		"network.interfaces[?(@.name == 'eth1')].ip":    []interface{}{"10.0.1.1"},
+		"network.interfaces[?(@.mtu > 1500)].name":      []interface{}{"eth1"},
+		"network.interfaces[?(@.mtu<=1500)].name":       []interface{}{"eth0"},
+		"network.interfaces[?(@.name)].mtu":             []interface{}{float64(1500), float64(9000)},
+		"network.interfaces[?(@.name != \"eth0\")].mtu": []interface{}{float64(9000)},
+	}
+	for p, r := range tests {
+		c, e := QueryPath(b, p)
+		if e != nil {
+			t.Fatalf("Querying '%s' failed: %s.\n", p, e)
+		}
+		if !reflect.DeepEqual(c, r) {
+			t.Fatalf("Querying '%s' returned %v instead of %v.\n", p, c, r)
+		}
+	}
+	t.Log("Now failing successfully (missing paths):")
+	for _, p := range []string{"network.routes", "network.interfaces[2]", "network.interfaces[?(@.mtu > 9000)]", "network.interfaces[0", "x[?(name)]"} {
+		_, e := QueryPath(b, p)
+		if e == nil {
+			t.Fatalf("Querying '%s' should have failed.\n", p)
+		}
+		t.Logf("got the expected error: %s\n", e)
+	}
+	_, e = QueryPath(b, "network.interfaces[0].gateway")
+	var pe *PathError
+	if !errors.As(e, &pe) || !errors.Is(e, PathNotFoundError) || pe.Path != "network.interfaces[0].gateway" {
+		t.Fatalf("The error should tell where the path failed: %s.\n", e)
+	}
+}
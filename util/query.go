@@ -0,0 +1,519 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A QueryError tells which part of a query could not be understood.
+type QueryError struct {
+	Query  string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("Query '%s': %s.", e.Query, e.Reason)
+}
+
+// A term of a relation pattern, either a variable or a reference to a
+// Thing, see Resolve.
+type queryTerm struct {
+	variable string
+	ref      string
+}
+
+type queryClause struct {
+	negated bool
+	// for relation patterns: subject kind object, the kind '_' matches
+	// every kind, a closure of '+' or '*' follows the relations one or
+	// more, or zero or more times
+	subject queryTerm
+	kind    string
+	closure string
+	object  queryTerm
+	// for predicates: ?variable.path, with an operator or just the path
+	// to check the value exists
+	path   string
+	filter pathStep
+}
+
+// A Query is a list of clauses all bindings of its variables must match.
+type Query struct {
+	// the variables to return, all of them in the order they appear if
+	// not selected by 'find'
+	Vars    []string
+	clauses []queryClause
+	text    string
+}
+
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+var queryOperators = []string{"==", "!=", "<=", ">=", "<", ">", "~"}
+
+// Split the query into words, quoted strings, operators and commas. Paths
+// are kept in one piece, brackets and all.
+func tokenizeQuery(expr string) ([]queryToken, error) {
+
+	var tokens []queryToken
+	e := expr
+	for len(e) > 0 {
+		c := e[0]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			e = e[1:]
+		case c == ',':
+			tokens = append(tokens, queryToken{text: ","})
+			e = e[1:]
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(e[1:], c)
+			if end < 0 {
+				return nil, &QueryError{expr, "unbalanced quotes"}
+			}
+			tokens = append(tokens, queryToken{text: e[1 : end+1], quoted: true})
+			e = e[end+2:]
+		case strings.IndexByte("=!<>~", c) >= 0:
+			op := ""
+			for _, o := range queryOperators {
+				if strings.HasPrefix(e, o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &QueryError{expr, fmt.Sprintf("unknown operator at '%s'", e)}
+			}
+			tokens = append(tokens, queryToken{text: op})
+			e = e[len(op):]
+		default:
+			i := 0
+			for depth := 0; i < len(e); i++ {
+				if e[i] == '[' {
+					depth++
+				} else if e[i] == ']' {
+					depth--
+				} else if depth > 0 && (e[i] == '"' || e[i] == '\'') {
+					if end := strings.IndexByte(e[i+1:], e[i]); end >= 0 {
+						i += end + 1
+					}
+				} else if depth == 0 && strings.IndexByte(" \t\n\r,=!<>~", e[i]) >= 0 {
+					break
+				}
+			}
+			tokens = append(tokens, queryToken{text: e[:i]})
+			e = e[i:]
+		}
+	}
+	return tokens, nil
+}
+
+func isQueryVariable(t queryToken) bool {
+	return !t.quoted && len(t.text) > 1 && t.text[0] == '?'
+}
+
+func queryTermOf(t queryToken) queryTerm {
+
+	if isQueryVariable(t) {
+		return queryTerm{variable: t.text[1:]}
+	}
+	return queryTerm{ref: t.text}
+}
+
+func (q *Query) addVariable(v string, vars map[string]bool) {
+
+	if !vars[v] {
+		vars[v] = true
+		q.Vars = append(q.Vars, v)
+	}
+}
+
+/*
+	ParseQuery
+	  args
+		expr		the query, clauses separated by ',' or 'and', e.g.
+					'?x is+ server, ?x depends_on ?y,
+					 ?y.legal.license[*].name ~ GPL', where a clause is
+					either a relation pattern 'SUBJECT KIND OBJECT', with
+					the kind '_' matching any kind and 'KIND+' or 'KIND*'
+					following the relations one or more, or zero or more
+					times, or a predicate '?x.PATH OP VALUE' on the Thing,
+					see QueryPath, with one of the operators ==, !=, <,
+					<=, >, >= or ~ (contains, ignoring the case), or just
+					'?x.PATH' for the value to exist; a clause prefixed by
+					'not' must not match, all its variables bound by the
+					clauses before it, and 'find ?x ?y where' in front
+					selects the variables to return
+	  returns
+		*Query		the parsed query
+		error		a *QueryError
+*/
+func ParseQuery(expr string) (*Query, error) {
+
+	q := &Query{text: strings.TrimSpace(expr)}
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]bool)
+	if len(tokens) > 0 && !tokens[0].quoted && tokens[0].text == "find" {
+		i := 1
+		for ; i < len(tokens) && isQueryVariable(tokens[i]); i++ {
+			q.addVariable(tokens[i].text[1:], vars)
+		}
+		if i == 1 || i == len(tokens) || tokens[i].quoted || tokens[i].text != "where" {
+			return nil, &QueryError{q.text, "expected 'find ?variable ... where'"}
+		}
+		tokens = tokens[i+1:]
+	}
+	selected := len(q.Vars) > 0
+	bound := make(map[string]bool)
+	var clause []queryToken
+	for i := 0; i <= len(tokens); i++ {
+		if i < len(tokens) && (tokens[i].quoted || (tokens[i].text != "," && tokens[i].text != "and")) {
+			clause = append(clause, tokens[i])
+			continue
+		}
+		c, err := parseQueryClause(clause)
+		if err != nil {
+			return nil, &QueryError{q.text, err.Error()}
+		}
+		q.clauses = append(q.clauses, c)
+		for _, t := range []queryTerm{c.subject, c.object} {
+			if t.variable == "" {
+				continue
+			}
+			// a negation can only rule out what is known already
+			if c.negated && !bound[t.variable] {
+				return nil, &QueryError{q.text, fmt.Sprintf("the variable '?%s' of a 'not' clause is not bound by a clause before", t.variable)}
+			}
+			if !c.negated {
+				bound[t.variable] = true
+				if !selected {
+					q.addVariable(t.variable, vars)
+				}
+			}
+		}
+		clause = nil
+	}
+	for _, v := range q.Vars {
+		found := false
+		for _, c := range q.clauses {
+			found = found || (!c.negated && (c.subject.variable == v || c.object.variable == v))
+		}
+		if !found {
+			return nil, &QueryError{q.text, fmt.Sprintf("the variable '?%s' is not used", v)}
+		}
+	}
+	return q, nil
+}
+
+func parseQueryClause(tokens []queryToken) (queryClause, error) {
+
+	var c queryClause
+	if len(tokens) > 0 && !tokens[0].quoted && tokens[0].text == "not" {
+		c.negated = true
+		tokens = tokens[1:]
+	}
+	var text []string
+	for _, t := range tokens {
+		text = append(text, t.text)
+	}
+	if len(tokens) == 0 {
+		return c, fmt.Errorf("empty clause")
+	}
+	if i := strings.IndexAny(tokens[0].text, ".["); isQueryVariable(tokens[0]) && i > 1 {
+		c.subject = queryTerm{variable: tokens[0].text[1:i]}
+		c.path = tokens[0].text[i:]
+		if _, err := parsePath(c.path); err != nil {
+			return c, err
+		}
+		c.filter = pathStep{kind: "filter"}
+		switch len(tokens) {
+		case 1:
+			return c, nil
+		case 3:
+			c.filter.op = tokens[1].text
+			c.filter.value = tokens[2].text
+			if !tokens[2].quoted {
+				c.filter.value = parseLiteral(tokens[2].text)
+			}
+			for _, o := range queryOperators {
+				if !tokens[1].quoted && o == c.filter.op {
+					return c, nil
+				}
+			}
+		}
+		return c, fmt.Errorf("can not parse the predicate '%s'", strings.Join(text, " "))
+	}
+	if len(tokens) != 3 || tokens[1].quoted {
+		return c, fmt.Errorf("can not parse the clause '%s'", strings.Join(text, " "))
+	}
+	c.subject = queryTermOf(tokens[0])
+	c.object = queryTermOf(tokens[2])
+	c.kind = tokens[1].text
+	if strings.HasSuffix(c.kind, "+") || strings.HasSuffix(c.kind, "*") {
+		c.closure = c.kind[len(c.kind)-1:]
+		c.kind = c.kind[:len(c.kind)-1]
+	}
+	if c.kind == "" {
+		return c, fmt.Errorf("the clause '%s' has no kind", strings.Join(text, " "))
+	}
+	return c, nil
+}
+
+// A relation between two Things, relations without kind are 'is'.
+type relationEdge struct {
+	kind string
+	to   *ContextThing
+}
+
+// Build the relation graph once, in both directions.
+func (kb *KnowledgeBase) relationGraph() {
+
+	if kb.outgoing != nil {
+		return
+	}
+	kb.outgoing = make(map[*ContextThing][]relationEdge)
+	kb.incoming = make(map[*ContextThing][]relationEdge)
+	for _, ct := range kb.Things {
+		for _, l := range ct.Relation {
+			if t, err := kb.ResolveRelation(l.ThingUrl); err == nil {
+				kb.addRelationEdge(ct, l.Kind, t)
+			}
+		}
+	}
+}
+
+func (kb *KnowledgeBase) addRelationEdge(from *ContextThing, kind string, to *ContextThing) {
+
+	if kind == "" {
+		kind = "is"
+	}
+	kb.outgoing[from] = append(kb.outgoing[from], relationEdge{kind, to})
+	kb.incoming[to] = append(kb.incoming[to], relationEdge{kind, from})
+}
+
+// The Things reached from the Thing by relations of the kind, following
+// them backwards if not forward.
+func (kb *KnowledgeBase) reach(ct *ContextThing, kind string, closure string, forward bool) []*ContextThing {
+
+	kb.relationGraph()
+	edges := kb.outgoing
+	if !forward {
+		edges = kb.incoming
+	}
+	var r []*ContextThing
+	seen := make(map[*ContextThing]bool)
+	if closure == "*" {
+		seen[ct] = true
+		r = append(r, ct)
+	}
+	queue := []*ContextThing{ct}
+	for len(queue) > 0 {
+		for _, e := range edges[queue[0]] {
+			if (kind == "_" || e.kind == kind) && !seen[e.to] {
+				seen[e.to] = true
+				r = append(r, e.to)
+				if closure != "" {
+					queue = append(queue, e.to)
+				}
+			}
+		}
+		queue = queue[1:]
+	}
+	return r
+}
+
+type queryBinding map[string]*ContextThing
+
+// Bind the term to the Thing, false if it is bound to another one.
+func (b queryBinding) unify(t queryTerm, ct *ContextThing, refs map[string]*ContextThing) (queryBinding, bool) {
+
+	if t.variable == "" {
+		return b, refs[t.ref] == ct
+	}
+	if o, ok := b[t.variable]; ok {
+		return b, o == ct
+	}
+	n := make(queryBinding, len(b)+1)
+	for k, v := range b {
+		n[k] = v
+	}
+	n[t.variable] = ct
+	return n, true
+}
+
+// The Thing the term stands for, nil if it is an unbound variable.
+func (b queryBinding) value(t queryTerm, refs map[string]*ContextThing) *ContextThing {
+
+	if t.variable == "" {
+		return refs[t.ref]
+	}
+	return b[t.variable]
+}
+
+func (c queryClause) matchesThing(ct *ContextThing) bool {
+
+	g, err := ToGeneric(ct.Thing)
+	if err != nil {
+		return false
+	}
+	v, err := QueryPath(g, c.path)
+	if err != nil {
+		return false
+	}
+	// a list matches if one of its elements does
+	values := []interface{}{v}
+	if l, ok := v.([]interface{}); ok && c.filter.op != "" {
+		values = l
+	}
+	for _, v := range values {
+		if c.filter.op == "~" {
+			s, ok := v.(string)
+			n, nok := c.filter.value.(string)
+			if !ok || !nok {
+				s, n = fmt.Sprint(v), fmt.Sprint(c.filter.value)
+			}
+			if strings.Contains(strings.ToLower(s), strings.ToLower(n)) {
+				return true
+			}
+		} else if c.filter.matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// All the bindings extending the one the clause matches.
+func (kb *KnowledgeBase) evaluate(c queryClause, b queryBinding, refs map[string]*ContextThing) []queryBinding {
+
+	var r []queryBinding
+	if c.path != "" {
+		candidates := kb.SortedThings()
+		if ct := b.value(c.subject, refs); ct != nil {
+			candidates = []*ContextThing{ct}
+		}
+		for _, ct := range candidates {
+			if c.matchesThing(ct) {
+				n, _ := b.unify(c.subject, ct, refs)
+				r = append(r, n)
+			}
+		}
+		return r
+	}
+	s := b.value(c.subject, refs)
+	o := b.value(c.object, refs)
+	if s == nil && o != nil {
+		for _, ct := range kb.reach(o, c.kind, c.closure, false) {
+			if n, ok := b.unify(c.subject, ct, refs); ok {
+				r = append(r, n)
+			}
+		}
+		return r
+	}
+	subjects := kb.SortedThings()
+	if s != nil {
+		subjects = []*ContextThing{s}
+	}
+	for _, from := range subjects {
+		n, _ := b.unify(c.subject, from, refs)
+		for _, to := range kb.reach(from, c.kind, c.closure, true) {
+			if m, ok := n.unify(c.object, to, refs); ok {
+				r = append(r, m)
+			}
+		}
+	}
+	return r
+}
+
+/*
+	RunQuery
+	  args
+		q				the query, see ParseQuery
+	  returns
+		[][]*ContextThing	a row per distinct match, the Things in the
+							order of the variables, ordered by their
+							locations
+		error			if a Thing referred to can not be found
+*/
+func (kb *KnowledgeBase) RunQuery(q *Query) ([][]*ContextThing, error) {
+
+	refs := make(map[string]*ContextThing)
+	for _, c := range q.clauses {
+		for _, t := range []queryTerm{c.subject, c.object} {
+			if t.variable != "" || t.ref == "" {
+				continue
+			}
+			ct, err := kb.Resolve(t.ref)
+			if err != nil {
+				return nil, err
+			}
+			refs[t.ref] = ct
+		}
+	}
+	bindings := []queryBinding{{}}
+	for _, c := range q.clauses {
+		var next []queryBinding
+		for _, b := range bindings {
+			matches := kb.evaluate(c, b, refs)
+			if c.negated {
+				if len(matches) == 0 {
+					next = append(next, b)
+				}
+			} else {
+				next = append(next, matches...)
+			}
+		}
+		bindings = next
+	}
+	var rows [][]*ContextThing
+	seen := make(map[string]bool)
+	for _, b := range bindings {
+		var row []*ContextThing
+		var key []string
+		for _, v := range q.Vars {
+			row = append(row, b[v])
+			if b[v] != nil {
+				key = append(key, b[v].Location())
+			} else {
+				key = append(key, "")
+			}
+		}
+		k := strings.Join(key, "\n")
+		if !seen[k] {
+			seen[k] = true
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k := range rows[i] {
+			a, b := "", ""
+			if rows[i][k] != nil {
+				a = rows[i][k].Location()
+			}
+			if rows[j][k] != nil {
+				b = rows[j][k].Location()
+			}
+			if a != b {
+				return a < b
+			}
+		}
+		return false
+	})
+	return rows, nil
+}
@@ -0,0 +1,128 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func queryTestContext(t *testing.T) string {
+	return testContext(t, "query")
+}
+
+// The rows as lines of locations separated by spaces.
+func queryRows(t *testing.T, kb *KnowledgeBase, expr string) string {
+
+	q, e := ParseQuery(expr)
+	if e != nil {
+		t.Fatal(e)
+	}
+	rows, e := kb.RunQuery(q)
+	if e != nil {
+		t.Fatal(e)
+	}
+	var r []string
+	for _, row := range rows {
+		var l []string
+		for _, ct := range row {
+			l = append(l, ct.Location())
+		}
+		r = append(r, strings.Join(l, " "))
+	}
+	return strings.Join(r, "\n")
+}
+
+func TestRunQuery(t *testing.T) {
+
+	d := queryTestContext(t)
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for a, b := range map[string]string{
+		"?x is server":          "web.yml",
+		"?x is+ server":         "nginx.yml\nweb.yml",
+		"?x is* server":         "nginx.yml\nserver.yml\nweb.yml",
+		"web.yml _ ?y":          "libssl.yml\nserver.yml",
+		"?x depends_on+ libssl": "cron.yml\nlibgpl.yml\nnginx.yml\nweb.yml",
+		"?x is+ server, ?x depends_on ?y, ?y.legal.license[*].name ~ gpl":        "nginx.yml libgpl.yml",
+		"find ?x where ?x is+ server and ?x depends_on+ ?y and ?y.legal.license": "nginx.yml\nweb.yml",
+		"?x is+ server, not ?x depends_on libssl, ?x.parameter.port >= 80":       "nginx.yml",
+		"?x.parameter.port > 80":                                                   "nginx.yml",
+		"?x.parameter.tags == 'http'":                                              "web.yml",
+		"?x.id.name != web, ?x is+ 'urn:uuid:1111'":                                "nginx.yml",
+		"find ?y where ?x is+ server, ?x depends_on+ ?y, not ?y depends_on libssl": "libssl.yml",
+		"?x depends_on ?y, ?y depends_on ?z":                                       "cron.yml libgpl.yml libssl.yml\nnginx.yml libgpl.yml libssl.yml",
+	} {
+		if c := queryRows(t, kb, a); c != b {
+			t.Fatalf("Expected for '%s' ...\n%s\n... but got ...\n%s", a, b, c)
+		}
+	}
+	t.Log("Now failing successfully (unknown Thing):")
+	q, _ := ParseQuery("?x is nothing")
+	if _, e := kb.RunQuery(q); e == nil {
+		t.Fatal("Expected an error for an unknown Thing")
+	}
+}
+
+func TestRunQueryIndexed(t *testing.T) {
+
+	d := queryTestContext(t)
+	if _, e := RebuildIndex("file://" + d); e != nil {
+		t.Fatal(e)
+	}
+	kb, e := LoadKnowledgeBase("file://" + d)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if kb.outgoing == nil {
+		t.Fatal("Expected the relations to be taken from the index")
+	}
+	if c := queryRows(t, kb, "?x is+ server"); c != "nginx.yml\nweb.yml" {
+		t.Fatalf("Unexpected rows ...\n%s", c)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+
+	a, e := ParseQuery("?x is+ server, ?x.parameter.network.interfaces[?(@.name == 'eth0')].ip ~ '10.0', not ?x uses server")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(a.Vars) != 1 || a.Vars[0] != "x" || len(a.clauses) != 3 {
+		t.Fatalf("Unexpected query %#v", a)
+	}
+	if a.clauses[1].path != ".parameter.network.interfaces[?(@.name == 'eth0')].ip" || a.clauses[1].filter.value != "10.0" {
+		t.Fatalf("Unexpected predicate %#v", a.clauses[1])
+	}
+	t.Log("Now failing successfully (malformed queries):")
+	for _, b := range []string{
+		"",
+		"?x is",
+		"?x is server,",
+		"?x.parameter.port >",
+		"?x.parameter.port => 80",
+		"find ?x ?x is server",
+		"find ?y where ?x is server",
+		"?x is 'server",
+		"?x.parameter[0 == 1",
+		"?x is server, not ?x uses ?z",
+		"not ?x is server, ?x.parameter.port > 80",
+		"find ?x where not ?x is server, ?x depends_on libssl",
+	} {
+		if _, e := ParseQuery(b); e == nil {
+			t.Fatalf("Expected an error for '%s'", b)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	xsdNamespace = "http://www.w3.org/2001/XMLSchema#"
+	xsdInteger   = xsdNamespace + "integer"
+	xsdDouble    = xsdNamespace + "double"
+	xsdBoolean   = xsdNamespace + "boolean"
+	xsdString    = xsdNamespace + "string"
+)
+
+// An RDFMapping tells how Things become resources. The predicates may be
+// given as full IRIs or with one of the prefixes, e.g. 'dcterms:title'.
+type RDFMapping struct {
+	// the prefixes, used to write compact IRIs too
+	Prefixes map[string]string `json:"prefixes"`
+	// the predicates for: title, version, url, location, author,
+	// reference and license
+	Terms map[string]string `json:"terms"`
+	// the relations become predicates named by their kind in this
+	// namespace, unless mapped by kind
+	RelationBase string            `json:"relation_base"`
+	Relations    map[string]string `json:"relations"`
+	// the parameters become predicates named by their path in this
+	// namespace, unless mapped by path, e.g. 'network.ip'
+	ParameterBase string            `json:"parameter_base"`
+	Parameters    map[string]string `json:"parameters"`
+}
+
+// DefaultRDFMapping maps the id and the legal information to Dublin Core
+// terms and the rest to the 'urn:natem:' namespaces.
+func DefaultRDFMapping() *RDFMapping {
+
+	return &RDFMapping{
+		Prefixes: map[string]string{
+			"dcterms": "http://purl.org/dc/terms/",
+			"natem":   "urn:natem:",
+			"param":   "urn:natem:parameter:",
+			"rel":     "urn:natem:relation:",
+			"xsd":     xsdNamespace,
+		},
+		Terms: map[string]string{
+			"title":     "dcterms:title",
+			"version":   "dcterms:hasVersion",
+			"url":       "dcterms:source",
+			"location":  "natem:location",
+			"author":    "dcterms:creator",
+			"reference": "dcterms:references",
+			"license":   "dcterms:license",
+		},
+		RelationBase:  "rel:",
+		Relations:     map[string]string{},
+		ParameterBase: "param:",
+		Parameters:    map[string]string{},
+	}
+}
+
+// ReadRDFMapping reads a mapping from a YAML or JSON file, everything not
+// set there is taken from DefaultRDFMapping.
+func ReadRDFMapping(path string) (*RDFMapping, error) {
+
+	m := DefaultRDFMapping()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var o RDFMapping
+	if err = Unmarshal(content, &o); err != nil {
+		return nil, err
+	}
+	for k, v := range o.Prefixes {
+		m.Prefixes[k] = v
+	}
+	for k, v := range o.Terms {
+		m.Terms[k] = v
+	}
+	for k, v := range o.Relations {
+		m.Relations[k] = v
+	}
+	for k, v := range o.Parameters {
+		m.Parameters[k] = v
+	}
+	if o.RelationBase != "" {
+		m.RelationBase = o.RelationBase
+	}
+	if o.ParameterBase != "" {
+		m.ParameterBase = o.ParameterBase
+	}
+	return m, nil
+}
+
+// Expand turns a compact IRI into a full one, other IRIs are returned as
+// they are.
+func (m *RDFMapping) Expand(iri string) string {
+
+	if i := strings.Index(iri, ":"); i > 0 {
+		if ns, ok := m.Prefixes[iri[:i]]; ok {
+			return ns + iri[i+1:]
+		}
+	}
+	return iri
+}
+
+var rdfLocalName = regexp.MustCompile(`^[A-Za-z_]([A-Za-z0-9_.-]*[A-Za-z0-9_-])?$`)
+
+// Compact turns an IRI into 'prefix:name' if a prefix matches, the longest
+// namespace wins, or returns false.
+func (m *RDFMapping) Compact(iri string) (string, bool) {
+
+	best := ""
+	for _, p := range SortedStrings(m.Prefixes) {
+		ns := m.Prefixes[p]
+		if strings.HasPrefix(iri, ns) && rdfLocalName.MatchString(iri[len(ns):]) {
+			if best == "" || len(ns) > len(m.Prefixes[best]) {
+				best = p
+			}
+		}
+	}
+	if best == "" {
+		return iri, false
+	}
+	return best + ":" + iri[len(m.Prefixes[best]):], true
+}
+
+// An RDFTerm is either an IRI or a literal with its datatype.
+type RDFTerm struct {
+	IRI      string
+	Value    string
+	Datatype string
+}
+
+// A Triple is a statement about a Thing, the IRIs are full ones.
+type Triple struct {
+	Subject   string
+	Predicate string
+	Object    RDFTerm
+}
+
+func rdfLiteral(v interface{}) (RDFTerm, bool) {
+
+	switch x := v.(type) {
+	case string:
+		return RDFTerm{Value: x, Datatype: xsdString}, true
+	case bool:
+		return RDFTerm{Value: strconv.FormatBool(x), Datatype: xsdBoolean}, true
+	case float64:
+		if x == math.Trunc(x) && math.Abs(x) < 1e15 {
+			return RDFTerm{Value: strconv.FormatFloat(x, 'f', -1, 64), Datatype: xsdInteger}, true
+		}
+		return RDFTerm{Value: strconv.FormatFloat(x, 'E', -1, 64), Datatype: xsdDouble}, true
+	}
+	return RDFTerm{}, false
+}
+
+// The predicate of a parameter, by its path, lists repeat the predicate.
+func (m *RDFMapping) parameterTriples(subject string, p string, v interface{}, r []Triple) []Triple {
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for _, k := range SortedKeys(x) {
+			r = m.parameterTriples(subject, joinParameterPath(p, k), x[k], r)
+		}
+	case []interface{}:
+		for _, e := range x {
+			r = m.parameterTriples(subject, p, e, r)
+		}
+	default:
+		o, ok := rdfLiteral(x)
+		if !ok {
+			return r
+		}
+		predicate, ok := m.Parameters[p]
+		if !ok {
+			predicate = m.ParameterBase + iriEscape(p)
+		}
+		r = append(r, Triple{subject, m.Expand(predicate), o})
+	}
+	return r
+}
+
+func joinParameterPath(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// The IRI of the Thing, the URN of its UUID, or else of a UUID named by its
+// location, which stays the same as long as the Thing is not moved.
+func thingIRI(ct *ContextThing) string {
+
+	if ct.Id.Uuid == "" {
+		return "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, []byte(ct.Location())).String()
+	}
+	return "urn:uuid:" + iriEscape(strings.TrimPrefix(ct.Id.Uuid, "urn:uuid:"))
+}
+
+// The characters beyond ASCII an IRI may hold anywhere, 'ucschar' of
+// RFC 3987.
+func isUcschar(r rune) bool {
+
+	switch {
+	case r >= 0xa0 && r <= 0xd7ff, r >= 0xf900 && r <= 0xfdcf, r >= 0xfdf0 && r <= 0xffef:
+		return true
+	case r >= 0x10000 && r <= 0xdfffd, r >= 0xe1000 && r <= 0xefffd:
+		return r&0xffff <= 0xfffd
+	}
+	return false
+}
+
+// The characters beyond ASCII an IRI may only hold in the query,
+// 'iprivate' of RFC 3987.
+func isIprivate(r rune) bool {
+	return r >= 0xe000 && r <= 0xf8ff || r >= 0xf0000 && r <= 0xffffd || r >= 0x100000 && r <= 0x10fffd
+}
+
+func isIRIByte(c byte, chars string) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(chars, c) >= 0
+}
+
+// iriEscape percent-encodes everything that can not be part of a segment of
+// an IRI, e.g. the kind of a relation or the path of a parameter, including
+// '/', '?', '#' and '%'.
+func iriEscape(s string) string {
+
+	var b strings.Builder
+	for i, r := range s {
+		_, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r < utf8.RuneSelf && isIRIByte(byte(r), "-._~!$&'()*+,;=:@"):
+			b.WriteRune(r)
+		case n > 1 && isUcschar(r):
+			b.WriteRune(r)
+		default:
+			for _, c := range []byte(s[i : i+n]) {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+	}
+	return b.String()
+}
+
+func isHexByte(c byte) bool {
+	return strings.IndexByte("0123456789abcdefABCDEF", c) >= 0
+}
+
+var iriScheme = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+
+// validIRI tells whether the string is an absolute IRI by RFC 3987 that can
+// be written as it is.
+func validIRI(s string) bool {
+
+	if !iriScheme.MatchString(s) || !utf8.ValidString(s) {
+		return false
+	}
+	query := false
+	for i, r := range s {
+		switch {
+		case r == '%':
+			if i+2 >= len(s) || !isHexByte(s[i+1]) || !isHexByte(s[i+2]) {
+				return false
+			}
+		case r < utf8.RuneSelf:
+			if !isIRIByte(byte(r), "-._~!$&'()*+,;=:@/?#[]") {
+				return false
+			}
+			if r == '?' {
+				query = true
+			} else if r == '#' {
+				query = false
+			}
+		case isUcschar(r), query && isIprivate(r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+/*
+	Triples
+	  args
+		kb			the knowledge base, to resolve the relations
+		things		the Things to describe
+	  returns
+		[]Triple	by Thing, each ordered by predicate and object, the
+					relations that can not be resolved inside the
+					knowledge base and the URLs are only kept if they are
+					absolute IRIs
+*/
+func (m *RDFMapping) Triples(kb *KnowledgeBase, things []*ContextThing) []Triple {
+
+	var r []Triple
+	for _, ct := range things {
+		s := thingIRI(ct)
+		var ts []Triple
+		term := func(name string, o RDFTerm) {
+			if p := m.Terms[name]; p != "" {
+				ts = append(ts, Triple{s, m.Expand(p), o})
+			}
+		}
+		term("location", RDFTerm{Value: ct.Location(), Datatype: xsdString})
+		if ct.Id.Name != "" {
+			term("title", RDFTerm{Value: ct.Id.Name, Datatype: xsdString})
+		}
+		if ct.Id.Version != "" {
+			term("version", RDFTerm{Value: ct.Id.Version, Datatype: xsdString})
+		}
+		for _, u := range ct.Id.Url {
+			if validIRI(u) {
+				term("url", RDFTerm{IRI: u})
+			}
+		}
+		for _, l := range ct.Relation {
+			kind := l.Kind
+			if kind == "" {
+				kind = "is"
+			}
+			predicate, ok := m.Relations[kind]
+			if !ok {
+				predicate = m.RelationBase + iriEscape(kind)
+			}
+			if o, err := kb.ResolveRelation(l.ThingUrl); err == nil {
+				ts = append(ts, Triple{s, m.Expand(predicate), RDFTerm{IRI: thingIRI(o)}})
+			} else if validIRI(l.ThingUrl) && !strings.HasPrefix(strings.ToLower(l.ThingUrl), "file:") {
+				ts = append(ts, Triple{s, m.Expand(predicate), RDFTerm{IRI: l.ThingUrl}})
+			}
+		}
+		for _, l := range []struct {
+			name    string
+			entries []NameUrlVersionDateGeo
+		}{{"author", ct.Legal.Author}, {"reference", ct.Legal.Reference}, {"license", ct.Legal.License}} {
+			for _, e := range l.entries {
+				if e.NameUrlVersion == nil || e.NameUrl == nil {
+					continue
+				}
+				if validIRI(e.Url) {
+					term(l.name, RDFTerm{IRI: e.Url})
+				} else if e.Name != "" {
+					term(l.name, RDFTerm{Value: e.Name, Datatype: xsdString})
+				}
+			}
+		}
+		if g, err := ToGeneric(ct.Parameter); err == nil {
+			ts = m.parameterTriples(s, "", g, ts)
+		}
+		sort.SliceStable(ts, func(i, j int) bool {
+			if ts[i].Predicate != ts[j].Predicate {
+				return ts[i].Predicate < ts[j].Predicate
+			}
+			return ts[i].Object.IRI+ts[i].Object.Value < ts[j].Object.IRI+ts[j].Object.Value
+		})
+		r = append(r, ts...)
+	}
+	return r
+}
+
+var rdfEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+
+func (o RDFTerm) nTriples() string {
+
+	if o.IRI != "" {
+		return "<" + o.IRI + ">"
+	}
+	l := "\"" + rdfEscaper.Replace(o.Value) + "\""
+	if o.Datatype != xsdString {
+		l += "^^<" + o.Datatype + ">"
+	}
+	return l
+}
+
+// WriteNTriples writes a triple per line.
+func WriteNTriples(w io.Writer, triples []Triple) error {
+
+	for _, t := range triples {
+		if _, err := fmt.Fprintf(w, "<%s> <%s> %s .\n", t.Subject, t.Predicate, t.Object.nTriples()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *RDFMapping) turtleIRI(iri string) string {
+
+	if c, ok := m.Compact(iri); ok {
+		return c
+	}
+	return "<" + iri + ">"
+}
+
+func (m *RDFMapping) turtleTerm(o RDFTerm) string {
+
+	if o.IRI != "" {
+		return m.turtleIRI(o.IRI)
+	}
+	switch o.Datatype {
+	case xsdString:
+		return "\"" + rdfEscaper.Replace(o.Value) + "\""
+	case xsdInteger, xsdBoolean:
+		return o.Value
+	}
+	return "\"" + rdfEscaper.Replace(o.Value) + "\"^^" + m.turtleIRI(o.Datatype)
+}
+
+// WriteTurtle writes the prefixes and a block per subject.
+func (m *RDFMapping) WriteTurtle(w io.Writer, triples []Triple) error {
+
+	var b strings.Builder
+	for _, p := range SortedStrings(m.Prefixes) {
+		fmt.Fprintf(&b, "@prefix %s: <%s> .\n", p, m.Prefixes[p])
+	}
+	for i, t := range triples {
+		switch {
+		case i == 0 || triples[i-1].Subject != t.Subject:
+			fmt.Fprintf(&b, "\n%s\n    %s %s", m.turtleIRI(t.Subject), m.turtleIRI(t.Predicate), m.turtleTerm(t.Object))
+		case triples[i-1].Predicate != t.Predicate:
+			fmt.Fprintf(&b, " ;\n    %s %s", m.turtleIRI(t.Predicate), m.turtleTerm(t.Object))
+		default:
+			fmt.Fprintf(&b, ",\n        %s", m.turtleTerm(t.Object))
+		}
+		if i == len(triples)-1 || triples[i+1].Subject != t.Subject {
+			b.WriteString(" .\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (m *RDFMapping) jsonLDKey(iri string) string {
+
+	c, _ := m.Compact(iri)
+	return c
+}
+
+func (m *RDFMapping) jsonLDValue(o RDFTerm) interface{} {
+
+	if o.IRI != "" {
+		return map[string]interface{}{"@id": o.IRI}
+	}
+	switch o.Datatype {
+	case xsdString:
+		return o.Value
+	case xsdBoolean:
+		return o.Value == "true"
+	case xsdInteger:
+		if i, err := strconv.ParseInt(o.Value, 10, 64); err == nil {
+			return i
+		}
+	}
+	return map[string]interface{}{"@value": o.Value, "@type": m.jsonLDKey(o.Datatype)}
+}
+
+// WriteJSONLD writes a document with the prefixes as context and a node
+// per subject in the graph.
+func (m *RDFMapping) WriteJSONLD(w io.Writer, triples []Triple) error {
+
+	ctx := make(map[string]interface{})
+	for p, ns := range m.Prefixes {
+		ctx[p] = ns
+	}
+	graph := []interface{}{}
+	var node map[string]interface{}
+	for i, t := range triples {
+		if i == 0 || triples[i-1].Subject != t.Subject {
+			node = map[string]interface{}{"@id": t.Subject}
+			graph = append(graph, node)
+		}
+		k := m.jsonLDKey(t.Predicate)
+		v := m.jsonLDValue(t.Object)
+		switch e := node[k].(type) {
+		case nil:
+			node[k] = v
+		case []interface{}:
+			node[k] = append(e, v)
+		default:
+			node[k] = []interface{}{e, v}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{"@context": ctx, "@graph": graph})
+}
+
+// WriteRDF writes the Things in one of the formats: turtle, ntriples or
+// jsonld.
+func (m *RDFMapping) WriteRDF(w io.Writer, kb *KnowledgeBase, things []*ContextThing, format string) error {
+
+	triples := m.Triples(kb, things)
+	switch format {
+	case "turtle":
+		return m.WriteTurtle(w, triples)
+	case "ntriples":
+		return WriteNTriples(w, triples)
+	case "jsonld":
+		return m.WriteJSONLD(w, triples)
+	}
+	return fmt.Errorf("Unknown format '%s', use one of: turtle, ntriples, jsonld.\n", format)
+}
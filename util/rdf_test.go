@@ -0,0 +1,84 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func rdfTestContext(t *testing.T) *KnowledgeBase {
+
+	kb, err := LoadKnowledgeBase("file://" + testContext(t, "rdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kb
+}
+
+func TestWriteRDF(t *testing.T) {
+
+	kb := rdfTestContext(t)
+	m := DefaultRDFMapping()
+	for format, golden := range map[string]string{"turtle": "rdf.ttl", "ntriples": "rdf.nt", "jsonld": "rdf.jsonld"} {
+		a := bytes.NewBufferString("")
+		if e := m.WriteRDF(a, kb, kb.SortedThings(), format); e != nil {
+			t.Fatal(e)
+		}
+		b, e := os.ReadFile(filepath.Join("testing/golden", golden))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if a.String() != string(b) {
+			t.Fatalf("The %s output differs from the golden file, got:\n%s", format, a.String())
+		}
+	}
+	t.Log("Now failing successfully (unknown format):")
+	if e := m.WriteRDF(bytes.NewBufferString(""), kb, kb.SortedThings(), "rdfxml"); e == nil {
+		t.Fatal("Expected an error for an unknown format")
+	}
+}
+
+func TestReadRDFMapping(t *testing.T) {
+
+	kb := rdfTestContext(t)
+	f := filepath.Join(t.TempDir(), "mapping.yml")
+	os.WriteFile(f, []byte("prefixes:\n  schema: https://schema.org/\nterms:\n  author: schema:author\n  location: \"\"\nrelations:\n  is: http://www.w3.org/1999/02/22-rdf-syntax-ns#type\nparameters:\n  network.ip: schema:ipAddress\n"), 0644)
+	m, e := ReadRDFMapping(f)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ct, _ := kb.Resolve("web")
+	a := bytes.NewBufferString("")
+	m.WriteRDF(a, kb, []*ContextThing{ct}, "ntriples")
+	for _, b := range []string{
+		"<urn:uuid:2222> <https://schema.org/author> \"Ada\" .\n",
+		"<urn:uuid:2222> <http://www.w3.org/1999/02/22-rdf-syntax-ns#type> <urn:uuid:1111> .\n",
+		"<urn:uuid:2222> <https://schema.org/ipAddress> \"10.0.0.1\" .\n",
+		"<urn:uuid:2222> <http://purl.org/dc/terms/title> \"web\" .\n",
+	} {
+		if !strings.Contains(a.String(), b) {
+			t.Fatalf("Expected ...\n%s... in ...\n%s", b, a.String())
+		}
+	}
+	if strings.Contains(a.String(), "urn:natem:location") {
+		t.Fatalf("The location should not be mapped, but got ...\n%s", a.String())
+	}
+	t.Log("Now failing successfully (missing mapping file):")
+	if _, e := ReadRDFMapping(filepath.Join(t.TempDir(), "none.yml")); e == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,304 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// A ThingDocument remembers the YAML node tree a Thing was read from, so
+// programmatic changes can be written back without destroying the comments,
+// the key order or the string styles of the hand-written original.
+type ThingDocument struct {
+	Thing  Thing
+	root   *yamlv3.Node
+	indent int
+}
+
+func ParseThingDocument(yamlContent []byte) (*ThingDocument, error) {
+
+	var root yamlv3.Node
+	err := yamlv3.Unmarshal(yamlContent, &root)
+	if err != nil {
+		return nil, err
+	}
+	if root.Kind != yamlv3.DocumentNode || len(root.Content) < 1 {
+		return nil, errors.New("Unable to parse sensible data from document.")
+	}
+	t, err := ParseThing(yamlContent)
+	if err != nil {
+		return nil, err
+	}
+	return &ThingDocument{t, &root, detectIndent(yamlContent)}, nil
+}
+
+func ReadThingDocumentFromFile(fileName string) (*ThingDocument, error) {
+
+	yamlContent, err := ReadYAMLDocumentFromFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseThingDocument(yamlContent)
+}
+
+// Update merges the values of the Thing into the remembered node tree.
+// Nodes that did not change are left alone, new keys are appended and
+// keys that vanished from the Thing are removed. Keys a Thing does not
+// know are kept as they are.
+func (doc *ThingDocument) Update(thing *Thing) error {
+
+	// Make sure every Thing always has its UUID set
+	if thing.Id.Uuid == "" {
+		thing.GenId()
+	}
+	return doc.update(thing)
+}
+
+// Update without making up a UUID, e.g. for merging.
+func (doc *ThingDocument) update(thing *Thing) error {
+
+	thingBytes, err := Marshal(thing)
+	if err != nil {
+		return err
+	}
+	var n yamlv3.Node
+	err = yamlv3.Unmarshal(thingBytes, &n)
+	if err != nil {
+		return err
+	}
+	doc.root.Content[0] = mergeNode(doc.root.Content[0], n.Content[0], reflect.TypeOf(*thing))
+	doc.Thing = *thing
+	return nil
+}
+
+// Bytes returns the document, starting with the '---' separator just like
+// SerializeThingToFile always did.
+func (doc *ThingDocument) Bytes() ([]byte, error) {
+
+	b, err := doc.encode()
+	if err != nil {
+		return nil, err
+	}
+	return JoinYAMLDocuments([][]byte{b}), nil
+}
+
+func (doc *ThingDocument) encode() ([]byte, error) {
+
+	var b bytes.Buffer
+	enc := yamlv3.NewEncoder(&b)
+	enc.SetIndent(doc.indent)
+	err := enc.Encode(doc.root)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.Close()
+	return b.Bytes(), err
+}
+
+// Guess the indentation from the first indented line following a key.
+func detectIndent(yamlContent []byte) int {
+
+	for _, l := range strings.Split(string(yamlContent), "\n") {
+		s := strings.TrimLeft(l, " ")
+		if len(s) < len(l) && s != "" && !strings.HasPrefix(s, "#") {
+			if i := len(l) - len(s); i > 1 && i < 9 {
+				return i
+			}
+			return 2
+		}
+	}
+	return 2
+}
+
+func nodeValue(n *yamlv3.Node) interface{} {
+
+	var v interface{}
+	if n.Decode(&v) != nil {
+		return nil
+	}
+	return v
+}
+
+// Nodes that the Thing would produce but that carry no information, like
+// the 'null' of an unset list, should not be added to a document.
+func isEmptyNode(n *yamlv3.Node) bool {
+
+	switch n.Kind {
+	case yamlv3.ScalarNode:
+		return n.Tag == "!!null" || (n.Tag == "!!str" && n.Value == "")
+	case yamlv3.SequenceNode:
+		return len(n.Content) == 0
+	case yamlv3.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if !isEmptyNode(n.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Drop the empty keys from a node that is about to be added to a document.
+func pruneEmptyNodes(n *yamlv3.Node) *yamlv3.Node {
+
+	switch n.Kind {
+	case yamlv3.SequenceNode:
+		for i := range n.Content {
+			n.Content[i] = pruneEmptyNodes(n.Content[i])
+		}
+	case yamlv3.MappingNode:
+		var c []*yamlv3.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if !isEmptyNode(n.Content[i+1]) {
+				c = append(c, n.Content[i], pruneEmptyNodes(n.Content[i+1]))
+			}
+		}
+		n.Content = c
+	}
+	return n
+}
+
+// The fields a struct is written with, by their JSON names, including the
+// ones of embedded structs.
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) map[string]reflect.Type {
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			jsonFields(ft, fields)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// The type of the value at the key, and whether the key is known at all.
+// Every key of a map is known, so only unknown keys of structs are not.
+func fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+
+	if t == nil {
+		return nil, true
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		ft, ok := jsonFields(t, make(map[string]reflect.Type))[key]
+		return ft, ok
+	case reflect.Map:
+		return t.Elem(), true
+	}
+	return nil, true
+}
+
+func isStruct(t reflect.Type) bool {
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t != nil && t.Kind() == reflect.Struct
+}
+
+func elemType(t reflect.Type) reflect.Type {
+
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return nil
+	}
+	return t.Elem()
+}
+
+// Merge the new node into the old one, t is the type the new node was
+// written from. Keys the type does not know, e.g. hand-written extras, are
+// kept, as the new node can not tell about them.
+func mergeNode(old *yamlv3.Node, new *yamlv3.Node, t reflect.Type) *yamlv3.Node {
+
+	if old.Kind == yamlv3.AliasNode || old.Kind != new.Kind {
+		if reflect.DeepEqual(nodeValue(old), nodeValue(new)) {
+			return old
+		}
+		new.HeadComment = old.HeadComment
+		new.LineComment = old.LineComment
+		new.FootComment = old.FootComment
+		return new
+	}
+	switch old.Kind {
+	case yamlv3.ScalarNode:
+		if !reflect.DeepEqual(nodeValue(old), nodeValue(new)) {
+			// the style is kept, the encoder quotes where needed
+			old.Value = new.Value
+			old.Tag = new.Tag
+		}
+	case yamlv3.SequenceNode:
+		var c []*yamlv3.Node
+		for i := range new.Content {
+			if i < len(old.Content) {
+				c = append(c, mergeNode(old.Content[i], new.Content[i], elemType(t)))
+			} else {
+				c = append(c, pruneEmptyNodes(new.Content[i]))
+			}
+		}
+		old.Content = c
+	case yamlv3.MappingNode:
+		newValues := make(map[string]*yamlv3.Node)
+		var newKeys []*yamlv3.Node
+		for i := 0; i+1 < len(new.Content); i += 2 {
+			newValues[new.Content[i].Value] = new.Content[i+1]
+			newKeys = append(newKeys, new.Content[i])
+		}
+		var c []*yamlv3.Node
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			k := old.Content[i].Value
+			ft, known := fieldType(t, k)
+			if v, ok := newValues[k]; ok && isStruct(t) && isEmptyNode(v) && !isEmptyNode(old.Content[i+1]) {
+				// a field of the Thing that was cleared
+				seen[k] = true
+			} else if ok {
+				c = append(c, old.Content[i], mergeNode(old.Content[i+1], v, ft))
+				seen[k] = true
+			} else if !known {
+				c = append(c, old.Content[i], old.Content[i+1])
+			}
+		}
+		for _, k := range newKeys {
+			v := newValues[k.Value]
+			if !seen[k.Value] && !isEmptyNode(v) {
+				c = append(c, k, pruneEmptyNodes(v))
+			}
+		}
+		old.Content = c
+	}
+	return old
+}
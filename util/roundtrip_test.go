@@ -0,0 +1,126 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"os"
+	"testing"
+)
+
+func TestThingDocumentUnchanged(t *testing.T) {
+
+	a, e := ReadThingDocumentFromFile("testing/roundtrip.yml")
+	if e != nil {
+		t.Fatalf("Error reading the Thing document: %s.\n", e)
+	}
+	thing := a.Thing
+	e = a.Update(&thing)
+	if e != nil {
+		t.Fatalf("Error updating the Thing document: %s.\n", e)
+	}
+	b, e := a.Bytes()
+	if e != nil {
+		t.Fatalf("Error serializing the Thing document: %s.\n", e)
+	}
+	c, e := os.ReadFile("testing/roundtrip.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(b) != string(c) {
+		t.Fatalf("An unchanged Thing should be written back as is, but got:\n%s", string(b))
+	}
+}
+
+func TestThingDocumentUpdate(t *testing.T) {
+
+	a, e := ReadThingDocumentFromFile("testing/roundtrip.yml")
+	if e != nil {
+		t.Fatalf("Error reading the Thing document: %s.\n", e)
+	}
+	thing := a.Thing
+	thing.Id.Version = "0.2"
+	thing.Parameter["alpha"] = "changed"
+	thing.Parameter["port"] = 8080
+	thing.Parameter["zulu"] = 2
+	thing.Relation = append(thing.Relation, ThingRelation{ThingUrl: "other.yml", Kind: "uses"})
+	e = a.Update(&thing)
+	if e != nil {
+		t.Fatalf("Error updating the Thing document: %s.\n", e)
+	}
+	b, e := a.Bytes()
+	if e != nil {
+		t.Fatalf("Error serializing the Thing document: %s.\n", e)
+	}
+	c, e := os.ReadFile("testing/golden/roundtrip.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(b) != string(c) {
+		t.Fatalf("The updated document differs from the golden file, got:\n%s", string(b))
+	}
+}
+
+func TestSerializeThingToFileKeepsComments(t *testing.T) {
+
+	c, e := os.ReadFile("testing/roundtrip.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	f, err := os.CreateTemp("testing", "natem")
+	defer os.Remove(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(c)
+	f.Close()
+	a, _ := ParseThingFromFile(f.Name())
+	err = SerializeThingToFile(&a, f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != string(c) {
+		t.Fatalf("Rewriting the file should not have changed it, got:\n%s", string(b))
+	}
+}
+
+func TestThingDocumentKeepsUnknownKeys(t *testing.T) {
+
+	a, e := ReadThingDocumentFromFile("testing/unknown.yml")
+	if e != nil {
+		t.Fatalf("Error reading the Thing document: %s.\n", e)
+	}
+	thing := a.Thing
+	thing.Id.Version = ""
+	thing.Parameter["port"] = 8080
+	delete(thing.Parameter, "obsolete")
+	e = a.Update(&thing)
+	if e != nil {
+		t.Fatalf("Error updating the Thing document: %s.\n", e)
+	}
+	b, e := a.Bytes()
+	if e != nil {
+		t.Fatalf("Error serializing the Thing document: %s.\n", e)
+	}
+	c, e := os.ReadFile("testing/golden/unknown.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(b) != string(c) {
+		t.Fatalf("The updated document differs from the golden file, got:\n%s", string(b))
+	}
+}
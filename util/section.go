@@ -0,0 +1,139 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// The top-level keys of a Thing that can be edited on their own.
+var ThingSections = []string{"parameter", "behavior", "relation", "legal"}
+
+func IsThingSection(section string) bool {
+	for _, s := range ThingSections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the lines [start, end) of a document that contain the top-level key
+// and its value. The comment lines directly preceding the next key belong
+// to that next key.
+func findSectionLines(lines [][]byte, section string) (int, int, bool, error) {
+
+	var root yamlv3.Node
+	err := yamlv3.Unmarshal(bytes.Join(lines, []byte("\n")), &root)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if root.Kind != yamlv3.DocumentNode || len(root.Content) < 1 {
+		return len(lines), len(lines), false, nil
+	}
+	m := root.Content[0]
+	if m.Kind != yamlv3.MappingNode || m.Style&yamlv3.FlowStyle != 0 {
+		return 0, 0, false, errors.New("Only documents in block style can be edited by section.")
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value != section {
+			continue
+		}
+		start := m.Content[i].Line - 1
+		end := len(lines)
+		if i+2 < len(m.Content) {
+			end = m.Content[i+2].Line - 1
+		}
+		for end > start+1 {
+			t := bytes.TrimSpace(lines[end-1])
+			if len(t) > 0 && t[0] != byte('#') {
+				break
+			}
+			end--
+		}
+		return start, end, true, nil
+	}
+	end := len(lines)
+	for end > 0 && len(bytes.TrimSpace(lines[end-1])) == 0 {
+		end--
+	}
+	return end, end, false, nil
+}
+
+// Split the file content into lines and locate the addressed document.
+func locateThingDocument(content []byte, fragment string) ([][]byte, int, int, error) {
+
+	documents, offsets := splitYAMLDocuments(content)
+	i, err := FindThingDocumentIndex(documents, fragment)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	docLines := bytes.Split(documents[i], []byte("\n"))
+	// the document has a trailing empty line for the final newline
+	return lines, offsets[i], offsets[i] + len(docLines) - 1, nil
+}
+
+// GetThingSection returns the top-level key and its value, exactly as they
+// are written in the file content. The section is empty if the key is not
+// set.
+func GetThingSection(content []byte, fragment string, section string) ([]byte, error) {
+
+	lines, first, last, err := locateThingDocument(content, fragment)
+	if err != nil {
+		return nil, err
+	}
+	start, end, found, err := findSectionLines(lines[first:last], section)
+	if err != nil || !found {
+		return []byte(""), err
+	}
+	sectionLines := append(lines[first+start:first+end:first+end], []byte(""))
+	return bytes.Join(sectionLines, []byte("\n")), nil
+}
+
+// ReplaceThingSection puts the section back into the file content, all the
+// other lines stay as they are. The section must contain only its own
+// top-level key, an empty section removes the key.
+func ReplaceThingSection(content []byte, fragment string, section string, sectionContent []byte) ([]byte, error) {
+
+	var s map[string]interface{}
+	err := yamlv3.Unmarshal(sectionContent, &s)
+	if err != nil {
+		return nil, err
+	}
+	for k := range s {
+		if k != section {
+			return nil, fmt.Errorf("The section '%s' must not contain the key '%s'.\n", section, k)
+		}
+	}
+	lines, first, last, err := locateThingDocument(content, fragment)
+	if err != nil {
+		return nil, err
+	}
+	start, end, _, err := findSectionLines(lines[first:last], section)
+	if err != nil {
+		return nil, err
+	}
+	var result [][]byte
+	result = append(result, lines[:first+start]...)
+	sectionContent = bytes.TrimRight(sectionContent, "\n")
+	if len(bytes.TrimSpace(sectionContent)) > 0 {
+		result = append(result, bytes.Split(sectionContent, []byte("\n"))...)
+	}
+	result = append(result, lines[first+end:]...)
+	return bytes.Join(result, []byte("\n")), nil
+}
@@ -0,0 +1,91 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGetThingSection(t *testing.T) {
+
+	c, e := os.ReadFile("testing/roundtrip.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	a, e := GetThingSection(c, "", "relation")
+	if e != nil {
+		t.Fatalf("Error getting the section: %s.\n", e)
+	}
+	b := "relation:\n  - thing_url: \"categories/server.yml\"\n    kind: \"is\"\n"
+	if string(a) != b {
+		t.Fatalf("Got the wrong section:\n%s", string(a))
+	}
+	a, e = GetThingSection(c, "", "legal")
+	if e != nil || len(a) != 0 {
+		t.Fatal("A section that is not set should be empty.")
+	}
+	c, e = os.ReadFile("testing/multi.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	a, e = GetThingSection(c, "second", "id")
+	if e != nil {
+		t.Fatalf("Error getting the section: %s.\n", e)
+	}
+	if !strings.Contains(string(a), "0.2") {
+		t.Fatalf("Got the section from the wrong document:\n%s", string(a))
+	}
+	t.Log("Now failing successfully (no document selected):")
+	_, e = GetThingSection(c, "", "id")
+	if e == nil {
+		t.Fatal("The document must be selected in a file with several documents.")
+	}
+}
+
+func TestReplaceThingSection(t *testing.T) {
+
+	c, e := os.ReadFile("testing/roundtrip.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	a, e := ReplaceThingSection(c, "", "relation", []byte("relation:\n  # new\n  - thing_url: \"x.yml\"\n"))
+	if e != nil {
+		t.Fatalf("Error replacing the section: %s.\n", e)
+	}
+	b := strings.Replace(string(c), "  - thing_url: \"categories/server.yml\"\n    kind: \"is\"\n", "  # new\n  - thing_url: \"x.yml\"\n", 1)
+	if string(a) != b {
+		t.Fatalf("Only the section should have changed, got:\n%s", string(a))
+	}
+	a, e = ReplaceThingSection(c, "", "legal", []byte("legal:\n  author:\n    - name: me\n"))
+	if e != nil {
+		t.Fatalf("Error adding the section: %s.\n", e)
+	}
+	if !strings.HasPrefix(string(a), string(c)) || !strings.HasSuffix(string(a), "    - name: me\n") {
+		t.Fatalf("The new section should have been appended, got:\n%s", string(a))
+	}
+	a, e = ReplaceThingSection(c, "", "parameter", []byte(""))
+	if e != nil {
+		t.Fatalf("Error removing the section: %s.\n", e)
+	}
+	if strings.Contains(string(a), "parameter") || !strings.Contains(string(a), "kind: \"is\"\n") {
+		t.Fatalf("The section should have been removed, got:\n%s", string(a))
+	}
+	t.Log("Now failing successfully (foreign key):")
+	_, e = ReplaceThingSection(c, "", "parameter", []byte("id:\n  name: x\n"))
+	if e == nil {
+		t.Fatal("Only the section itself may be changed.")
+	}
+}
@@ -15,6 +15,7 @@ package util
 import (
 	"errors"
 	"net/url"
+	"path/filepath"
 	"strings"
 )
 
@@ -75,7 +76,7 @@ func ParseThingURL(thingURI string, contextURI string, hasContext bool) (*ThingU
 	}
 	if tu.Path[0] != byte('/') {
 		tu.Path = cu.Path + "/" + tu.Path
-	} else if hasContext && !strings.HasPrefix(tu.Path, cu.Path) {
+	} else if hasContext && tu.Path != cu.Path && !strings.HasPrefix(tu.Path, strings.TrimSuffix(cu.Path, "/")+"/") {
 		return &ThingURL{tu, cu.Path, false}, UrlThingOutsideContextError
 	}
 
@@ -116,3 +117,30 @@ func GetThingURLPath(u string, context string, hasContext bool) (string, error)
 	}
 	return path, err
 }
+
+// Get the local directory of a context, the context must use the 'file'
+// scheme.
+func GetContextPath(context string) (string, error) {
+	cu, err := url.Parse(context)
+	if err != nil {
+		return "", err
+	}
+	if cu.Scheme != "" && cu.Scheme != SupportedThingURLSchemesRW {
+		return cu.Path, errors.New("This context is not local, scheme must be 'file'.\n")
+	}
+	if cu.Path == "" || cu.Path[0] != byte('/') {
+		return cu.Path, errors.New("The context path must be absolute.\n")
+	}
+	return cu.Path, nil
+}
+
+// ContextRelativePath cleans a path relative to the context, e.g. the
+// target of a copy or move, and makes sure it stays inside the context.
+func ContextRelativePath(p string) (string, error) {
+
+	p = filepath.Clean(p)
+	if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return p, UrlThingOutsideContextError
+	}
+	return p, nil
+}
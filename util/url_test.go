@@ -66,6 +66,13 @@ func TestParseThingURL(t *testing.T) {
 	} else {
 		t.Logf("got the expected error: %s.\n", e)
 	}
+	a = "file:///home/foobar/somefile.suffix"
+	d, e = ParseThingURL(a, c, b)
+	if e == nil {
+		t.Fatalf("a sibling directory sharing the prefix should produce an error...")
+	} else {
+		t.Logf("got the expected error: %s.\n", e)
+	}
 	a = "file:///tmp/somefile.suffix"
 	c = "file:///home/foo"
 	d, e = ParseThingURL(a, c, false)
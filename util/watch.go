@@ -0,0 +1,341 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+package util
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// A Diagnostic lists the problems of a Thing, none if it is fine.
+type Diagnostic struct {
+	Location string   `json:"location"`
+	Problems []string `json:"problems"`
+}
+
+// A WatchEvent tells which files changed and how the Things affected,
+// including the ones referring to them, are doing now.
+type WatchEvent struct {
+	Files       []string     `json:"files"`
+	Removed     []string     `json:"removed"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	Errors      []string     `json:"errors"`
+	// the number of events a slow subscriber missed before this one
+	Lost int `json:"lost,omitempty"`
+}
+
+// A Watcher keeps the knowledge base of a context up to date while the
+// files change and passes the results on to all its subscribers.
+type Watcher struct {
+	// the schema for Things that do not name their own
+	Schema string
+	// how long to wait for more changes before checking
+	Delay time.Duration
+
+	kb          *KnowledgeBase
+	notify      *fsnotify.Watcher
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+type subscriber struct {
+	events chan WatchEvent
+	done   chan struct{}
+	wait   bool
+	lost   int
+}
+
+func NewWatcher(context string, schema string) (*Watcher, error) {
+
+	kb, err := LoadKnowledgeBase(context)
+	if err != nil {
+		return nil, err
+	}
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{Schema: schema, Delay: 100 * time.Millisecond, kb: kb, notify: notify, subscribers: make(map[*subscriber]bool)}
+	_, err = w.addDirectory(kb.ContextPath)
+	if err != nil {
+		notify.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Watch the directory and the ones below, and return the Thing files found.
+func (w *Watcher) addDirectory(dir string) ([]string, error) {
+
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != w.kb.ContextPath && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return w.notify.Add(path)
+		}
+		if isThingFile(d.Name()) {
+			rel, err := filepath.Rel(w.kb.ContextPath, path)
+			if err == nil {
+				files = append(files, rel)
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+func (w *Watcher) Close() error {
+	return w.notify.Close()
+}
+
+// Subscribe returns a channel with all the events to come, and a function
+// to stop receiving them. Subscribers that do not keep up miss events, the
+// next event they get tells how many.
+func (w *Watcher) Subscribe() (<-chan WatchEvent, func()) {
+	return w.subscribe(false)
+}
+
+// SubscribeAll is like Subscribe, but no event is ever missed, the watcher
+// waits for the subscriber instead.
+func (w *Watcher) SubscribeAll() (<-chan WatchEvent, func()) {
+	return w.subscribe(true)
+}
+
+func (w *Watcher) subscribe(wait bool) (<-chan WatchEvent, func()) {
+
+	s := &subscriber{events: make(chan WatchEvent, 16), done: make(chan struct{}), wait: wait}
+	w.mutex.Lock()
+	w.subscribers[s] = true
+	w.mutex.Unlock()
+	var once sync.Once
+	return s.events, func() {
+		once.Do(func() {
+			// stop a publish waiting for this subscriber first
+			close(s.done)
+			w.mutex.Lock()
+			delete(w.subscribers, s)
+			close(s.events)
+			w.mutex.Unlock()
+		})
+	}
+}
+
+func (w *Watcher) publish(e WatchEvent) {
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for s := range w.subscribers {
+		ev := e
+		ev.Lost = s.lost
+		if s.wait {
+			select {
+			case s.events <- ev:
+			case <-s.done:
+			}
+			continue
+		}
+		select {
+		case s.events <- ev:
+			s.lost = 0
+		default:
+			s.lost++
+		}
+	}
+}
+
+// Check validates all the Things, e.g. to start with.
+func (w *Watcher) Check() WatchEvent {
+
+	w.mutex.Lock()
+	e := WatchEvent{}
+	for _, err := range w.kb.Errors {
+		e.Errors = append(e.Errors, strings.TrimSpace(err.Error()))
+	}
+	e.Diagnostics = w.diagnose(w.kb.Things)
+	w.mutex.Unlock()
+	w.publish(e)
+	return e
+}
+
+/*
+	Update
+	  args
+		files		the changed files, relative to the context
+	  returns
+		WatchEvent	the diagnostics for the Things in the files and
+					the Things referring to them, before or after the
+					change
+*/
+func (w *Watcher) Update(files []string) WatchEvent {
+
+	w.mutex.Lock()
+	kb := w.kb
+	sort.Strings(files)
+	e := WatchEvent{Files: files}
+	var old, loaded []*ContextThing
+	for _, f := range files {
+		o, l := kb.ReloadFile(f)
+		old = append(old, o...)
+		loaded = append(loaded, l...)
+	}
+	// the referrers to what is gone are found by the old relations
+	before := &KnowledgeBase{ContextPath: kb.ContextPath, Things: append(append([]*ContextThing{}, kb.Things...), old...)}
+	affected := make(map[*ContextThing]bool)
+	for _, ct := range loaded {
+		affected[ct] = true
+		for _, r := range kb.Backlinks(ct) {
+			affected[r] = true
+		}
+	}
+	present := make(map[string]bool)
+	for _, ct := range loaded {
+		present[ct.Location()] = true
+	}
+	for _, ct := range old {
+		if !present[ct.Location()] {
+			e.Removed = append(e.Removed, ct.Location())
+		}
+		for _, r := range before.Backlinks(ct) {
+			if !isIn(r, old) {
+				affected[r] = true
+			}
+		}
+	}
+	var things []*ContextThing
+	for ct := range affected {
+		things = append(things, ct)
+	}
+	e.Diagnostics = w.diagnose(things)
+	for _, err := range kb.Errors {
+		for _, f := range files {
+			if strings.HasPrefix(err.Error(), f+":") || strings.HasPrefix(err.Error(), f+"#") {
+				e.Errors = append(e.Errors, strings.TrimSpace(err.Error()))
+			}
+		}
+	}
+	w.mutex.Unlock()
+	w.publish(e)
+	return e
+}
+
+func isIn(ct *ContextThing, cts []*ContextThing) bool {
+	for _, o := range cts {
+		if o == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate the Things if there is a schema and check their links.
+func (w *Watcher) diagnose(things []*ContextThing) []Diagnostic {
+
+	var r []Diagnostic
+	for _, ct := range (&KnowledgeBase{Things: things}).SortedThings() {
+		d := Diagnostic{Location: ct.Location(), Problems: []string{}}
+		if len(ct.Schema) > 0 || w.Schema != "" {
+			problems, err := w.kb.ValidateContextThing(ct, w.Schema)
+			if err != nil {
+				d.Problems = append(d.Problems, strings.TrimSpace(err.Error()))
+			}
+			d.Problems = append(d.Problems, problems...)
+		}
+		d.Problems = append(d.Problems, w.kb.CheckLinks(ct)...)
+		r = append(r, d)
+	}
+	return r
+}
+
+// Run waits for changes and updates the knowledge base until stopped.
+func (w *Watcher) Run(stop <-chan struct{}) error {
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(w.Delay)
+	timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return nil
+			}
+			w.publish(WatchEvent{Errors: []string{err.Error()}})
+		case ev, ok := <-w.notify.Events:
+			if !ok {
+				return nil
+			}
+			for _, f := range w.changedFiles(ev) {
+				pending[f] = true
+			}
+			timer.Reset(w.Delay)
+		case <-timer.C:
+			if len(pending) == 0 {
+				continue
+			}
+			var files []string
+			for f := range pending {
+				files = append(files, f)
+			}
+			pending = make(map[string]bool)
+			w.Update(files)
+		}
+	}
+}
+
+// The Thing files an event is about: the file itself, everything in a new
+// directory, or everything known below a path that is gone.
+func (w *Watcher) changedFiles(ev fsnotify.Event) []string {
+
+	rel, err := filepath.Rel(w.kb.ContextPath, ev.Name)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+	for _, p := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(p, ".") {
+			return nil
+		}
+	}
+	if ev.Op&fsnotify.Create != 0 {
+		if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+			files, _ := w.addDirectory(ev.Name)
+			return files
+		}
+	}
+	if isThingFile(rel) {
+		return []string{rel}
+	}
+	var files []string
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		w.mutex.Lock()
+		for _, ct := range w.kb.Things {
+			if strings.HasPrefix(ct.Path, rel+string(filepath.Separator)) {
+				files = append(files, ct.Path)
+			}
+		}
+		w.mutex.Unlock()
+	}
+	return files
+}
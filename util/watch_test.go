@@ -0,0 +1,159 @@
+/*
+This is Free Software; feel free to redistribute and/or modify it
+under the terms of the GNU General Public License as published by
+the Free Software Foundation; version 3 of the License.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func watchTestContext(t *testing.T) string {
+	return testContext(t, "watch")
+}
+
+func diagnosticOf(e WatchEvent, location string) *Diagnostic {
+	for i := range e.Diagnostics {
+		if e.Diagnostics[i].Location == location {
+			return &e.Diagnostics[i]
+		}
+	}
+	return nil
+}
+
+func TestWatcherUpdate(t *testing.T) {
+
+	d := watchTestContext(t)
+	w, e := NewWatcher("file://"+d, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer w.Close()
+	a := w.Check()
+	if b := diagnosticOf(a, "web.yml"); b == nil || len(b.Problems) != 0 {
+		t.Fatalf("Expected web.yml to be fine: %v.\n", a)
+	}
+
+	// the referrer is checked again when the Thing it refers to is gone
+	os.Remove(filepath.Join(d, "server.yml"))
+	a = w.Update([]string{"server.yml"})
+	if len(a.Removed) != 1 || a.Removed[0] != "server.yml" {
+		t.Fatalf("Expected server.yml to be gone: %v.\n", a.Removed)
+	}
+	b := diagnosticOf(a, "web.yml")
+	if b == nil || len(b.Problems) != 1 {
+		t.Fatalf("Expected a broken relation for web.yml: %v.\n", a)
+	}
+
+	// and fine again when it comes back
+	os.WriteFile(filepath.Join(d, "server.yml"), []byte("id:\n  name: server\n  uuid: urn:uuid:1111\n"), 0644)
+	a = w.Update([]string{"server.yml"})
+	if b = diagnosticOf(a, "web.yml"); b == nil || len(b.Problems) != 0 {
+		t.Fatalf("Expected web.yml to be fine again: %v.\n", a)
+	}
+
+	t.Log("Now failing successfully (invalid parameter):")
+	os.WriteFile(filepath.Join(d, "web.yml"), []byte("id:\n  name: web\nschema:\n  - url: schema.yml\nparameter:\n  port: eighty\n"), 0644)
+	a = w.Update([]string{"web.yml"})
+	if b = diagnosticOf(a, "web.yml"); b == nil || len(b.Problems) != 1 {
+		t.Fatalf("Expected web.yml to be invalid: %v.\n", a)
+	}
+}
+
+func TestWatcherRun(t *testing.T) {
+
+	d := watchTestContext(t)
+	w, e := NewWatcher("file://"+d, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer w.Close()
+	w.Delay = 10 * time.Millisecond
+	events, unsubscribe := w.Subscribe()
+	defer unsubscribe()
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.Run(stop)
+
+	os.MkdirAll(filepath.Join(d, "sub"), 0755)
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(filepath.Join(d, "sub", "db.yml"), []byte("id:\n  name: db\nrelation:\n  - thing_url: nowhere.yml\n"), 0644)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case a := <-events:
+			if b := diagnosticOf(a, "sub/db.yml"); b != nil && len(b.Problems) == 1 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expected an event for the new file.")
+		}
+	}
+}
+
+func TestWatcherSlowSubscribers(t *testing.T) {
+
+	d := watchTestContext(t)
+	w, e := NewWatcher("file://"+d, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer w.Close()
+	a, unsubscribeA := w.Subscribe()
+	defer unsubscribeA()
+	b, unsubscribeB := w.SubscribeAll()
+	defer unsubscribeB()
+	c := make(chan int)
+	go func() {
+		n := 0
+		for range b {
+			n++
+		}
+		c <- n
+	}()
+	for i := 0; i < 20; i++ {
+		w.Check()
+	}
+	for i := 0; i < 16; i++ {
+		if ev := <-a; ev.Lost != 0 {
+			t.Fatalf("Expected no loss before the buffer was full, got %d.\n", ev.Lost)
+		}
+	}
+	w.Check()
+	if ev := <-a; ev.Lost != 4 {
+		t.Fatalf("Expected the next event to tell about the 4 lost ones, got %d.\n", ev.Lost)
+	}
+	unsubscribeB()
+	if n := <-c; n != 21 {
+		t.Fatalf("Expected all the 21 events for the waiting subscriber, got %d.\n", n)
+	}
+
+	// a waiting subscriber that goes away does not block the watcher
+	_, unsubscribeD := w.SubscribeAll()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			w.Check()
+		}
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	unsubscribeD()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The watcher still waits for a subscriber that is gone.")
+	}
+}
@@ -13,13 +13,14 @@ Copyright © 2021 Michael Lustenberger <mic@inofix.ch>
 package util
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/ghodss/yaml"
 	"github.com/google/uuid"
@@ -50,8 +51,8 @@ type NameUrlVersionDateGeo struct {
 type ThingTarget struct {
 	Url      string `json:"url"`
 	Checksum string `json:"checksum"`
-	Tag      string `json"tag"`
-	Uuid     string `json"uuid"`
+	Tag      string `json:"tag"`
+	Uuid     string `json:"uuid"`
 	*DateGeo
 }
 
@@ -130,74 +131,251 @@ func NewThing() *Thing {
 //}
 
 func ValidateJSONThing(schemaBytes []byte, contentBytes []byte) (bool, error) {
-	schemaLoader := gojsonschema.NewStringLoader(string(schemaBytes))
-	contentLoader := gojsonschema.NewStringLoader(string(contentBytes))
 
-	result, err := gojsonschema.Validate(schemaLoader, contentLoader)
+	problems, err := ValidateJSONThingProblems(schemaBytes, contentBytes)
 	if err != nil {
-		return false, fmt.Errorf("Error validating the document: %s\n", err)
+		return false, err
 	}
-
-	if result.Valid() {
+	if len(problems) == 0 {
 		return true, nil
 	} else {
-		//TODO proper error handling
 		log.Print("Invalid document:\n")
-		for _, e := range result.Errors() {
+		for _, e := range problems {
 			log.Printf("- %s\n", e)
 		}
 		return false, nil
 	}
 }
 
+// ValidateJSONThingProblems returns what is wrong with the document, the
+// list is empty if it is valid.
+func ValidateJSONThingProblems(schemaBytes []byte, contentBytes []byte) ([]string, error) {
+	schemaLoader := gojsonschema.NewStringLoader(string(schemaBytes))
+	contentLoader := gojsonschema.NewStringLoader(string(contentBytes))
+
+	result, err := gojsonschema.Validate(schemaLoader, contentLoader)
+	if err != nil {
+		return nil, fmt.Errorf("Error validating the document: %s\n", err)
+	}
+
+	problems := []string{}
+	for _, e := range result.Errors() {
+		problems = append(problems, e.String())
+	}
+	return problems, nil
+}
+
 // We do only accept JSON compatible YAML anyway. TSENTSAK-YAML is defined to
 // be an object/map and has only strings as keys.
 func ValidateThing(schemaBytes []byte, contentBytes []byte) (bool, error) {
 
+	JSONSchemaBytes, JSONContentBytes, err := thingToJSON(schemaBytes, contentBytes)
+	if err != nil {
+		return false, err
+	}
+	return ValidateJSONThing(JSONSchemaBytes, JSONContentBytes)
+}
+
+// ValidateThingProblems is ValidateThing returning the problems instead of
+// logging them.
+func ValidateThingProblems(schemaBytes []byte, contentBytes []byte) ([]string, error) {
+
+	JSONSchemaBytes, JSONContentBytes, err := thingToJSON(schemaBytes, contentBytes)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateJSONThingProblems(JSONSchemaBytes, JSONContentBytes)
+}
+
+func thingToJSON(schemaBytes []byte, contentBytes []byte) ([]byte, []byte, error) {
+
 	JSONSchemaBytes, err := yaml.YAMLToJSON(schemaBytes)
 	if err != nil {
-		return false, fmt.Errorf("Parsing the YAML schema failed: %s.\n", err)
+		return nil, nil, fmt.Errorf("Parsing the YAML schema failed: %s.\n", err)
 	}
 	JSONContentBytes, err := yaml.YAMLToJSON(contentBytes)
 	if err != nil {
-		return false, fmt.Errorf("Parsing the YAML thing failed: %s.\n", err)
+		return nil, nil, fmt.Errorf("Parsing the YAML thing failed: %s.\n", err)
 	}
+	return JSONSchemaBytes, JSONContentBytes, nil
+}
 
-	return ValidateJSONThing(JSONSchemaBytes, JSONContentBytes)
+// GetThingSchemaPath returns the local path of the first schema the Thing
+// refers to, or an empty string if it does not name any.
+func GetThingSchemaPath(thing *Thing, context string) (string, error) {
+
+	for _, s := range thing.Schema {
+		if s.NameUrl != nil && s.Url != "" {
+			return GetThingURLPath(s.Url, context, false)
+		}
+	}
+	return "", nil
 }
 
-// Currently we only allow nice and small files with max one document inside..
-func ReadYAMLDocumentFromFile(fileName string) ([]byte, error) {
+// A file may contain several documents, separated by '---'. The leading
+// '---' is optional, everything that is neither empty nor a comment before
+// it is considered a document of its own.
+func ReadYAMLDocumentsFromFile(fileName string) ([][]byte, error) {
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return [][]byte{}, err
+	}
+	documents, _ := splitYAMLDocuments(content)
+	if len(documents) < 1 {
+		err = errors.New("Unable to parse sensible data from file.")
+	}
+	return documents, err
+}
 
+// SplitYAMLDocuments does the same as ReadYAMLDocumentsFromFile for content
+// already in memory.
+func SplitYAMLDocuments(content []byte) [][]byte {
+
+	documents, _ := splitYAMLDocuments(content)
+	return documents
+}
+
+// Split the content into its documents and remember the line each of them
+// starts at.
+func splitYAMLDocuments(content []byte) ([][]byte, []int) {
+
+	var documents [][]byte
+	var offsets []int
 	var contentBytes [][]byte
-	startDocument := false
+	hasContent := false
+	start := 0
+
+	endDocument := func() {
+		if hasContent {
+			// keep the final newline, block scalars depend on it
+			contentBytes = append(contentBytes, []byte(""))
+			documents = append(documents, bytes.Join(contentBytes, []byte("\n")))
+			offsets = append(offsets, start)
+		}
+		contentBytes = nil
+		hasContent = false
+	}
 
-	fh, err := os.Open(fileName)
-	if err != nil {
+	lines := bytes.Split(content, []byte("\n"))
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for i, l := range lines {
+		if len(l) > 2 && (bytes.Equal([]byte("---"), l[0:3]) || bytes.Equal([]byte("..."), l[0:3])) {
+			endDocument()
+			start = i + 1
+			continue
+		}
+		t := bytes.TrimSpace(l)
+		if len(t) > 0 && t[0] != byte('#') {
+			hasContent = true
+		}
+		contentBytes = append(contentBytes, l)
+	}
+	endDocument()
+	return documents, offsets
+}
+
+// Only the first document of a file is returned.
+func ReadYAMLDocumentFromFile(fileName string) ([]byte, error) {
+
+	documents, err := ReadYAMLDocumentsFromFile(fileName)
+	if len(documents) < 1 {
 		return []byte(""), err
 	}
-	defer fh.Close()
-	scanner := bufio.NewScanner(fh)
-	for scanner.Scan() {
-		l := []byte(scanner.Text())
-		b := false
-		if len(l) > 2 && bytes.Equal([]byte("---"), l[0:3]) {
-			b = true
+	return documents[0], err
+}
+
+// ReplaceFile replaces the file by a new one next to it, so it is never
+// half written, with the permissions of the original.
+func ReplaceFile(fileName string, content []byte) error {
+
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), ".natem-*"+filepath.Ext(fileName))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Split the optional document selector off a Thing location, i.e.
+// 'file.yml#2' addresses the second document and 'file.yml#foo' the
+// document with the Id.Name 'foo'.
+func SplitThingFragment(location string) (string, string) {
+
+	i := strings.LastIndex(location, "#")
+	if i < 0 {
+		return location, ""
+	}
+	return location[:i], location[i+1:]
+}
+
+// SelectThingDocuments returns the documents addressed by the fragment,
+// all of them if it is empty.
+func SelectThingDocuments(documents [][]byte, fragment string) ([][]byte, error) {
+
+	if fragment == "" {
+		return documents, nil
+	}
+	i, err := FindThingDocumentIndex(documents, fragment)
+	if err != nil {
+		return nil, err
+	}
+	return documents[i : i+1], nil
+}
+
+// FindThingDocumentIndex returns the index of the document addressed by
+// the fragment. Without fragment, the file must contain only one document.
+func FindThingDocumentIndex(documents [][]byte, fragment string) (int, error) {
+
+	if fragment == "" {
+		if len(documents) != 1 {
+			return -1, fmt.Errorf("The file has %d documents, please select one with '#'.\n", len(documents))
 		}
-		if startDocument {
-			if b {
-				break
-			}
-			contentBytes = append(contentBytes, l)
-		} else if b {
-			startDocument = true
+		return 0, nil
+	}
+	if n, err := strconv.Atoi(fragment); err == nil {
+		if n < 1 || n > len(documents) {
+			return -1, fmt.Errorf("There is no document number %d, the file has %d.\n", n, len(documents))
 		}
+		return n - 1, nil
 	}
-	err = scanner.Err()
-	if err == nil && len(contentBytes) < 1 {
-		err = errors.New("Unable to parse sensible data from file.")
+	for i, d := range documents {
+		t, err := ParseThing(d)
+		if err == nil && t.Id.Name == fragment {
+			return i, nil
+		}
 	}
-	return bytes.Join(contentBytes, []byte("\n")), err
+	return -1, fmt.Errorf("There is no document with the name '%s'.\n", fragment)
+}
+
+// ReadThingDocumentsFromLocation reads the documents from a file path with
+// an optional '#' selector.
+func ReadThingDocumentsFromLocation(location string) ([][]byte, error) {
+
+	fileName, fragment := SplitThingFragment(location)
+	documents, err := ReadYAMLDocumentsFromFile(fileName)
+	if err != nil {
+		return documents, err
+	}
+	return SelectThingDocuments(documents, fragment)
 }
 
 func ParseThing(yamlContent []byte) (Thing, error) {
@@ -219,6 +397,25 @@ func ParseThingFromFile(fileName string) (Thing, error) {
 	return ParseThing(yamlContent)
 }
 
+// ParseThingsFromFile treats every document in the file as a Thing of its
+// own. The file name may carry a '#' selector.
+func ParseThingsFromFile(fileName string) ([]Thing, error) {
+
+	var things []Thing
+	documents, err := ReadThingDocumentsFromLocation(fileName)
+	if err != nil {
+		return things, err
+	}
+	for _, d := range documents {
+		t, err := ParseThing(d)
+		if err != nil {
+			return things, err
+		}
+		things = append(things, t)
+	}
+	return things, nil
+}
+
 // Wrap and hide the external lib
 func Marshal(o interface{}) ([]byte, error) {
 
@@ -227,6 +424,12 @@ func Marshal(o interface{}) ([]byte, error) {
 	return resultBytes, err
 }
 
+// Wrap and hide the external lib
+func Unmarshal(y []byte, o interface{}) error {
+
+	return yaml.Unmarshal(y, o)
+}
+
 func SerializeThing(thing *Thing) ([]byte, error) {
 
 	// Make sure every Thing always has its UUID set
@@ -239,18 +442,79 @@ func SerializeThing(thing *Thing) ([]byte, error) {
 	return resultBytes, err
 }
 
+// Find the document in a file that holds the Thing, that is the one
+// selected by the fragment, the only one, or the one with the UUID the
+// Thing has stored.
+func findThingDocument(documents [][]byte, fragment string, thing *Thing) (int, error) {
+
+	if fragment != "" || len(documents) == 1 {
+		return FindThingDocumentIndex(documents, fragment)
+	}
+	if thing.Id.Uuid != "" {
+		for i, d := range documents {
+			var t Thing
+			if Unmarshal(d, &t) == nil && t.Id.Uuid == thing.Id.Uuid {
+				return i, nil
+			}
+		}
+	}
+	return -1, fmt.Errorf("None of the %d documents in the file has the UUID '%s', please select one with '#'.\n", len(documents), thing.Id.Uuid)
+}
+
+// If the file already contains the Thing, the changes are merged into it, so
+// comments, key order and styles of the original survive, as do the other
+// documents in the same file. The file name may carry a '#' selector for
+// the document.
 func SerializeThingToFile(thing *Thing, fileName string) error {
 
-	thingBytes, err := SerializeThing(thing)
+	fileName, fragment := SplitThingFragment(fileName)
+	content, err := os.ReadFile(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	documents := SplitYAMLDocuments(content)
+	if len(documents) == 0 {
+		if fragment != "" {
+			return fmt.Errorf("There is no document '%s' in the new file.\n", fragment)
+		}
+		thingBytes, err := SerializeThing(thing)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(fileName, JoinYAMLDocuments([][]byte{thingBytes}), 0644)
+	}
+	i, err := findThingDocument(documents, fragment, thing)
+	if err != nil {
+		return err
+	}
+	doc, err := ParseThingDocument(documents[i])
+	if err != nil {
+		return err
+	}
+	err = doc.Update(thing)
 	if err != nil {
 		return err
 	}
-	tbs := [][]byte{[]byte("---"), thingBytes}
-	ntbs := bytes.Join(tbs, []byte("\n"))
-	return os.WriteFile(fileName, ntbs, 0644)
+	documents[i], err = doc.encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, JoinYAMLDocuments(documents), 0644)
 }
 
-func WriteThingFile(thing *Thing, url string, context string, hasContext bool, overwrite bool) (string, string, error) {
+// Every document is preceded by the '---' separator.
+func JoinYAMLDocuments(documents [][]byte) []byte {
+
+	var b bytes.Buffer
+	for _, d := range documents {
+		b.WriteString("---\n")
+		b.Write(d)
+	}
+	return b.Bytes()
+}
+
+// Check the location for a new Thing file and create its directory.
+func prepareThingFile(url string, context string, hasContext bool, overwrite bool) (string, string, error) {
 
 	path, err := GetThingURLPath(url, context, hasContext)
 	if err != nil {
@@ -273,6 +537,22 @@ func WriteThingFile(thing *Thing, url string, context string, hasContext bool, o
 	} else if !dh.IsDir() {
 		return dir, file, fmt.Errorf("Existing but not a dir: %s.\n%s", path, err)
 	}
+	return dir, file, nil
+}
+
+// WriteThingFile writes the Thing to its file, the url may carry a '#'
+// selector for the document in a file with several.
+func WriteThingFile(thing *Thing, url string, context string, hasContext bool, overwrite bool) (string, string, error) {
+
+	url, fragment := SplitThingFragment(url)
+	dir, file, err := prepareThingFile(url, context, hasContext, overwrite)
+	if err != nil {
+		return dir, file, err
+	}
+	path := filepath.Join(dir, file)
+	if fragment != "" {
+		path += "#" + fragment
+	}
 	return dir, file, SerializeThingToFile(thing, path)
 }
 
@@ -282,3 +562,32 @@ func CreateNewThingFile(url string, context string, hasContext bool) (*Thing, er
 	_, _, e := WriteThingFile(t, url, context, hasContext, false)
 	return t, e
 }
+
+// CreateThingFileFromDocuments writes hand-written documents to a new Thing
+// file, making sure that every Thing has its UUID set, just as
+// CreateNewThingFile does.
+func CreateThingFileFromDocuments(documents [][]byte, url string, context string, hasContext bool) ([]Thing, error) {
+
+	var things []Thing
+	dir, file, err := prepareThingFile(url, context, hasContext, false)
+	if err != nil {
+		return things, err
+	}
+	for i, d := range documents {
+		doc, err := ParseThingDocument(d)
+		if err != nil {
+			return things, err
+		}
+		// the UUID was set by the parser if it was missing
+		err = doc.Update(&doc.Thing)
+		if err != nil {
+			return things, err
+		}
+		documents[i], err = doc.encode()
+		if err != nil {
+			return things, err
+		}
+		things = append(things, doc.Thing)
+	}
+	return things, os.WriteFile(filepath.Join(dir, file), JoinYAMLDocuments(documents), 0644)
+}
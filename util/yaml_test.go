@@ -200,3 +200,105 @@ func TestCreateNewThingFile(t *testing.T) {
 	}
 	os.Remove(d)
 }
+
+func TestReadYAMLDocumentsFromFile(t *testing.T) {
+
+	a, e := ReadYAMLDocumentsFromFile("testing/multi.yml")
+	if e != nil {
+		t.Fatalf("Error reading the documents: %s.\n", e)
+	}
+	if len(a) != 3 {
+		t.Fatalf("Expected 3 documents, got %d.\n", len(a))
+	}
+	b, e := ReadYAMLDocumentFromFile("testing/multi.yml")
+	if e != nil {
+		t.Fatalf("Error reading the first document: %s.\n", e)
+	}
+	if string(a[0]) != string(b) {
+		t.Fatal("The first document should have been returned.")
+	}
+}
+
+func TestParseThingsFromFile(t *testing.T) {
+
+	a, e := ParseThingsFromFile("testing/multi.yml")
+	if e != nil {
+		t.Fatalf("Error parsing the Things: %s.\n", e)
+	}
+	if len(a) != 3 || a[0].Id.Name != "first" || a[2].Id.Name != "third" {
+		t.Fatal("Every document should have been parsed as a Thing.")
+	}
+	a, e = ParseThingsFromFile("testing/multi.yml#2")
+	if e != nil {
+		t.Fatalf("Error parsing the second Thing: %s.\n", e)
+	}
+	if len(a) != 1 || a[0].Id.Name != "second" {
+		t.Fatal("The second document should have been selected by number.")
+	}
+	a, e = ParseThingsFromFile("testing/multi.yml#third")
+	if e != nil {
+		t.Fatalf("Error parsing the third Thing: %s.\n", e)
+	}
+	if len(a) != 1 || a[0].Id.Version != "" {
+		t.Fatal("The third document should have been selected by name.")
+	}
+	t.Log("Now failing successfully (no such document):")
+	_, e = ParseThingsFromFile("testing/multi.yml#4")
+	if e == nil {
+		t.Fatal("There is no fourth document..")
+	}
+	_, e = ParseThingsFromFile("testing/multi.yml#fourth")
+	if e == nil {
+		t.Fatal("There is no document named 'fourth'..")
+	}
+}
+
+func TestSerializeThingToMultiDocumentFile(t *testing.T) {
+
+	c, e := os.ReadFile("testing/multi.yml")
+	if e != nil {
+		t.Fatal(e)
+	}
+	f, err := os.CreateTemp("testing", "natem")
+	defer os.Remove(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(c)
+	f.Close()
+	var a Thing
+	d, _ := ReadThingDocumentsFromLocation(f.Name() + "#2")
+	Unmarshal(d[0], &a)
+	a.Id.Version = "0.3"
+	t.Log("Now failing successfully (no UUID to find the document by):")
+	if err = SerializeThingToFile(&a, f.Name()); err == nil {
+		t.Fatal("A Thing without UUID can only be found by its number.")
+	}
+	err = SerializeThingToFile(&a, f.Name()+"#2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseThingsFromFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 3 || b[1].Id.Version != "0.3" || b[2].Id.Name != "third" {
+		t.Fatal("Only the second document should have changed.")
+	}
+}
+
+func TestSerializeThingToBrokenDocument(t *testing.T) {
+
+	f := filepath.Join(t.TempDir(), "broken.yml")
+	c := "---\nid:\n  name: first\n---\nid: [unclosed\n"
+	os.WriteFile(f, []byte(c), 0644)
+	a := Thing{Id: ThingId{Name: "second"}}
+	t.Log("Now failing successfully (the document can not be parsed):")
+	if e := SerializeThingToFile(&a, f+"#2"); e == nil {
+		t.Fatal("Expected an error for a broken document.")
+	}
+	b, _ := os.ReadFile(f)
+	if string(b) != c {
+		t.Fatalf("The file must be left alone, but got ...\n%s", b)
+	}
+}